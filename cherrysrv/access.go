@@ -0,0 +1,335 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Connection limits and address bans.
+//
+// Every connection is admitted (or rejected with a single line) before it
+// becomes a client: its address must not be banned, and neither the server
+// (MAXCONNS), its listener (maxconns) nor its address (MAXPERIP) can be full.
+//
+// Sysops, users logged in with a tripcode in SYSOPS, manage the bans with
+// /ipban and /ipunban. Bans are stored in DATADIR.
+
+const BANS_FILE = "bans.json"
+
+var (
+	MAXCONNS = 0 // connections to the server, 0 for no limit
+	MAXPERIP = 0 // connections from an address, 0 for no limit
+	SYSOPS   = map[string]bool{}
+)
+
+var ACCESS struct {
+	conns int            // connections admitted
+	perIP map[string]int // connections admitted from every address
+	bans  []ipBan
+	nets  []*net.IPNet // parsed bans, same order
+	sync.Mutex
+}
+
+// a banned address or network
+type ipBan struct {
+	Net    string    `json:"net"` // i.e. 10.0.0.0/8 or 2001:db8::/32
+	Reason string    `json:"reason,omitempty"`
+	By     string    `json:"by"`
+	Added  time.Time `json:"added"`
+}
+
+// parse an address or a network, returning it as a network
+func parseNet(addr string) (*net.IPNet, error) {
+
+	if !strings.Contains(addr, "/") {
+		ip := net.ParseIP(addr)
+		if ip == nil {
+			return nil, fmt.Errorf("%s is not a valid address", addr)
+		}
+
+		bits := 128
+		if ip.To4() != nil {
+			ip, bits = ip.To4(), 32
+		}
+
+		return &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}, nil
+	}
+
+	_, network, err := net.ParseCIDR(addr)
+	if err != nil {
+		return nil, fmt.Errorf("%s is not a valid network", addr)
+	}
+
+	return network, nil
+}
+
+// the address of a connection, nil if it's not an IP one
+func remoteIP(conn net.Conn) net.IP {
+
+	if addr, ok := conn.RemoteAddr().(*net.TCPAddr); ok {
+		return addr.IP
+	}
+
+	return nil
+}
+
+// the ban of ip, if any. Call with ACCESS locked.
+func bannedLocked(ip net.IP) (ipBan, bool) {
+
+	for i, network := range ACCESS.nets {
+		if network.Contains(ip) {
+			return ACCESS.bans[i], true
+		}
+	}
+
+	return ipBan{}, false
+}
+
+// count the connection if it can be accepted, or return why not
+func admit(conn net.Conn, l *Listener) (string, bool) {
+	ACCESS.Lock()
+	defer ACCESS.Unlock()
+
+	ip := remoteIP(conn)
+
+	if ip != nil {
+		if ban, ok := bannedLocked(ip); ok {
+			return banMessage(ban.Reason), false
+		}
+	}
+
+	if (MAXCONNS > 0 && ACCESS.conns >= MAXCONNS) || (l.maxconns > 0 && l.conns.Load() >= l.maxconns) {
+		return "this server is full, please try again later", false
+	}
+
+	if ip != nil && MAXPERIP > 0 && ACCESS.perIP[ip.String()] >= MAXPERIP {
+		return "too many connections from your address", false
+	}
+
+	ACCESS.conns++
+	l.conns.Add(1)
+
+	if ip != nil {
+		if ACCESS.perIP == nil {
+			ACCESS.perIP = map[string]int{}
+		}
+
+		ACCESS.perIP[ip.String()]++
+	}
+
+	return "", true
+}
+
+// stop counting an admitted connection
+func release(conn net.Conn, l *Listener) {
+	ACCESS.Lock()
+	defer ACCESS.Unlock()
+
+	ACCESS.conns--
+	l.conns.Add(-1)
+
+	if ip := remoteIP(conn); ip != nil {
+		if ACCESS.perIP[ip.String()]--; ACCESS.perIP[ip.String()] <= 0 {
+			delete(ACCESS.perIP, ip.String())
+		}
+	}
+}
+
+// load the bans stored in DATADIR
+func load_bans() error {
+
+	var bans []ipBan
+
+	if err := readJSON(BANS_FILE, &bans); err != nil {
+		return err
+	}
+
+	ACCESS.Lock()
+	defer ACCESS.Unlock()
+
+	ACCESS.bans, ACCESS.nets = nil, nil
+
+	for _, ban := range bans {
+		network, err := parseNet(ban.Net)
+		if err != nil {
+			WARN.Printf("ignoring stored ban: %s", err)
+			continue
+		}
+
+		ACCESS.bans = append(ACCESS.bans, ban)
+		ACCESS.nets = append(ACCESS.nets, network)
+	}
+
+	INFO.Printf("%d address bans loaded", len(ACCESS.bans))
+
+	return nil
+}
+
+// store the bans in DATADIR. Call with ACCESS locked.
+func saveBansLocked() {
+	if err := writeJSON(BANS_FILE, ACCESS.bans); err != nil {
+		ERROR.Printf("unable to save address bans: %s", err)
+	}
+}
+
+func (clt *Client) isSysop() bool {
+	return clt.isLocal() && clt.isLogged() && len(clt.trip) > 0 && SYSOPS[clt.trip]
+}
+
+// -sysop !trip
+func addSysop(trip string) error {
+
+	trip = strings.TrimPrefix(trip, "!")
+
+	if !ValidTrip("!" + trip) {
+		return fmt.Errorf("-sysop %s is not a valid tripcode", trip)
+	}
+
+	SYSOPS[trip] = true
+
+	return nil
+}
+
+func banMessage(reason string) string {
+
+	if no(reason) {
+		return "your address is banned"
+	}
+
+	return "your address is banned: " + reason
+}
+
+// disconnect the local clients inside network
+func disconnectNet(network *net.IPNet, reason string) (output []string) {
+
+	disconnect := func(key string, clt *Client) bool {
+		if !clt.isLocal() || clt.Status.Load() == USER_LOGGINOUT {
+			return true
+		}
+
+		if ip := remoteIP(clt.conn); ip == nil || !network.Contains(ip) {
+			return true
+		}
+
+		output = append(output, clt.Name)
+
+		clt.Say(">#main>!rejected>%s", banMessage(reason))
+
+		if clt.isLogged() {
+			clt.UpdateInMain(">!disconnect>%s disconnected", clt)
+		}
+
+		clt.Status.Store(USER_LOGGINOUT)
+		clt.Close()
+
+		return true
+	}
+
+	CLIENTS.Range(disconnect)
+
+	return output
+}
+
+// show or add address bans
+func do_ipban(clt *Client, args string) {
+
+	if !clt.isSysop() {
+		clt.Say(">/ipban>0>/ipban is only for sysops")
+
+		return
+	}
+
+	if no(args) {
+		var output []string
+
+		ACCESS.Lock()
+		for _, ban := range ACCESS.bans {
+			output = append(output, strings.TrimSpace(fmt.Sprintf("%s %s %s", ban.Net, ban.By, ban.Reason)))
+		}
+		ACCESS.Unlock()
+
+		sort.Strings(output)
+
+		if len(output) == 0 {
+			clt.Say(">/ipban>0>no addresses are banned")
+			return
+		}
+
+		clt.SayN(">/ipban>", output)
+		return
+	}
+
+	addr, reason := split2(args, " ")
+
+	network, err := parseNet(addr)
+	if err != nil {
+		clt.Say(">/ipban>0>%s", err)
+		return
+	}
+
+	ACCESS.Lock()
+
+	for _, ban := range ACCESS.bans {
+		if ban.Net == network.String() {
+			ACCESS.Unlock()
+			clt.Say(">/ipban>0>%s is already banned", network)
+			return
+		}
+	}
+
+	ACCESS.bans = append(ACCESS.bans, ipBan{Net: network.String(), Reason: reason, By: clt.fullName(), Added: time.Now()})
+	ACCESS.nets = append(ACCESS.nets, network)
+	saveBansLocked()
+
+	ACCESS.Unlock()
+
+	disconnected := disconnectNet(network, reason)
+
+	clt.Say(">/ipban>0>%s banned, %d users disconnected", network, len(disconnected))
+	INFO.Printf("%s banned %s (%s), disconnecting %v", clt, network, reason, disconnected)
+}
+
+// remove an address ban
+func do_ipunban(clt *Client, args string) {
+
+	if !clt.isSysop() {
+		clt.Say(">/ipunban>0>/ipunban is only for sysops")
+
+		return
+	}
+
+	if no(args) {
+		clt.Say(">/ipunban>0>/ipunban <address|network>")
+
+		return
+	}
+
+	addr, _ := split2(args, " ")
+
+	network, err := parseNet(addr)
+	if err != nil {
+		clt.Say(">/ipunban>0>%s", err)
+		return
+	}
+
+	ACCESS.Lock()
+	defer ACCESS.Unlock()
+
+	for i, ban := range ACCESS.bans {
+		if ban.Net == network.String() {
+			ACCESS.bans = append(ACCESS.bans[:i], ACCESS.bans[i+1:]...)
+			ACCESS.nets = append(ACCESS.nets[:i], ACCESS.nets[i+1:]...)
+			saveBansLocked()
+
+			clt.Say(">/ipunban>0>%s is not banned anymore", network)
+			INFO.Printf("%s unbanned %s", clt, network)
+			return
+		}
+	}
+
+	clt.Say(">/ipunban>0>%s is not banned", network)
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"bufio"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseNet(t *testing.T) {
+
+	tests := []struct {
+		addr string
+		want string
+		ok   bool
+	}{
+		{"192.168.1.2", "192.168.1.2/32", true},
+		{"10.1.2.3/8", "10.0.0.0/8", true},
+		{"2001:db8::1", "2001:db8::1/128", true},
+		{"2001:db8::/32", "2001:db8::/32", true},
+		{"::ffff:10.0.0.1", "10.0.0.1/32", true},
+		{"localhost", "", false},
+		{"10.0.0.0/33", "", false},
+		{"", "", false},
+	}
+
+	for _, test := range tests {
+		network, err := parseNet(test.addr)
+
+		if (err == nil) != test.ok {
+			t.Fatalf("parseNet(%s) failed with %v", test.addr, err)
+		}
+
+		if err == nil && network.String() != test.want {
+			t.Fatalf("parseNet(%s) = %s, expected %s", test.addr, network, test.want)
+		}
+	}
+}
+
+func TestAccess(t *testing.T) {
+	// configure test server
+	init_logger()
+	init_commands()
+	gentoken = func() string { return "TOKEN" }
+	main_channel := NewChannelMain("#main")
+	CHANNELS.Store(main_channel.Key(), main_channel)
+
+	DATADIR = t.TempDir()
+	TRIPKEY = "key"
+	MAXPERIP = 1
+	SYSOPS = map[string]bool{}
+	defer func() { DATADIR, TRIPKEY, MAXPERIP, SYSOPS = "", "", 0, map[string]bool{} }()
+
+	if err := addSysop("!" + generateTrip("secreto", TRIPKEY)); err != nil {
+		t.Fatalf("addSysop failed with %s", err)
+	}
+
+	if err := load_bans(); err != nil {
+		t.Fatalf("load_bans failed with %s", err)
+	}
+
+	l, _ := parseListener("127.0.0.1:0")
+
+	server, err := net.Listen(l.network, l.addr)
+	if err != nil {
+		t.Fatalf("unable to listen: %s", err)
+	}
+	defer server.Close()
+
+	go l.serve(server)
+
+	readLine := func(name string, reader *bufio.Reader, expected string) {
+		line, err := reader.ReadString('\n')
+
+		if err != nil || !strings.HasPrefix(line, expected) {
+			t.Fatalf("%s got %q (%v), expected %s", name, line, err, expected)
+		}
+	}
+
+	dial := func() (net.Conn, *bufio.Reader) {
+		conn, err := net.Dial("tcp", server.Addr().String())
+		if err != nil {
+			t.Fatalf("unable to connect: %s", err)
+		}
+
+		return conn, bufio.NewReader(conn)
+	}
+
+	_, out1, in1 := genClient()
+
+	out1.Write([]byte("/login @op#secreto\n"))
+	expectLines(t, "Login Sysop", in1, out1, ">/login>0>you're now @op", ">#main>!token>TOKEN")
+
+	_, out2, in2 := genClient()
+
+	out2.Write([]byte("/login @alice\n"))
+	expectLines(t, "Login", in2, out2, ">/login>0>you're now @alice", ">#main>!token>TOKEN")
+	expectLines(t, "Login Notice", in1, out1, ">#main>!login>@alice has joined the server")
+
+	conn, reader := dial()
+	defer conn.Close()
+	readLine("Welcome", reader, ">#main>!welcome>")
+
+	second, secondReader := dial()
+	readLine("Per Address", secondReader, ">#main>!rejected>too many connections from your address")
+	second.Close()
+
+	out2.Write([]byte("/ipban 127.0.0.1\n"))
+	expectLines(t, "Ban Not Sysop", in2, out2, ">/ipban>0>/ipban is only for sysops")
+
+	out1.Write([]byte("/ipban\n"))
+	expectLines(t, "No Bans", in1, out1, ">/ipban>0>no addresses are banned")
+
+	out1.Write([]byte("/ipban localhost\n"))
+	expectLines(t, "Ban Wrong Address", in1, out1, ">/ipban>0>localhost is not a valid address")
+
+	out1.Write([]byte("/ipban 127.0.0.1 flooding\n"))
+	readLine("Banned Disconnect", reader, ">#main>!rejected>your address is banned: flooding")
+	expectLines(t, "Ban", in1, out1, ">/ipban>0>127.0.0.1/32 banned, 1 users disconnected")
+
+	out1.Write([]byte("/ipban 127.0.0.1\n"))
+	expectLines(t, "Ban Twice", in1, out1, ">/ipban>0>127.0.0.1/32 is already banned")
+
+	banned, bannedReader := dial()
+	readLine("Banned", bannedReader, ">#main>!rejected>your address is banned: flooding")
+	banned.Close()
+
+	// bans are kept across restarts
+	if err := load_bans(); err != nil || len(ACCESS.bans) != 1 {
+		t.Fatalf("load_bans failed with %v, %d bans", err, len(ACCESS.bans))
+	}
+
+	out1.Write([]byte("/ipban\n"))
+	expectLines(t, "Bans", in1, out1, ">/ipban>0>127.0.0.1/32 @op!"+generateTrip("secreto", TRIPKEY)+" flooding")
+
+	out1.Write([]byte("/ipunban 127.0.0.1\n"))
+	expectLines(t, "Unban", in1, out1, ">/ipunban>0>127.0.0.1/32 is not banned anymore")
+
+	out1.Write([]byte("/ipunban 127.0.0.1\n"))
+	expectLines(t, "Unban Twice", in1, out1, ">/ipunban>0>127.0.0.1/32 is not banned")
+
+	conn, reader = dial()
+	defer conn.Close()
+	readLine("Welcome Again", reader, ">#main>!welcome>")
+	conn.Close()
+
+	out2.Write([]byte("/logoff\n"))
+	expectLines(t, "Logoff", in2, out2, ">/logoff>0>Goodbye @alice")
+
+	out1.Write([]byte("/logoff\n"))
+	expectLines(t, "Logoff #2", in1, out1, ">#main>!logoff>@alice is leaving", ">/logoff>0>Goodbye @op")
+
+	for i := 0; i < 50 && l.conns.Load() > 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if l.conns.Load() != 0 {
+		t.Fatalf("%d connections still counted", l.conns.Load())
+	}
+}
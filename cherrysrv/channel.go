@@ -16,9 +16,23 @@ type Channel struct {
 	clients      []*Client // clients in the channel.
 	Name         string    // Name of the channel (incl #)
 	hidden       bool
-	closeOnEmpty bool // only #main should have this as false
-	Status       int  // CHANNEL_WORKING, CHANNEL_SHUTTINGDOWN
-	sync.RWMutex      // for adding/removing client connections
+	closeOnEmpty bool            // only #main and registered channels should have this as false
+	registered   bool            // stored on disk (see register.go)
+	linked       bool            // shared with peer servers
+	owner        string          // tripcode of the user that created the channel, if they had one
+	topic        string          // set with /topic
+	key          string          // required to join, set with +k
+	modes        map[string]bool // channel modes set (see mode.go)
+	ops          map[string]bool // names of the channel operators
+	opTrips      map[string]bool // tripcodes of the channel operators, to give ops back when they join
+	voiced       map[string]bool // names of the users that may speak when moderated
+	bans         map[string]bool // names of the users that may not join
+	muted        map[string]bool // names of the users that may not speak
+	allowed      map[string]bool // tripcodes that may join, anybody if empty
+	filter       string          // word filter policy, set with +f
+	hits         map[string]int  // word filter hits per user
+	Status       int             // CHANNEL_WORKING, CHANNEL_SHUTTINGDOWN
+	sync.RWMutex                 // for adding/removing client connections
 }
 
 func newChannel(name string, hiddenChannel bool) *Channel {
@@ -27,6 +41,15 @@ func newChannel(name string, hiddenChannel bool) *Channel {
 		Name:         name,
 		hidden:       hiddenChannel,
 		closeOnEmpty: true,
+		linked:       !hiddenChannel && !LOCALCHANNELS[name],
+		modes:        map[string]bool{},
+		ops:          map[string]bool{},
+		opTrips:      map[string]bool{},
+		voiced:       map[string]bool{},
+		bans:         map[string]bool{},
+		muted:        map[string]bool{},
+		allowed:      map[string]bool{},
+		hits:         map[string]int{},
 		Status:       CHANNEL_WORKING,
 		RWMutex:      sync.RWMutex{},
 	}
@@ -39,6 +62,15 @@ func NewChannelMain(name string) *Channel {
 		Name:         name,
 		hidden:       false,
 		closeOnEmpty: false,
+		linked:       !LOCALCHANNELS[name],
+		modes:        map[string]bool{},
+		ops:          map[string]bool{},
+		opTrips:      map[string]bool{},
+		voiced:       map[string]bool{},
+		bans:         map[string]bool{},
+		muted:        map[string]bool{},
+		allowed:      map[string]bool{},
+		hits:         map[string]int{},
 		Status:       CHANNEL_WORKING,
 
 		RWMutex: sync.RWMutex{},
@@ -81,6 +113,41 @@ func (c *Channel) ClientNames() (output []string) {
 	return output
 }
 
+func (c *Channel) getTopic() string {
+	c.RLock()
+	defer c.RUnlock()
+
+	return c.topic
+}
+
+func (c *Channel) setTopic(topic string) {
+	c.Lock()
+	c.topic = topic
+	c.Unlock()
+
+	c.changed()
+}
+
+// is clt the owner? Ownership goes with the tripcode, not the name, so
+// nobody gets it by taking the name of the owner.
+func (c *Channel) isOwner(clt *Client) bool {
+	c.RLock()
+	defer c.RUnlock()
+
+	return len(c.owner) > 0 && c.owner == clt.trip
+}
+
+// return a copy of the clients currently in this channel
+func (c *Channel) members() []*Client {
+	c.RLock()
+	defer c.RUnlock()
+
+	output := make([]*Client, len(c.clients))
+	copy(output, c.clients)
+
+	return output
+}
+
 // find if a certain client is in this channel
 func (c *Channel) contains(client *Client) bool {
 	c.RLock()
@@ -109,9 +176,35 @@ func (channel *Channel) addClient(newClient *Client) bool {
 	return true
 }
 
+// put newClient in place of oldClient, keeping its position in the channel
+func (channel *Channel) replaceClient(oldClient *Client, newClient *Client) bool {
+	channel.Lock()
+	defer channel.Unlock()
+
+	for i := 0; i < len(channel.clients); i++ {
+		if channel.clients[i] == oldClient {
+			channel.clients[i] = newClient
+			return true
+		}
+	}
+
+	return false
+}
+
 // remove client and return bool if successful.
 // if it's the last channel, remove the channel from the server
 func (channel *Channel) removeClient(client *Client) bool {
+
+	if !channel.removeMember(client) {
+		return false
+	}
+
+	channel.forgetMember(client)
+
+	return true
+}
+
+func (channel *Channel) removeMember(client *Client) bool {
 	channel.Lock()
 	defer channel.Unlock()
 
@@ -157,29 +250,77 @@ func (channel *Channel) removeClient(client *Client) bool {
 }
 
 func (channel *Channel) Say(from *Client, format string, args ...interface{}) {
+	channel.sayAs(LINE_SAY, from, fmt.Sprintf(format, args...))
+}
 
-	message := fmt.Sprintf(format, args...)
+// say a kind of line (see emote.go) in the channel
+func (channel *Channel) sayAs(kind string, from *Client, message string) {
 
 	if len(message) == 0 {
 		return
 	}
 
-	channel.write(from, ">"+channel.Name+">"+from.Name+">"+message+"\n")
+	channel.deliver(kind, from, message)
+
+	if channel.linked && from.isLocal() {
+		linkBroadcast("%s %s %s %s", LINEVERBS[kind], channel, from, message)
+	}
 }
 
-func (c *Channel) write(from *Client, message string) {
-	c.RLock()
-	defer c.RUnlock()
+// deliver a message to the local members of the channel
+func (channel *Channel) deliver(kind string, from *Client, message string) {
+	channel.write(from, ">"+channel.Name+">"+kind+from.Name+">"+message+"\n")
+}
 
-	len := len(c.clients)
+// tell the members of the channel what from rolled
+func (channel *Channel) roll(from *Client, result string) {
 
-	if len == 0 {
-		return
+	channel.write(from, shorten255(">"+channel.Name+">!roll>"+from.Name+" "+result+"\n"))
+
+	if channel.linked && from.isLocal() {
+		linkBroadcast("ROLL %s %s %s", channel, from, result)
 	}
+}
 
-	for i := 0; i < len; i++ {
-		if c.clients[i].isLogged() { // TODO: we should be able to remove this check. If is in a channel IT MUST be logged.
-			c.clients[i].write(message)
+// tell peer servers that a local client joined the channel
+func (channel *Channel) linkJoin(clt *Client) {
+	if channel.linked && clt.isLocal() {
+		linkBroadcast("JOIN %s %s", channel, clt)
+	}
+}
+
+// make the creator of the channel its owner and operator
+func (channel *Channel) setCreator(clt *Client) {
+
+	channel.Lock()
+	channel.owner = clt.trip
+	channel.Unlock()
+
+	channel.setMode(true, MODE_OP, clt.Name)
+
+	if channel.linked && clt.isLocal() {
+		linkBroadcast("MODE %s %s +o %s", channel, clt, clt)
+	}
+}
+
+// tell peer servers that a local client left the channel
+func (channel *Channel) linkPart(clt *Client) {
+	if channel.linked && clt.isLocal() {
+		linkBroadcast("PART %s %s", channel, clt)
+	}
+}
+
+// write a message to every member. Clients queue their output, so a slow one
+// can't stall the channel, and we don't hold the lock while queueing.
+func (c *Channel) write(from *Client, message string) {
+
+	for _, client := range c.members() {
+		if !client.hears(from) {
+			continue
+		}
+
+		if client.isLogged() { // TODO: we should be able to remove this check. If is in a channel IT MUST be logged.
+			client.write(message)
 		}
 	}
 
@@ -5,7 +5,9 @@ import (
 	"fmt"
 	"net"
 	"strings"
+	"sync"
 	"sync/atomic"
+	"time"
 )
 
 // client status
@@ -15,23 +17,42 @@ const (
 	USER_LOGGINOUT = 4 // Player being cleaned up, it won't accept any string sent to them.
 )
 
+// serialises every change of the names (keys) in CLIENTS, so two clients
+// can't claim the same name at the same time.
+var NICKS sync.Mutex
+
 // Client connection storing basic client data
 type Client struct {
-	conn   net.Conn // network connection interface.
-	Name   string   // Name of the user.
-	Status atomic.Int32
+	conn       net.Conn      // network connection interface.
+	reader     *bufio.Reader // buffered input from conn.
+	out        *outbox       // queued output to conn.
+	Name       string        // Name of the user.
+	Status     atomic.Int32
+	link       *Link        // peer server the user is connected to, nil for local users.
+	loggedOn   time.Time    // when the user logged in, to settle nick collisions between servers.
+	token      string       // to resume the session after a disconnection.
+	detached   atomic.Bool  // connection lost, waiting for a /resume.
+	binary     atomic.Bool  // talking the binary protocol (see proto.go).
+	ignored    ignoreList   // users this client doesn't want to hear from.
+	filterHits atomic.Int32 // word filter hits in private messages.
+	trip       string       // tripcode of the secret used to /login, if any (see trip.go).
+	listener   *Listener    // where the client connected, nil for remote users.
 }
 
 func (c *Client) String() string {
 	return c.Name
 }
 
-func newClient(conn net.Conn) *Client {
+func newClient(conn net.Conn, listener *Listener) *Client {
 
 	client := &Client{
-		conn: conn,
-		Name: gensym("@Anon"),
+		conn:     conn,
+		reader:   bufio.NewReader(conn),
+		Name:     gensym("@Anon"),
+		listener: listener,
 	}
+	client.out = newOutbox(conn, client, OVERFLOW)
+	client.out.encode = client.encode
 	client.Status.Store(USER_NOTLOGGED)
 
 	INFO.Printf("%s has connected (%s)", client.Name, client.conn.RemoteAddr())
@@ -41,16 +62,114 @@ func newClient(conn net.Conn) *Client {
 	return client
 }
 
+// a user logged in on a peer server. Remote users have no connection,
+// whatever is sent to them is delivered by their own server.
+func newRemoteClient(link *Link, name string, loggedOn time.Time, trip string) *Client {
+
+	client := &Client{
+		Name:     name,
+		link:     link,
+		loggedOn: loggedOn,
+		trip:     trip,
+	}
+	client.Status.Store(USER_LOGGED)
+
+	DEBUG.Printf("%s has connected from %s", client.Name, link)
+
+	CLIENTS.Store(client.Key(), client)
+
+	if mainChannel, ok := CHANNELS.Load("#main"); ok && mainChannel.linked {
+		mainChannel.addClient(client)
+	}
+
+	return client
+}
+
 func (c *Client) Key() string {
 	return c.Name
 }
 
+// move the client to newName in CLIENTS, failing if the name is taken
+func (clt *Client) rename(newName string) error {
+	NICKS.Lock()
+	defer NICKS.Unlock()
+
+	if _, ok := CLIENTS.Load(newName); ok {
+		return fmt.Errorf("%s is already taken", newName)
+	}
+
+	oldName := clt.Name
+
+	CLIENTS.Store(newName, clt)
+	clt.Name = newName
+
+	if current, ok := CLIENTS.Load(oldName); ok && current == clt {
+		CLIENTS.Delete(oldName)
+	}
+
+	return nil
+}
+
+// follow a name change in every channel and tell the channels the client is in
+func (clt *Client) nickChanged(oldName string) {
+
+	renameIgnored := func(key string, client *Client) bool {
+		if client.ignored.rename(oldName, clt.Name) {
+			client.saveIgnored()
+		}
+		return true
+	}
+
+	CLIENTS.Range(renameIgnored)
+
+	announce := func(key string, channel *Channel) bool {
+		channel.renameMember(oldName, clt.Name)
+
+		if channel.contains(clt) && channel.showEvents() {
+			channel.write(clt, ">"+channel.Name+">!nick>"+oldName+" "+clt.Name+"\n")
+		}
+		return true
+	}
+
+	CHANNELS.Range(announce)
+}
+
+// deliver a private message to the client, wherever they are connected
+func (clt *Client) privateSay(from *Client, message string) {
+
+	if !clt.hears(from) {
+		return
+	}
+
+	if !clt.isLocal() {
+		clt.link.send("PRIVMSG %s %s %s", clt, from, message)
+		return
+	}
+
+	clt.write(">" + from.Name + ">" + from.Name + ">" + message + "\n")
+}
+
+// is the user connected to this server?
+func (c *Client) isLocal() bool {
+	return c.link == nil
+}
+
 // Close a client connection following ws protocol plus removing the internal handlers in the mud.
 func (clt *Client) Close() {
 
+	clt.detached.Store(false)
+	clt.dropToken()
 	clt.RemoveMeFromAllChannels()
-	clt.conn.Close()
-	CLIENTS.Delete(clt.Name)
+
+	if clt.isLocal() {
+		clt.out.close()
+		linkBroadcast("QUIT %s", clt)
+	}
+
+	// the name may already belong to someone else (i.e. after a nick collision)
+	if current, ok := CLIENTS.Load(clt.Name); ok && current == clt {
+		CLIENTS.Delete(clt.Name)
+	}
 }
 
 // main client loop that process client's messages
@@ -66,8 +185,17 @@ func (clt *Client) clientLoop() {
 			return
 		}
 
-		line, err := clt.read()
+		command, args, err := clt.readCommand()
 		if err != nil {
+			if clt.Status.Load() == USER_LOGGINOUT { // already closed by the server
+				return
+			}
+
+			if clt.isLogged() && RESUMEGRACE > 0 {
+				clt.detach()
+				return
+			}
+
 			INFO.Printf("%s disconnected (%s)", clt, clt.conn.RemoteAddr())
 			clt.UpdateInMain(">!disconnect>%s disconnected", clt)
 			clt.Close()
@@ -75,8 +203,6 @@ func (clt *Client) clientLoop() {
 			return
 		}
 
-		command, args := parse(line)
-
 		if no(command) { // line was empty
 			continue
 		}
@@ -136,20 +262,22 @@ func (clt *Client) write(line string) (n int, err error) {
 	return clt.writeNoLimit(line)
 }
 
-// writeNoLimit a message to the client. Unlimited length.
+// writeNoLimit a message to the client. Unlimited length. It never blocks,
+// the message is queued and sent by the client's writer.
 func (clt *Client) writeNoLimit(line string) (n int, err error) {
 
-	if len(line) == 0 {
+	if len(line) == 0 || !clt.isLocal() {
 		return
 	}
 
-	DataLength, err := clt.conn.Write([]byte(line))
+	err = clt.out.push(line)
 
 	if err != nil {
 		DEBUG.Printf("%s.write() failed with err: %s", clt, err)
+		return 0, err
 	}
 
-	return DataLength, err
+	return len(line), nil
 }
 
 // check if client is logged
@@ -157,13 +285,31 @@ func (clt *Client) isLogged() bool {
 	return clt.Status.Load() == USER_LOGGED
 }
 
+// Read the next command sent by client, in text or binary protocol
+func (clt *Client) readCommand() (command string, args string, err error) {
+
+	if clt.binary.Load() {
+		return clt.readFrame()
+	}
+
+	line, err := clt.read()
+	if err != nil {
+		return
+	}
+
+	command, args = parse(line)
+
+	return
+}
+
 // Read message sent by client, limited to 255 chars
 func (client *Client) read() (string, error) {
 
-	netData, err := bufio.NewReader(client.conn).ReadString('\n')
+	netData, err := client.reader.ReadString('\n')
 
 	if err != nil {
 		DEBUG.Printf("%s.read() failed with err: %s", client, err)
+		return "", err
 	}
 
 	netData = shorten255(netData)
@@ -186,9 +332,36 @@ func Broadcast(format string, args ...interface{}) {
 	CLIENTS.Range(broadcast)
 }
 
+// to be used by the server before exiting, give every client some time to
+// receive what is queued for them
+func FlushAll(timeout time.Duration) {
+
+	var outs []*outbox
+
+	closeClient := func(key string, clt *Client) bool {
+		if clt.isLocal() {
+			clt.out.close()
+			outs = append(outs, clt.out)
+		}
+		return true
+	}
+
+	CLIENTS.Range(closeClient)
+
+	deadline := time.Now().Add(timeout)
+
+	for _, out := range outs {
+		out.wait(time.Until(deadline))
+	}
+}
+
 // to be user by the server, send a message to everyone connected to the main channel (excluding the sender)
 func (clt *Client) UpdateInMain(format string, args ...interface{}) {
 
+	if mainChannel, ok := CHANNELS.Load("#main"); ok && !mainChannel.showEvents() {
+		return
+	}
+
 	line := fmt.Sprintf(format, args...)
 
 	broadcast := func(key string, client *Client) bool {
@@ -13,7 +13,7 @@ func genClient() (c *Client, out net.Conn, in *bufio.Reader) {
 
 	in = bufio.NewReader(out)
 
-	c = newClient(server)
+	c = newClient(server, nil)
 	go c.clientLoop()
 
 	if res, _, err := in.ReadLine(); err == nil {
@@ -28,6 +28,7 @@ func TestSingleClient(t *testing.T) {
 	// configure test server
 	init_logger()
 	init_commands()
+	gentoken = func() string { return "TOKEN" }
 	main_channel := NewChannelMain("#main")
 	CHANNELS.Store(main_channel.Key(), main_channel)
 
@@ -47,12 +48,12 @@ func TestSingleClient(t *testing.T) {
 		{"Fail Channel Join Test", []byte("/join #test\n"), []string{">/join>0>/join requires you to be logged"}},
 		{"Fail User Count Test", []byte("/nusers\n"), []string{">/nusers>0>/nusers requires you to be logged"}},
 		{"Fail User List Test", []byte("/users\n"), []string{">/users>0>/users requires you to be logged"}},
-		{"Login Help Test", []byte("/login\n"), []string{">/login>0>/login <account>"}},
-		{"Login Test", []byte(fmt.Sprintf("/login %s\n", username)), []string{fmt.Sprintf(">/login>0>you're now %s", username)}},
+		{"Login Help Test", []byte("/login\n"), []string{">/login>0>/login <account>[#secret]"}},
+		{"Login Test", []byte(fmt.Sprintf("/login %s\n", username)), []string{fmt.Sprintf(">/login>0>you're now %s", username), ">#main>!token>TOKEN"}},
 		{"Duplicate Login Test", []byte("/login @tester2\n"), []string{">/login>0>you're already logged in"}},
 		{"User Count Test", []byte("/nusers\n"), []string{">/nusers>0>1"}},
 		{"User List Test", []byte("/users\n"), []string{">/users>0>@tester"}},
-		{"Channel Join Help Test", []byte("/join\n"), []string{">/join>0>/join <#channel>"}},
+		{"Channel Join Help Test", []byte("/join\n"), []string{">/join>0>/join <#channel> [key]"}},
 		{"Channel Join Test", []byte(fmt.Sprintf("/join %s\n", chan1)), []string{fmt.Sprintf(">/join>0>%s joined %s", username, chan1)}},
 		{"Channel Say Test", []byte(fmt.Sprintf("/say %s hello\n", chan1)), []string{fmt.Sprintf(">%s>%s>hello", chan1, username)}},
 		{"Channel Say Test #2", []byte(fmt.Sprintf("/say %s goodbye\n", chan1)), []string{fmt.Sprintf(">%s>%s>goodbye", chan1, username)}},
@@ -105,3 +106,49 @@ func fullRead(buff *bufio.Reader, conn net.Conn, c chan []string) {
 	}
 	c <- s
 }
+
+func TestNick(t *testing.T) {
+	// configure test server
+	init_logger()
+	init_commands()
+	gentoken = func() string { return "TOKEN" }
+	main_channel := NewChannelMain("#main")
+	CHANNELS.Store(main_channel.Key(), main_channel)
+
+	_, out1, in1 := genClient()
+	_, out2, in2 := genClient()
+
+	out1.Write([]byte("/nick @early\n"))
+	expectLines(t, "Nick Before Login", in1, out1, ">/nick>0>/nick requires you to be logged")
+
+	out1.Write([]byte("/login @alice\n"))
+	expectLines(t, "Login", in1, out1, ">/login>0>you're now @alice", ">#main>!token>TOKEN")
+	expectLines(t, "Login Notice", in2, out2, ">#main>!login>@alice has joined the server")
+
+	out2.Write([]byte("/login @bob\n"))
+	expectLines(t, "Login #2", in2, out2, ">/login>0>you're now @bob", ">#main>!token>TOKEN")
+	expectLines(t, "Login Notice #2", in1, out1, ">#main>!login>@bob has joined the server")
+
+	out1.Write([]byte("/nick @bob\n"))
+	expectLines(t, "Nick Taken", in1, out1, ">/nick>0>@bob is already taken, please select another @name")
+
+	out1.Write([]byte("/nick alice\n"))
+	expectLines(t, "Nick Invalid", in1, out1, ">/nick>0>alice is not a valid username because username must start with '@'")
+
+	out1.Write([]byte("/nick @carol\n"))
+	expectLines(t, "Nick", in1, out1, ">/nick>0>you're now @carol", ">#main>!nick>@alice @carol")
+	expectLines(t, "Nick Notice", in2, out2, ">#main>!nick>@alice @carol")
+
+	if _, ok := CLIENTS.Load("@alice"); ok {
+		t.Errorf("Nick left @alice in CLIENTS")
+	}
+
+	out2.Write([]byte("/users #main\n"))
+	expectLines(t, "Users After Nick", in2, out2, ">/users #main>1>@bob", ">/users #main>0>@carol")
+
+	out1.Write([]byte("/logoff\n"))
+	expectLines(t, "Logoff", in1, out1, ">/logoff>0>Goodbye @carol")
+
+	out2.Write([]byte("/logoff\n"))
+	expectLines(t, "Logoff #2", in2, out2, ">#main>!logoff>@carol is leaving", ">/logoff>0>Goodbye @bob")
+}
@@ -0,0 +1,473 @@
+package main
+
+/*
+cherryload puts a running cherry server under load, or checks that its replies
+follow the protocol described in the README.
+
+	cherryload -addr localhost:1512 -clients 200 -channels 4 -rate 0.5 -duration 1m
+	cherryload -addr localhost:1512 -conformance
+
+In load mode every client logs in, joins one of the channels and says a line
+every 1/rate seconds. The server sends every line back to whoever said it, so
+the time until it comes back is the latency. Every line received is checked
+against the protocol in both modes.
+*/
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"math/rand"
+	"net"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	MAXLINE      = 255             // chars in a line, including EOL
+	DIAL_TIMEOUT = 5 * time.Second // to connect to the server
+	STEP_TIMEOUT = 5 * time.Second // to get the reply to a command
+	GRACE        = 2 * time.Second // to get the lines still on their way after the test
+)
+
+// the protocol, as in the README
+var (
+	LINE_REPLY   = regexp.MustCompile(`^>/([A-Za-z][A-Za-z0-9]{0,15}(?: [^>]+)?)>([0-9]+)>`)
+	LINE_CHANNEL = regexp.MustCompile(`^>#[A-Za-z][A-Za-z0-9]{0,14}>(!|[*-]?@)[A-Za-z][A-Za-z0-9]{0,14}>`)
+	LINE_PRIVATE = regexp.MustCompile(`^>@[A-Za-z][A-Za-z0-9]{0,14}>@[A-Za-z][A-Za-z0-9]{0,14}>`)
+)
+
+// check a line (without EOL) follows the protocol
+func checkLine(line string) error {
+
+	if len(line)+1 > MAXLINE {
+		return fmt.Errorf("line longer than %d chars: %s", MAXLINE, line)
+	}
+
+	if LINE_REPLY.MatchString(line) || LINE_CHANNEL.MatchString(line) || LINE_PRIVATE.MatchString(line) {
+		return nil
+	}
+
+	return fmt.Errorf("line doesn't follow the protocol: %s", line)
+}
+
+// check multiline replies count down to 0, i.e. >/users>2> >/users>1> >/users>0>
+// Replies to a command with arguments (>/users #chan>2>) count on their own.
+type replyCounter map[string]int
+
+func (counter replyCounter) check(line string) error {
+
+	match := LINE_REPLY.FindStringSubmatch(line)
+
+	if match == nil {
+		return nil
+	}
+
+	command := match[1]
+	num, _ := strconv.Atoi(match[2])
+
+	expected, ok := counter[command]
+
+	if ok && num != expected {
+		delete(counter, command)
+		return fmt.Errorf("/%s sent %d after %d", command, num, expected+1)
+	}
+
+	if num == 0 {
+		delete(counter, command)
+	} else {
+		counter[command] = num - 1
+	}
+
+	return nil
+}
+
+type results struct {
+	sync.Mutex
+	latencies []time.Duration
+	logged    int
+	sent      int
+	echoed    int
+	invalid   int
+	errors    map[string]int
+}
+
+func (r *results) fail(format string, args ...interface{}) {
+	r.Lock()
+	defer r.Unlock()
+
+	r.errors[fmt.Sprintf(format, args...)]++
+}
+
+// a simulated user
+type loadClient struct {
+	name    string
+	channel string
+	conn    net.Conn
+	control chan string          // lines received while logging in and joining
+	pending map[string]time.Time // lines said and not back yet
+	setup   bool                 // still logging in and joining
+	sync.Mutex
+}
+
+func (clt *loadClient) send(line string) error {
+	_, err := clt.conn.Write([]byte(line + "\n"))
+	return err
+}
+
+// read lines from the server until the connection is closed
+func (clt *loadClient) readLoop(res *results) {
+
+	reader := bufio.NewReader(clt.conn)
+	counter := replyCounter{}
+	echo := ">" + clt.channel + ">" + clt.name + ">load "
+
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return
+		}
+
+		line = strings.TrimRight(line, "\r\n")
+
+		if err := checkLine(line); err != nil {
+			res.Lock()
+			res.invalid++
+			res.Unlock()
+			res.fail("%s", err)
+		}
+
+		if err := counter.check(line); err != nil {
+			res.fail("%s", err)
+		}
+
+		clt.Lock()
+
+		if strings.HasPrefix(line, echo) {
+			seq := strings.TrimPrefix(line, echo)
+
+			if sent, ok := clt.pending[seq]; ok {
+				delete(clt.pending, seq)
+				clt.Unlock()
+
+				res.Lock()
+				res.echoed++
+				res.latencies = append(res.latencies, time.Since(sent))
+				res.Unlock()
+
+				continue
+			}
+		}
+
+		if clt.setup {
+			select {
+			case clt.control <- line:
+			default: // nobody is waiting for so many lines
+			}
+		}
+
+		clt.Unlock()
+	}
+}
+
+// wait for a line starting with any of the prefixes
+func (clt *loadClient) expect(timeout time.Duration, prefixes ...string) bool {
+
+	deadline := time.After(timeout)
+
+	for {
+		select {
+		case line := <-clt.control:
+			for _, prefix := range prefixes {
+				if strings.HasPrefix(line, prefix) {
+					return true
+				}
+			}
+		case <-deadline:
+			return false
+		}
+	}
+}
+
+// log in, join and talk until stop
+func runClient(addr string, name string, channel string, rate float64, stop <-chan struct{}, res *results, wg *sync.WaitGroup) {
+	defer wg.Done()
+
+	conn, err := net.DialTimeout("tcp", addr, DIAL_TIMEOUT)
+	if err != nil {
+		res.fail("unable to connect: %s", err)
+		return
+	}
+	defer conn.Close()
+
+	clt := &loadClient{
+		name:    name,
+		channel: channel,
+		conn:    conn,
+		control: make(chan string, 64),
+		pending: map[string]time.Time{},
+		setup:   true,
+	}
+
+	go clt.readLoop(res)
+
+	clt.send("/login " + name)
+
+	if !clt.expect(STEP_TIMEOUT, ">/login>0>you're now "+name) {
+		res.fail("unable to login")
+		return
+	}
+
+	clt.send("/join " + channel)
+
+	if !clt.expect(STEP_TIMEOUT, ">/join>0>", ">"+channel+">"+name+">joined") {
+		res.fail("unable to join")
+		return
+	}
+
+	clt.Lock()
+	clt.setup = false
+	clt.Unlock()
+
+	res.Lock()
+	res.logged++
+	res.Unlock()
+
+	interval := time.Duration(float64(time.Second) / rate)
+
+	time.Sleep(time.Duration(rand.Int63n(int64(interval)))) // don't talk all at once
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for seq := 0; ; seq++ {
+		id := strconv.Itoa(seq)
+
+		clt.Lock()
+		clt.pending[id] = time.Now()
+		clt.Unlock()
+
+		if err := clt.send("/say " + channel + " load " + id); err != nil {
+			res.fail("unable to write: %s", err)
+			return
+		}
+
+		res.Lock()
+		res.sent++
+		res.Unlock()
+
+		select {
+		case <-ticker.C:
+		case <-stop:
+			time.Sleep(GRACE)
+			clt.send("/logoff")
+			return
+		}
+	}
+}
+
+func percentile(sorted []time.Duration, p float64) time.Duration {
+
+	if len(sorted) == 0 {
+		return 0
+	}
+
+	return sorted[int(float64(len(sorted)-1)*p)]
+}
+
+func load(addr string, clients int, channels int, rate float64, duration time.Duration, ramp time.Duration, prefix string) bool {
+
+	res := &results{errors: map[string]int{}}
+	stop := make(chan struct{})
+
+	var wg sync.WaitGroup
+
+	start := time.Now()
+
+	for i := 0; i < clients; i++ {
+		wg.Add(1)
+
+		name := fmt.Sprintf("%s%d", prefix, i)
+		channel := fmt.Sprintf("#load%d", i%channels)
+
+		go runClient(addr, name, channel, rate, stop, res, &wg)
+
+		time.Sleep(ramp / time.Duration(clients))
+	}
+
+	time.Sleep(duration - time.Since(start))
+	close(stop)
+	wg.Wait()
+
+	res.Lock()
+	defer res.Unlock()
+
+	sort.Slice(res.latencies, func(i, j int) bool { return res.latencies[i] < res.latencies[j] })
+
+	fmt.Printf("clients   %d (%d logged in)\n", clients, res.logged)
+	fmt.Printf("lines     %d said, %d back, %d lost\n", res.sent, res.echoed, res.sent-res.echoed)
+	fmt.Printf("latency   p50 %s p90 %s p99 %s max %s\n",
+		percentile(res.latencies, 0.50), percentile(res.latencies, 0.90),
+		percentile(res.latencies, 0.99), percentile(res.latencies, 1))
+	fmt.Printf("invalid   %d lines\n", res.invalid)
+
+	for err, count := range res.errors {
+		fmt.Printf("error     %s (%d)\n", err, count)
+	}
+
+	return len(res.errors) == 0 && res.sent == res.echoed
+}
+
+// send every command and check the replies
+func conformance(addr string, prefix string) bool {
+
+	conn, err := net.DialTimeout("tcp", addr, DIAL_TIMEOUT)
+	if err != nil {
+		fmt.Printf("FAIL unable to connect: %s\n", err)
+		return false
+	}
+	defer conn.Close()
+
+	name := fmt.Sprintf("%s%d", prefix, rand.Intn(10000))
+	channel := fmt.Sprintf("#conf%d", rand.Intn(10000))
+
+	lines := make(chan string, 256)
+
+	go func() {
+		reader := bufio.NewReader(conn)
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				close(lines)
+				return
+			}
+			lines <- strings.TrimRight(line, "\r\n")
+		}
+	}()
+
+	steps := []struct {
+		send   string
+		expect []string // the step is done with a line starting with any of them (and num 0 for replies)
+	}{
+		{"/version", []string{">/version>"}},
+		{"/help", []string{">/help>"}},
+		{"/who", []string{">/who>"}},
+		{"/login " + name, []string{">/login>"}},
+		{"/who", []string{">/who>"}},
+		{"/users", []string{">/users>"}},
+		{"/nusers", []string{">/nusers>"}},
+		{"/list", []string{">/list>"}},
+		{"/join " + channel, []string{">/join>"}},
+		{"/users " + channel, []string{">/users>", ">/users " + channel + ">"}},
+		{"/nusers " + channel, []string{">/nusers>", ">/users " + channel + ">"}},
+		{"/mode " + channel, []string{">/mode>"}},
+		{"/topic " + channel, []string{">/topic>"}},
+		{"/say " + channel + " hello", []string{">" + channel + ">" + name + ">hello"}},
+		{"/me " + channel + " waves", []string{">" + channel + ">*" + name + ">waves"}},
+		{"/notice " + channel + " hello", []string{">" + channel + ">-" + name + ">hello"}},
+		{"/roll " + channel + " 2d6", []string{">" + channel + ">!roll>" + name + " 2d6: "}},
+		{"/msg " + name + " hello", []string{">" + name + ">" + name + ">hello"}},
+		{"/whois " + name, []string{">/whois>"}},
+		{"/ignore", []string{">/ignore>"}},
+		{"/links", []string{">/links>"}},
+		{"/uptime", []string{">/uptime>"}},
+		{"/clock", []string{">/clock>"}},
+		{"/leave " + channel, []string{">/leave>", ">" + channel + ">" + name + ">left"}},
+		{"/logoff", []string{">/logoff>"}},
+	}
+
+	passed := true
+	counter := replyCounter{}
+
+	for _, step := range steps {
+		conn.Write([]byte(step.send + "\n"))
+
+		var errors []string
+		done := false
+		timeout := time.After(STEP_TIMEOUT)
+
+		for !done {
+			select {
+			case line, ok := <-lines:
+				if !ok {
+					errors = append(errors, "connection closed")
+					done = true
+					break
+				}
+
+				if err := checkLine(line); err != nil {
+					errors = append(errors, err.Error())
+				}
+
+				if err := counter.check(line); err != nil {
+					errors = append(errors, err.Error())
+				}
+
+				for _, prefix := range step.expect {
+					if strings.HasPrefix(line, prefix) && (prefix[1] != '/' || strings.HasPrefix(line, prefix+"0>")) {
+						done = true
+					}
+				}
+			case <-timeout:
+				errors = append(errors, "no reply")
+				done = true
+			}
+		}
+
+		if len(errors) > 0 {
+			passed = false
+			fmt.Printf("FAIL %s: %s\n", step.send, strings.Join(errors, ", "))
+			continue
+		}
+
+		fmt.Printf("PASS %s\n", step.send)
+	}
+
+	return passed
+}
+
+func main() {
+
+	var addr string
+	var clients, channels int
+	var rate float64
+	var duration, ramp time.Duration
+	var prefix string
+	var conform bool
+
+	flag.StringVar(&addr, "addr", "localhost:1512", "<address:port> of the cherry server")
+	flag.IntVar(&clients, "clients", 10, "simulated users")
+	flag.IntVar(&channels, "channels", 1, "channels the users are spread in")
+	flag.Float64Var(&rate, "rate", 1, "lines per second said by every user")
+	flag.DurationVar(&duration, "duration", 30*time.Second, "length of the test")
+	flag.DurationVar(&ramp, "ramp", 5*time.Second, "time to connect all the users")
+	flag.StringVar(&prefix, "prefix", "@load", "prefix of the user names")
+	flag.BoolVar(&conform, "conformance", false, "check the replies to every command instead")
+	flag.Parse()
+
+	if len(prefix) < 2 || prefix[0] != '@' || len(prefix) > 10 {
+		fmt.Println("-prefix must start with @ and be 10 chars at most")
+		os.Exit(2)
+	}
+
+	if conform {
+		if !conformance(addr, prefix) {
+			os.Exit(1)
+		}
+		return
+	}
+
+	if clients < 1 || channels < 1 || rate <= 0 || ramp >= duration {
+		fmt.Println("-clients and -channels must be 1 or more, -rate more than 0 and -ramp shorter than -duration")
+		os.Exit(2)
+	}
+
+	if !load(addr, clients, channels, rate, duration, ramp, prefix) {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,58 @@
+package main
+
+import "testing"
+
+func TestCheckLine(t *testing.T) {
+
+	tests := []struct {
+		line  string
+		valid bool
+	}{
+		{">/users>2>@user3", true},
+		{">/users #main>1>@user3", true},
+		{">/users #main>>@user3", false},
+		{">/users >0>@user3", false},
+		{">/login>0>you're now @user", true},
+		{">#main>@user>hello > world", true},
+		{">#main>!welcome>welcome to cherry server", true},
+		{">@user>@other>psst", true},
+		{">#main>*@user>waves", true},
+		{">#main>-@user>brb", true},
+		{">#main>*!welcome>hi", false},
+		{">/users>x>@user3", false},
+		{">/1users>0>@user3", false},
+		{">main>@user>hello", false},
+		{">#main>user>hello", false},
+		{">#averyveryverylongname>@user>hello", false},
+		{"hello", false},
+	}
+
+	for _, test := range tests {
+		if err := checkLine(test.line); (err == nil) != test.valid {
+			t.Errorf("checkLine(%s) = %v", test.line, err)
+		}
+	}
+}
+
+func TestReplyCounter(t *testing.T) {
+
+	counter := replyCounter{}
+
+	for _, line := range []string{">/users>2>@a", ">/users>1>@b", ">/users>0>@c", ">/who>0>@a", ">#main>@a>hi"} {
+		if err := counter.check(line); err != nil {
+			t.Fatalf("check(%s) = %s", line, err)
+		}
+	}
+
+	for _, line := range []string{">/users #a>1>@a", ">/users>1>@b", ">/users #a>0>@c", ">/users>0>@d"} {
+		if err := counter.check(line); err != nil {
+			t.Fatalf("check(%s) = %s", line, err)
+		}
+	}
+
+	counter.check(">/list>3>#a")
+
+	if err := counter.check(">/list>1>#b"); err == nil {
+		t.Fatalf("check() didn't notice a missing line")
+	}
+}
@@ -3,6 +3,8 @@ package main
 import (
 	"runtime"
 	"sort"
+	"strings"
+	"time"
 )
 
 func init_commands() {
@@ -21,22 +23,61 @@ func init_commands() {
 	COMMANDS["leave"] = do_leave
 	COMMANDS["list"] = do_list
 	COMMANDS["license"] = do_license
+	COMMANDS["links"] = do_links
+	COMMANDS["resume"] = do_resume
+	COMMANDS["proto"] = do_proto
+	COMMANDS["nick"] = do_nick
+	COMMANDS["mode"] = do_mode
+	COMMANDS["msg"] = do_msg
+	COMMANDS["ignore"] = do_ignore
+	COMMANDS["unignore"] = do_unignore
+	COMMANDS["topic"] = do_topic
+	COMMANDS["bans"] = do_bans
+	COMMANDS["register"] = do_register
+	COMMANDS["unregister"] = do_unregister
+	COMMANDS["whois"] = do_whois
+	COMMANDS["ipban"] = do_ipban
+	COMMANDS["ipunban"] = do_ipunban
+	COMMANDS["me"] = do_me
+	COMMANDS["notice"] = do_notice
+	COMMANDS["roll"] = do_roll
 }
 
 func do_help(clt *Client, args string) {
 
 	clt.SayN(">/help>",
 		[]string{"/login <nick> - login to cherry server",
+			"/login <nick#secret>       - login with a tripcode",
+			"/resume <token>            - resume a lost session",
 			"/who                       - show my nickname",
+			"/whois <@user>             - show a user with their tripcode",
+			"/nick <@newname>           - change my nickname",
 			"/help                      - this command",
 			"/users                     - who is logged?",
 			"/users <#channel>          - who is in this channel?",
 			"/nusers                    - number of users",
 			"/nusers <#channel>         - number of users in channel",
+			"/msg <@user> <text>        - talk privately to a user",
+			"/me <#channel> <action>    - act in a channel",
+			"/notice <#channel> <text>  - notice that is never answered",
+			"/roll <#channel> [NdM]     - roll dice in a channel (1d6)",
+			"/ignore                    - show who I'm ignoring",
+			"/ignore <@user>            - stop receiving lines from a user",
+			"/unignore <@user>          - receive lines from a user again",
 			"/list                      - show available public channels",
 			"/hlist                     - show available hidden channels",
-			"/join <#channel>           - join/create a channel",
+			"/join <#channel> [key]     - join/create a channel",
 			"/hjoin <#channel>          - join/create hidden channel",
+			"/links                     - show linked servers",
+			"/proto <text|bin>          - switch protocol",
+			"/mode <#channel>           - show channel modes",
+			"/mode <#channel> +|-<amnovbqkfw> [@user|!trip|key|policy] - change channel modes (ops)",
+			"/topic <#channel> [text]   - show/change the channel topic",
+			"/bans <#channel>           - show who is banned from a channel",
+			"/register <#channel>       - keep the channel across restarts (owner)",
+			"/unregister <#channel>     - stop keeping the channel (owner)",
+			"/ipban [address|net] [why] - show/ban addresses (sysops)",
+			"/ipunban <address|net>     - remove an address ban (sysops)",
 			"/license                   - view license agreement",
 			"/logoff                    - logoff"})
 
@@ -145,19 +186,54 @@ func do_say(clt *Client, args string) {
 
 	channelName, message := split2(args, " ")
 
-	channel, ok := CHANNELS.Load(channelName)
-
+	channel, ok := clt.writableChannel("say", channelName)
 	if !ok {
-		clt.Say(">/say>0>%s is not a valid channel", channelName)
 		return
 	}
 
-	if !channel.contains(clt) {
-		clt.Say(">/say>0>you must /join %s before you can write", channel.Name)
+	if message, ok = channel.check(clt, "say", message); ok {
+		channel.Say(clt, "%s", message)
+	}
+}
+
+// talk privately to another logged user
+func do_msg(clt *Client, args string) {
+
+	if !clt.isLogged() {
+		clt.Say(">/msg>0>/msg requires you to be logged")
+
+		return
+	}
+
+	name, message := split2(args, " ")
+
+	if no(name) || no(message) {
+		clt.Say(">/msg>0>/msg <@user> <text>")
+
 		return
 	}
 
-	channel.Say(clt, "%s", message)
+	target, ok := CLIENTS.Load(name)
+
+	if !ok || !target.isLogged() {
+		clt.Say(">/msg>0>%s is not logged", name)
+		return
+	}
+
+	if clt.isMuted() {
+		clt.Say(">/msg>0>you have been muted by the word filter")
+		return
+	}
+
+	if message, ok = clt.check(message); !ok {
+		return
+	}
+
+	if target != clt {
+		target.privateSay(clt, message)
+	}
+
+	clt.Say(">%s>%s>%s", target, clt, message)
 }
 
 // update login levels. Unused for now
@@ -167,7 +243,7 @@ func sys_log(clt *Client, args string) {
 		status := []string{INFO.String(),
 			WARN.String(), ERROR.String(),
 			LOGGER.String(),
-			DEBUG.String(), LOGGER.String()}
+			DEBUG.String(), MODERATION.String(), LOGGER.String()}
 
 		clt.SayN(">/log>", status)
 
@@ -252,24 +328,40 @@ func do_login(clt *Client, args string) {
 	}
 
 	if no(args) {
-		clt.Say(">/login>0>/login <account>")
+		clt.Say(">/login>0>/login <account>[#secret]")
 
 		return
 	}
 
-	username, err := ValidUsername(args)
+	name, secret := splitPrivKey(args)
+
+	username, err := ValidUsername(name)
 
 	if err != nil {
-		clt.Say(">/login>0>%s is not a valid username because %s", args, err.Error())
-		WARN.Printf("user %s unable to login due to: %s", args, err.Error())
+		clt.Say(">/login>0>%s is not a valid username because %s", name, err.Error())
+		WARN.Printf("user %s unable to login due to: %s", name, err.Error())
 
 		return
 	}
 
-	_, ok := CLIENTS.Load(username)
+	trip := ""
 
-	if ok {
-		clt.Say(">/login>0>%s is already taken, please select another @name", username)
+	if strings.Contains(args, "#") {
+		if len(TRIPKEY) == 0 {
+			clt.Say(">/login>0>tripcodes are not enabled in this server")
+			return
+		}
+
+		if no(secret) {
+			clt.Say(">/login>0>/login <account>[#secret]")
+			return
+		}
+
+		trip = generateTrip(secret, TRIPKEY)
+	}
+
+	if len(trip) == 0 && !clt.anonAllowed() {
+		clt.Say(">/login>0>this server requires /login <account>#secret")
 		return
 	}
 
@@ -277,10 +369,15 @@ func do_login(clt *Client, args string) {
 
 	oldName := clt.Name
 
-	clt.Name = username
+	if err := clt.rename(username); err != nil {
+		clt.Say(">/login>0>%s is already taken, please select another @name", username)
+		return
+	}
+
+	clt.trip = trip
+	clt.restoreIgnored()
+	clt.loggedOn = time.Now()
 	clt.Status.Store(USER_LOGGED)
-	CLIENTS.Store(clt.Name, clt)
-	CLIENTS.Delete(oldName)
 
 	mainChannel, _ := CHANNELS.Load("#main")
 
@@ -289,7 +386,9 @@ func do_login(clt *Client, args string) {
 	/* Update player */
 
 	clt.Say(">/login>0>you're now %s", clt)
+	clt.issueToken()
 	clt.UpdateInMain(">!login>%s has joined the server", clt)
+	linkBroadcast("%s", clt.userLine())
 
 	INFO.Printf("%s has logged in as %s", oldName, clt)
 }
@@ -324,18 +423,44 @@ func do_join(clt *Client, args string) {
 	}
 
 	if no(args) {
-		clt.Say(">/join>0>/join <#channel>")
+		clt.Say(">/join>0>/join <#channel> [key]")
 
 		return
 	}
 
-	channelName, _ := split2(args, " ")
+	channelName, key := split2(args, " ")
 
 	channel, ok := CHANNELS.Load(channelName)
 
 	if ok {
+		if channel.isBanned(clt) {
+			clt.Say(">/join>0>you are banned from %s", channel)
+			return
+		}
+
+		if !channel.isAllowed(clt) {
+			clt.Say(">/join>0>only allowed tripcodes can join %s", channel)
+			return
+		}
+
+		if !channel.keyMatches(key) {
+			clt.Say(">/join>0>%s requires a key, /join %s <key>", channel, channel)
+			return
+		}
+
 		if channel.addClient(clt) {
-			channel.Say(clt, "joined the channel")
+			channel.linkJoin(clt)
+			channel.restoreModes(clt)
+
+			if channel.showEvents() {
+				channel.Say(clt, "joined the channel")
+			} else {
+				clt.Say(">/join>0>%s joined %s", clt, channel)
+			}
+
+			if topic := channel.getTopic(); len(topic) > 0 {
+				clt.Say(">/topic>0>%s %s", channel, topic)
+			}
 			return
 		}
 
@@ -344,21 +469,24 @@ func do_join(clt *Client, args string) {
 		return
 	}
 
-	channelName, err := ValidChannelname(args)
+	validName, err := ValidChannelname(channelName)
 
 	if err != nil {
-		clt.Say(">/join>0>%s is not a valid channelname because %s", args, err.Error())
-		WARN.Printf("user %s unable to create channel %s due to: %s", clt, args, err.Error())
+		clt.Say(">/join>0>%s is not a valid channelname because %s", channelName, err.Error())
+		WARN.Printf("user %s unable to create channel %s due to: %s", clt, channelName, err.Error())
 
 		return
 	}
 
-	NewChannel := newChannel(channelName, false)
+	NewChannel := newChannel(validName, false)
 	NewChannel.addClient(clt)
 
 	CHANNELS.Store(NewChannel.Key(), NewChannel)
 	DEBUG.Printf("adding %s to CHANNELS", NewChannel)
 
+	NewChannel.linkJoin(clt)
+	NewChannel.setCreator(clt)
+
 	clt.Say(">/join>0>%s joined %s", clt, NewChannel)
 }
 
@@ -371,18 +499,44 @@ func do_hjoin(clt *Client, args string) {
 	}
 
 	if no(args) {
-		clt.Say(">/hjoin>0>/hjoin <#channel>")
+		clt.Say(">/hjoin>0>/hjoin <#channel> [key]")
 
 		return
 	}
 
-	channelName, _ := split2(args, " ")
+	channelName, key := split2(args, " ")
 
 	channel, ok := CHANNELS.Load(channelName)
 
 	if ok {
+		if channel.isBanned(clt) {
+			clt.Say(">/hjoin>0>you are banned from %s", channel)
+			return
+		}
+
+		if !channel.isAllowed(clt) {
+			clt.Say(">/hjoin>0>only allowed tripcodes can join %s", channel)
+			return
+		}
+
+		if !channel.keyMatches(key) {
+			clt.Say(">/hjoin>0>%s requires a key, /hjoin %s <key>", channel, channel)
+			return
+		}
+
 		if channel.addClient(clt) {
-			channel.Say(clt, "hjoined the channel")
+			channel.linkJoin(clt)
+			channel.restoreModes(clt)
+
+			if channel.showEvents() {
+				channel.Say(clt, "hjoined the channel")
+			} else {
+				clt.Say(">/hjoin>0>%s hjoined %s", clt, channel)
+			}
+
+			if topic := channel.getTopic(); len(topic) > 0 {
+				clt.Say(">/topic>0>%s %s", channel, topic)
+			}
 			return
 		}
 
@@ -391,21 +545,23 @@ func do_hjoin(clt *Client, args string) {
 		return
 	}
 
-	channelName, err := ValidChannelname(args)
+	validName, err := ValidChannelname(channelName)
 
 	if err != nil {
-		clt.Say(">/hjoin>0>%s is not a valid channelname because %s", args, err.Error())
-		WARN.Printf("user %s unable to create hchannel %s  due to: %s", clt, args, err.Error())
+		clt.Say(">/hjoin>0>%s is not a valid channelname because %s", channelName, err.Error())
+		WARN.Printf("user %s unable to create hchannel %s  due to: %s", clt, channelName, err.Error())
 
 		return
 	}
 
-	NewChannel := newChannel(channelName, true)
+	NewChannel := newChannel(validName, true)
 	NewChannel.addClient(clt)
 
 	CHANNELS.Store(NewChannel.Key(), NewChannel)
 	DEBUG.Printf("adding %s to CHANNELS", NewChannel)
 
+	NewChannel.setCreator(clt)
+
 	clt.Say(">/hjoin>0>%s hjoined %s", clt, NewChannel)
 
 }
@@ -435,8 +591,14 @@ func do_leave(clt *Client, args string) {
 			return
 		}
 
-		channel.Say(clt, "left the channel")
+		if channel.showEvents() {
+			channel.Say(clt, "left the channel")
+		} else {
+			clt.Say(">/leave>0>%s left %s", clt, channel)
+		}
+
 		channel.removeClient(clt)
+		channel.linkPart(clt)
 
 		return
 	}
@@ -470,3 +632,115 @@ func do_list(clt *Client, args string) {
 
 	clt.SayN(">/list>", out)
 }
+
+// show or change the topic of a channel
+func do_topic(clt *Client, args string) {
+
+	if !clt.isLogged() {
+		clt.Say(">/topic>0>/topic requires you to be logged")
+
+		return
+	}
+
+	if no(args) {
+		clt.Say(">/topic>0>/topic <#channel> [text]")
+
+		return
+	}
+
+	channelName, topic := split2(args, " ")
+
+	channel, ok := CHANNELS.Load(channelName)
+
+	if !ok {
+		clt.Say(">/topic>0>%s is not a valid channel", channelName)
+		return
+	}
+
+	if no(topic) {
+		if topic = channel.getTopic(); len(topic) == 0 {
+			clt.Say(">/topic>0>%s has no topic", channel)
+			return
+		}
+
+		clt.Say(">/topic>0>%s %s", channel, topic)
+		return
+	}
+
+	if !channel.isOp(clt.Name) {
+		clt.Say(">/topic>0>you must be an operator of %s to change its topic", channel)
+		return
+	}
+
+	channel.setTopic(topic)
+
+	if channel.linked {
+		linkBroadcast("TOPIC %s %s %s", channel, clt, topic)
+	}
+
+	channel.write(clt, ">"+channel.Name+">!topic>"+clt.Name+" "+topic+"\n")
+
+	INFO.Printf("%s set the topic of %s", clt, channel)
+}
+
+// show peer servers currently linked
+func do_links(clt *Client, args string) {
+
+	if !clt.isLogged() {
+		clt.Say(">/links>0>/links requires you to be logged")
+
+		return
+	}
+
+	out := []string{SERVERNAME + " (this server)"}
+
+	print_key := func(key string, link *Link) bool {
+		out = append(out, key)
+		return true
+	}
+
+	LINKS.Range(print_key)
+
+	sort.Strings(out[1:])
+
+	clt.SayN(">/links>", out)
+}
+
+// change the name of a logged user
+func do_nick(clt *Client, args string) {
+
+	if !clt.isLogged() {
+		clt.Say(">/nick>0>/nick requires you to be logged")
+
+		return
+	}
+
+	if no(args) {
+		clt.Say(">/nick>0>/nick <@newname>")
+
+		return
+	}
+
+	newName, _ := split2(args, " ")
+
+	username, err := ValidUsername(newName)
+
+	if err != nil {
+		clt.Say(">/nick>0>%s is not a valid username because %s", newName, err.Error())
+
+		return
+	}
+
+	oldName := clt.Name
+
+	if err := clt.rename(username); err != nil {
+		clt.Say(">/nick>0>%s is already taken, please select another @name", username)
+		return
+	}
+
+	clt.Say(">/nick>0>you're now %s", clt)
+	clt.nickChanged(oldName)
+	linkBroadcast("NICK %s %s", oldName, clt)
+
+	INFO.Printf("%s is now known as %s", oldName, clt)
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"crypto/rand"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// Actions, notices and dice.
+//
+// They are said in a channel like /say, and just as /say they need the user to
+// be able to speak there, go through the word filter and are not heard by the
+// users that ignore the sender. The sender is marked so clients can show them
+// their own way:
+//
+//	/me #games waves		>#games>*@user>waves
+//	/notice #games server restart	>#games>-@user>server restart
+//	/roll #games 2d6		>#games>!roll>@user 2d6: 4 1 = 5
+//
+// Notices must never be answered automatically (i.e. by bots). Dice are rolled
+// by the server, so nobody can fake a roll.
+
+const (
+	LINE_SAY    = ""  // >#channel>@user>text
+	LINE_ACTION = "*" // >#channel>*@user>text
+	LINE_NOTICE = "-" // >#channel>-@user>text
+
+	MAX_DICE  = 10   // dice in a single roll
+	MAX_SIDES = 1000 // sides of a die
+)
+
+// link verb of every kind of line
+var LINEVERBS = map[string]string{
+	LINE_SAY:    "MSG",
+	LINE_ACTION: "ACTION",
+	LINE_NOTICE: "NOTICE",
+}
+
+// roll a die of sides, from 1 to sides
+var rolldie = func(sides int) int {
+	n, err := rand.Int(rand.Reader, big.NewInt(int64(sides)))
+	if err != nil {
+		return 1
+	}
+
+	return int(n.Int64()) + 1
+}
+
+// find the channel clt wants to write to with /command, telling them why if
+// they can't
+func (clt *Client) writableChannel(command string, channelName string) (*Channel, bool) {
+
+	channel, ok := CHANNELS.Load(channelName)
+
+	if !ok {
+		clt.Say(">/%s>0>%s is not a valid channel", command, channelName)
+		return nil, false
+	}
+
+	if !channel.contains(clt) {
+		clt.Say(">/%s>0>you must /join %s before you can write", command, channel.Name)
+		return nil, false
+	}
+
+	if !channel.canSpeak(clt) {
+		if channel.isMuted(clt) {
+			clt.Say(">/%s>0>you have been muted in %s", command, channel.Name)
+			return nil, false
+		}
+
+		if channel.hasMode(MODE_ANNOUNCE) {
+			clt.Say(">/%s>0>%s is announce only, only operators can write", command, channel.Name)
+			return nil, false
+		}
+
+		clt.Say(">/%s>0>%s is moderated, only operators and voiced users can write", command, channel.Name)
+		return nil, false
+	}
+
+	return channel, true
+}
+
+// say text in the channel as a kind of line
+func (clt *Client) sayAs(kind string, command string, args string) {
+
+	channelName, message := split2(args, " ")
+
+	if no(channelName) || no(message) {
+		clt.Say(">/%s>0>/%s <#channel> <text>", command, command)
+		return
+	}
+
+	channel, ok := clt.writableChannel(command, channelName)
+	if !ok {
+		return
+	}
+
+	if message, ok = channel.check(clt, command, message); ok {
+		channel.sayAs(kind, clt, message)
+	}
+}
+
+// /me #channel action
+func do_me(clt *Client, args string) {
+	clt.sayAs(LINE_ACTION, "me", args)
+}
+
+// /notice #channel text
+func do_notice(clt *Client, args string) {
+	clt.sayAs(LINE_NOTICE, "notice", args)
+}
+
+// parse NdM (or dM, N dice of M sides)
+func parseDice(dice string) (int, int, bool) {
+
+	count, sides, found := strings.Cut(strings.ToLower(dice), "d")
+
+	if !found {
+		return 0, 0, false
+	}
+
+	if no(count) {
+		count = "1"
+	}
+
+	n, err := strconv.Atoi(count)
+	if err != nil || n < 1 || n > MAX_DICE {
+		return 0, 0, false
+	}
+
+	m, err := strconv.Atoi(sides)
+	if err != nil || m < 2 || m > MAX_SIDES {
+		return 0, 0, false
+	}
+
+	return n, m, true
+}
+
+// /roll #channel [NdM], 1d6 by default
+func do_roll(clt *Client, args string) {
+
+	channelName, dice := split2(args, " ")
+	dice = trim(dice)
+
+	if no(channelName) {
+		clt.Say(">/roll>0>/roll <#channel> [NdM]")
+		return
+	}
+
+	if no(dice) {
+		dice = "1d6"
+	}
+
+	n, m, ok := parseDice(dice)
+
+	if !ok {
+		clt.Say(">/roll>0>/roll <#channel> [NdM], up to %dd%d", MAX_DICE, MAX_SIDES)
+		return
+	}
+
+	channel, ok := clt.writableChannel("roll", channelName)
+	if !ok {
+		return
+	}
+
+	rolls := make([]string, n)
+	total := 0
+
+	for i := range rolls {
+		roll := rolldie(m)
+		rolls[i] = strconv.Itoa(roll)
+		total += roll
+	}
+
+	result := fmt.Sprintf("%dd%d: %s = %d", n, m, strings.Join(rolls, " "), total)
+
+	channel.roll(clt, result)
+}
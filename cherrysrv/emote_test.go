@@ -0,0 +1,149 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseDice(t *testing.T) {
+
+	tests := []struct {
+		dice  string
+		count int
+		sides int
+		ok    bool
+	}{
+		{"2d6", 2, 6, true},
+		{"d20", 1, 20, true},
+		{"3D8", 3, 8, true},
+		{"10d1000", 10, 1000, true},
+		{"11d6", 0, 0, false},
+		{"0d6", 0, 0, false},
+		{"1d1", 0, 0, false},
+		{"2d", 0, 0, false},
+		{"6", 0, 0, false},
+		{"xdy", 0, 0, false},
+	}
+
+	for _, test := range tests {
+		count, sides, ok := parseDice(test.dice)
+
+		if ok != test.ok || count != test.count || sides != test.sides {
+			t.Errorf("parseDice(%s) = %d, %d, %v", test.dice, count, sides, ok)
+		}
+	}
+}
+
+func TestEmote(t *testing.T) {
+	// configure test server
+	init_logger()
+	init_commands()
+	gentoken = func() string { return "TOKEN" }
+	main_channel := NewChannelMain("#main")
+	CHANNELS.Store(main_channel.Key(), main_channel)
+
+	words := filepath.Join(t.TempDir(), "words.txt")
+	os.WriteFile(words, []byte("darn\n"), 0600)
+
+	if err := init_filter(words); err != nil {
+		t.Fatalf("init_filter() failed with %s", err)
+	}
+	defer func() { FILTERWORDS = nil }()
+
+	sides := []int{}
+	defer func(roll func(int) int) { rolldie = roll }(rolldie)
+	rolldie = func(n int) int { sides = append(sides, n); return len(sides) }
+
+	_, out1, in1 := genClient()
+	_, out2, in2 := genClient()
+
+	out1.Write([]byte("/login @op\n"))
+	expectLines(t, "Login", in1, out1, ">/login>0>you're now @op", ">#main>!token>TOKEN")
+	expectLines(t, "Login Notice", in2, out2, ">#main>!login>@op has joined the server")
+
+	out2.Write([]byte("/login @user\n"))
+	expectLines(t, "Login #2", in2, out2, ">/login>0>you're now @user", ">#main>!token>TOKEN")
+	expectLines(t, "Login Notice #2", in1, out1, ">#main>!login>@user has joined the server")
+
+	out1.Write([]byte("/join #party\n"))
+	expectLines(t, "Create Channel", in1, out1, ">/join>0>@op joined #party")
+
+	out2.Write([]byte("/me #party waves\n"))
+	expectLines(t, "Action Not Joined", in2, out2, ">/me>0>you must /join #party before you can write")
+
+	out2.Write([]byte("/join #party\n"))
+	expectLines(t, "Join", in2, out2, ">#party>@user>joined the channel")
+	expectLines(t, "Join Notice", in1, out1, ">#party>@user>joined the channel")
+
+	out2.Write([]byte("/me #party\n"))
+	expectLines(t, "Action Usage", in2, out2, ">/me>0>/me <#channel> <text>")
+
+	out2.Write([]byte("/me #party waves\n"))
+	expectLines(t, "Action", in2, out2, ">#party>*@user>waves")
+	expectLines(t, "Action Notice", in1, out1, ">#party>*@user>waves")
+
+	out1.Write([]byte("/notice #party the server restarts at 10\n"))
+	expectLines(t, "Notice", in1, out1, ">#party>-@op>the server restarts at 10")
+	expectLines(t, "Notice Notice", in2, out2, ">#party>-@op>the server restarts at 10")
+
+	out2.Write([]byte("/roll #party 3d6\n"))
+	expectLines(t, "Roll", in2, out2, ">#party>!roll>@user 3d6: 1 2 3 = 6")
+	expectLines(t, "Roll Notice", in1, out1, ">#party>!roll>@user 3d6: 1 2 3 = 6")
+
+	if len(sides) != 3 || sides[0] != 6 {
+		t.Fatalf("rolled %v, expected 3 dice of 6 sides", sides)
+	}
+
+	sides = sides[:0]
+
+	out2.Write([]byte("/roll #party\n"))
+	expectLines(t, "Roll Default", in2, out2, ">#party>!roll>@user 1d6: 1 = 1")
+	expectLines(t, "Roll Default Notice", in1, out1, ">#party>!roll>@user 1d6: 1 = 1")
+
+	out2.Write([]byte("/roll #party 100d6\n"))
+	expectLines(t, "Roll Too Many", in2, out2, ">/roll>0>/roll <#channel> [NdM], up to 10d1000")
+
+	out2.Write([]byte("/me #party says darn\n"))
+	expectLines(t, "Action Masked", in2, out2, ">#party>*@user>says ****")
+	expectLines(t, "Action Masked Notice", in1, out1, ">#party>*@user>says ****")
+
+	out1.Write([]byte("/mode #party +f reject\n"))
+	expectLines(t, "Filter Reject", in1, out1, ">#party>!mode>@op +f reject")
+	expectLines(t, "Filter Reject Notice", in2, out2, ">#party>!mode>@op +f reject")
+
+	out2.Write([]byte("/notice #party darn\n"))
+	expectLines(t, "Notice Rejected", in2, out2, ">/notice>0>your line to #party was rejected by the word filter")
+
+	out1.Write([]byte("/ignore @user\n"))
+	expectLines(t, "Ignore", in1, out1, ">/ignore>0>ignoring @user")
+
+	sides = sides[:0]
+
+	out2.Write([]byte("/me #party dances\n"))
+	expectLines(t, "Action Ignored", in2, out2, ">#party>*@user>dances")
+	expectLines(t, "Action Not Heard", in1, out1)
+
+	out2.Write([]byte("/roll #party d20\n"))
+	expectLines(t, "Roll Ignored", in2, out2, ">#party>!roll>@user 1d20: 1 = 1")
+	expectLines(t, "Roll Not Heard", in1, out1)
+
+	out1.Write([]byte("/unignore @user\n"))
+	expectLines(t, "Unignore", in1, out1, ">/unignore>0>not ignoring @user anymore")
+
+	out1.Write([]byte("/mode #party +m\n"))
+	expectLines(t, "Moderated", in1, out1, ">#party>!mode>@op +m")
+	expectLines(t, "Moderated Notice", in2, out2, ">#party>!mode>@op +m")
+
+	out2.Write([]byte("/me #party waves\n"))
+	expectLines(t, "Moderated Action", in2, out2, ">/me>0>#party is moderated, only operators and voiced users can write")
+
+	out2.Write([]byte("/roll #party\n"))
+	expectLines(t, "Moderated Roll", in2, out2, ">/roll>0>#party is moderated, only operators and voiced users can write")
+
+	out1.Write([]byte("/logoff\n"))
+	expectLines(t, "Logoff", in1, out1, ">/logoff>0>Goodbye @op")
+
+	out2.Write([]byte("/logoff\n"))
+	expectLines(t, "Logoff #2", in2, out2, ">#main>!logoff>@op is leaving", ">/logoff>0>Goodbye @user")
+}
@@ -0,0 +1,248 @@
+package main
+
+import (
+	"bufio"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Word filter.
+//
+// The words (or /regular expressions/) in FILTERFILE are checked on every line
+// said in a channel and every private message. What happens to a line that
+// matches depends on the channel policy (+f, FILTERPOLICY by default):
+//
+//	off		nothing
+//	mask		the words are replaced by '*'
+//	reject		the line is not sent and the user is told
+//	mute[:N]	as reject, and after N hits the user is muted (+q)
+//
+// Private messages follow FILTERPOLICY, and muted users can't send them.
+// Every hit is logged to MODERATION for the sysops.
+
+const (
+	FILTER_OFF    = "off"
+	FILTER_MASK   = "mask"
+	FILTER_REJECT = "reject"
+	FILTER_MUTE   = "mute"
+)
+
+var (
+	FILTERFILE   = ""          // file with the filtered words, one per line
+	FILTERPOLICY = FILTER_MASK // policy of channels without +f and of private messages
+	FILTERMUTE   = 3           // hits before being muted with mute policies without :N
+	FILTERWORDS  []*regexp.Regexp
+)
+
+type filterPolicy struct {
+	action string // FILTER_OFF, FILTER_MASK, FILTER_REJECT or FILTER_MUTE
+	hits   int    // hits before being muted
+}
+
+// parse a policy like "reject" or "mute:5"
+func parsePolicy(policy string) (filterPolicy, bool) {
+
+	action, hits, found := strings.Cut(policy, ":")
+
+	switch action {
+	case FILTER_OFF, FILTER_MASK, FILTER_REJECT:
+		return filterPolicy{action: action}, !found
+	case FILTER_MUTE:
+		if !found {
+			return filterPolicy{action: action, hits: FILTERMUTE}, true
+		}
+
+		n, err := strconv.Atoi(hits)
+
+		return filterPolicy{action: action, hits: n}, err == nil && n > 0
+	}
+
+	return filterPolicy{}, false
+}
+
+// load the filtered words. Lines starting with ';' are comments.
+func init_filter(filename string) error {
+
+	file, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	var words []*regexp.Regexp
+
+	scanner := bufio.NewScanner(file)
+
+	for scanner.Scan() {
+		line := trim(scanner.Text())
+
+		if no(line) || line[0] == ';' {
+			continue
+		}
+
+		expr := `\b` + regexp.QuoteMeta(line) + `\b`
+
+		if len(line) > 2 && line[0] == '/' && line[len(line)-1] == '/' {
+			expr = line[1 : len(line)-1]
+		}
+
+		re, err := regexp.Compile("(?i)" + expr)
+		if err != nil {
+			return err
+		}
+
+		words = append(words, re)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	FILTERWORDS = words
+
+	INFO.Printf("%d filtered words loaded from %s", len(words), filename)
+
+	return nil
+}
+
+// return the message with the filtered words masked, and if any was found
+func filterWords(message string) (string, bool) {
+
+	found := false
+
+	for _, re := range FILTERWORDS {
+		message = re.ReplaceAllStringFunc(message, func(word string) string {
+			found = true
+			return strings.Repeat("*", len(word))
+		})
+	}
+
+	return message, found
+}
+
+// the policy for the channel
+func (c *Channel) filterPolicy() filterPolicy {
+	c.RLock()
+	filter := c.filter
+	c.RUnlock()
+
+	if policy, ok := parsePolicy(filter); ok {
+		return policy
+	}
+
+	policy, _ := parsePolicy(FILTERPOLICY)
+
+	return policy
+}
+
+// count a hit and return the hits so far
+func (c *Channel) addHit(name string) int {
+	c.Lock()
+	defer c.Unlock()
+
+	c.hits[name]++
+
+	return c.hits[name]
+}
+
+func (c *Channel) isMuted(clt *Client) bool {
+	c.RLock()
+	defer c.RUnlock()
+
+	return c.listed(c.muted, clt)
+}
+
+// check what clt says in the channel with /command. Return the text to say,
+// or false if nothing must be said.
+func (c *Channel) check(clt *Client, command string, message string) (string, bool) {
+
+	masked, found := filterWords(message)
+
+	if !found {
+		return message, true
+	}
+
+	policy := c.filterPolicy()
+
+	if policy.action == FILTER_OFF {
+		return message, true
+	}
+
+	MODERATION.Printf("%s in %s (%s): %s", clt, c, policy.action, message)
+
+	switch policy.action {
+	case FILTER_MASK:
+		return masked, true
+	case FILTER_REJECT:
+		clt.Say(">/%s>0>your line to %s was rejected by the word filter", command, c)
+		return "", false
+	}
+
+	hits := c.addHit(clt.Name)
+
+	if hits < policy.hits {
+		clt.Say(">/%s>0>your line to %s was rejected by the word filter (%d/%d)", command, c, hits, policy.hits)
+		return "", false
+	}
+
+	c.setMode(true, MODE_QUIET, clt.Name)
+	c.changed()
+
+	if c.linked {
+		linkBroadcast("MODE %s @srv +q %s", c, clt)
+	}
+
+	c.write(nil, ">"+c.Name+">!mode>@srv +q "+clt.Name+"\n")
+
+	MODERATION.Printf("%s muted in %s after %d hits", clt, c, hits)
+
+	return "", false
+}
+
+// check a private message from clt, with the same results as Channel.check
+func (clt *Client) check(message string) (string, bool) {
+
+	masked, found := filterWords(message)
+
+	if !found {
+		return message, true
+	}
+
+	policy, _ := parsePolicy(FILTERPOLICY)
+
+	if policy.action == FILTER_OFF {
+		return message, true
+	}
+
+	MODERATION.Printf("%s in a private message (%s): %s", clt, policy.action, message)
+
+	switch policy.action {
+	case FILTER_MASK:
+		return masked, true
+	case FILTER_REJECT:
+		clt.Say(">/msg>0>your message was rejected by the word filter")
+		return "", false
+	}
+
+	hits := int(clt.filterHits.Add(1))
+
+	if hits < policy.hits {
+		clt.Say(">/msg>0>your message was rejected by the word filter (%d/%d)", hits, policy.hits)
+		return "", false
+	}
+
+	clt.Say(">/msg>0>you have been muted by the word filter")
+
+	MODERATION.Printf("%s muted in private messages after %d hits", clt, hits)
+
+	return "", false
+}
+
+// has the word filter muted clt in private messages?
+func (clt *Client) isMuted() bool {
+	policy, _ := parsePolicy(FILTERPOLICY)
+
+	return policy.action == FILTER_MUTE && int(clt.filterHits.Load()) >= policy.hits
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParsePolicy(t *testing.T) {
+
+	tests := []struct {
+		policy string
+		action string
+		hits   int
+		ok     bool
+	}{
+		{"off", FILTER_OFF, 0, true},
+		{"mask", FILTER_MASK, 0, true},
+		{"reject", FILTER_REJECT, 0, true},
+		{"mute", FILTER_MUTE, FILTERMUTE, true},
+		{"mute:5", FILTER_MUTE, 5, true},
+		{"mute:0", FILTER_MUTE, 0, false},
+		{"mute:x", FILTER_MUTE, 0, false},
+		{"reject:2", FILTER_REJECT, 0, false},
+		{"drop", "", 0, false},
+	}
+
+	for _, test := range tests {
+		policy, ok := parsePolicy(test.policy)
+
+		if ok != test.ok || (ok && (policy.action != test.action || policy.hits != test.hits)) {
+			t.Fatalf("parsePolicy(%s) = %+v, %v", test.policy, policy, ok)
+		}
+	}
+}
+
+func TestFilter(t *testing.T) {
+	// configure test server
+	init_logger()
+	init_commands()
+	gentoken = func() string { return "TOKEN" }
+	main_channel := NewChannelMain("#main")
+	CHANNELS.Store(main_channel.Key(), main_channel)
+
+	words := filepath.Join(t.TempDir(), "words.txt")
+	os.WriteFile(words, []byte("; filtered words\ndarn\n/h[e3]ck/\n"), 0600)
+
+	if err := init_filter(words); err != nil {
+		t.Fatalf("init_filter() failed with %s", err)
+	}
+	defer func() { FILTERWORDS = nil }()
+
+	_, out1, in1 := genClient()
+	_, out2, in2 := genClient()
+
+	out1.Write([]byte("/login @op\n"))
+	expectLines(t, "Login", in1, out1, ">/login>0>you're now @op", ">#main>!token>TOKEN")
+	expectLines(t, "Login Notice", in2, out2, ">#main>!login>@op has joined the server")
+
+	out2.Write([]byte("/login @user\n"))
+	expectLines(t, "Login #2", in2, out2, ">/login>0>you're now @user", ">#main>!token>TOKEN")
+	expectLines(t, "Login Notice #2", in1, out1, ">#main>!login>@user has joined the server")
+
+	out1.Write([]byte("/join #party\n"))
+	expectLines(t, "Create Channel", in1, out1, ">/join>0>@op joined #party")
+
+	out2.Write([]byte("/join #party\n"))
+	expectLines(t, "Join", in2, out2, ">#party>@user>joined the channel")
+	expectLines(t, "Join Notice", in1, out1, ">#party>@user>joined the channel")
+
+	out2.Write([]byte("/say #party darn it, Darnell\n"))
+	expectLines(t, "Masked", in2, out2, ">#party>@user>**** it, Darnell")
+	expectLines(t, "Masked Notice", in1, out1, ">#party>@user>**** it, Darnell")
+
+	out1.Write([]byte("/mode #party +f mute:2\n"))
+	expectLines(t, "Policy", in1, out1, ">#party>!mode>@op +f mute:2")
+	expectLines(t, "Policy Notice", in2, out2, ">#party>!mode>@op +f mute:2")
+
+	out2.Write([]byte("/say #party what the h3ck\n"))
+	expectLines(t, "Rejected", in2, out2, ">/say>0>your line to #party was rejected by the word filter (1/2)")
+	expectLines(t, "Rejected Notice", in1, out1)
+
+	out2.Write([]byte("/say #party HECK\n"))
+	expectLines(t, "Muted", in2, out2, ">#party>!mode>@srv +q @user")
+	expectLines(t, "Muted Notice", in1, out1, ">#party>!mode>@srv +q @user")
+
+	out2.Write([]byte("/say #party sorry\n"))
+	expectLines(t, "Muted Say", in2, out2, ">/say>0>you have been muted in #party")
+
+	out2.Write([]byte("/mode #party\n"))
+	expectLines(t, "Mode List", in2, out2, ">/mode>0>#party +f mute:2")
+
+	out2.Write([]byte("/msg @op darn\n"))
+	expectLines(t, "Private Masked", in2, out2, ">@op>@user>****")
+	expectLines(t, "Private Masked Notice", in1, out1, ">@user>@user>****")
+
+	out1.Write([]byte("/mode #party -q @user\n"))
+	expectLines(t, "Unmute", in1, out1, ">#party>!mode>@op -q @user")
+	expectLines(t, "Unmute Notice", in2, out2, ">#party>!mode>@op -q @user")
+
+	out2.Write([]byte("/say #party sorry\n"))
+	expectLines(t, "Unmuted Say", in2, out2, ">#party>@user>sorry")
+	expectLines(t, "Unmuted Say Notice", in1, out1, ">#party>@user>sorry")
+
+	out1.Write([]byte("/logoff\n"))
+	expectLines(t, "Logoff", in1, out1, ">/logoff>0>Goodbye @op")
+
+	out2.Write([]byte("/logoff\n"))
+	expectLines(t, "Logoff #2", in2, out2, ">#main>!logoff>@op is leaving", ">/logoff>0>Goodbye @user")
+}
@@ -0,0 +1,240 @@
+package main
+
+import (
+	"sort"
+	"sync"
+)
+
+// Ignore lists of users that logged in with a tripcode are stored in
+// DATADIR by tripcode, so they're back on the next /login with the same
+// secret. Lists of users without a tripcode last while they're logged in.
+//
+// The server has no memos, so ignore lists only cover channel lines and
+// private messages. Memos should check ignoreList.contains on delivery too.
+
+const (
+	MAX_IGNORED  = 32 // names a user can ignore
+	IGNORES_FILE = "ignores.json"
+)
+
+// stored ignore lists, tripcode -> names
+var IGNORES = struct {
+	lists      map[string][]string
+	sync.Mutex // for reading/changing lists
+}{lists: map[string][]string{}}
+
+// ignoreList holds the names a client doesn't want to hear from
+type ignoreList struct {
+	names        map[string]bool
+	sync.RWMutex // for adding/removing names
+}
+
+func (l *ignoreList) contains(name string) bool {
+	l.RLock()
+	defer l.RUnlock()
+
+	return l.names[name]
+}
+
+func (l *ignoreList) add(name string) bool {
+	l.Lock()
+	defer l.Unlock()
+
+	if l.names == nil {
+		l.names = map[string]bool{}
+	}
+
+	if len(l.names) >= MAX_IGNORED {
+		return false
+	}
+
+	l.names[name] = true
+
+	return true
+}
+
+func (l *ignoreList) remove(name string) bool {
+	l.Lock()
+	defer l.Unlock()
+
+	if !l.names[name] {
+		return false
+	}
+
+	delete(l.names, name)
+
+	return true
+}
+
+// follow a user that changed name, true if they were in the list
+func (l *ignoreList) rename(oldName string, newName string) bool {
+	l.Lock()
+	defer l.Unlock()
+
+	if !l.names[oldName] {
+		return false
+	}
+
+	delete(l.names, oldName)
+	l.names[newName] = true
+
+	return true
+}
+
+// replace the list with names
+func (l *ignoreList) set(names []string) {
+	l.Lock()
+	defer l.Unlock()
+
+	l.names = map[string]bool{}
+
+	for _, name := range names {
+		if len(l.names) < MAX_IGNORED {
+			l.names[name] = true
+		}
+	}
+}
+
+func (l *ignoreList) list() (output []string) {
+	l.RLock()
+	defer l.RUnlock()
+
+	for name := range l.names {
+		output = append(output, name)
+	}
+
+	sort.Strings(output)
+
+	return output
+}
+
+// load the ignore lists stored in DATADIR
+func load_ignores() error {
+
+	lists := map[string][]string{}
+
+	if err := readJSON(IGNORES_FILE, &lists); err != nil {
+		return err
+	}
+
+	IGNORES.Lock()
+	defer IGNORES.Unlock()
+
+	IGNORES.lists = lists
+
+	INFO.Printf("%d ignore lists loaded", len(lists))
+
+	return nil
+}
+
+// take back the stored ignore list of clt's tripcode, after /login
+func (clt *Client) restoreIgnored() {
+
+	if len(clt.trip) == 0 {
+		return
+	}
+
+	IGNORES.Lock()
+	names := IGNORES.lists[clt.trip]
+	IGNORES.Unlock()
+
+	clt.ignored.set(names)
+}
+
+// store the ignore list of clt if they have a tripcode
+func (clt *Client) saveIgnored() {
+
+	if len(clt.trip) == 0 || !clt.isLocal() {
+		return
+	}
+
+	IGNORES.Lock()
+	defer IGNORES.Unlock()
+
+	if names := clt.ignored.list(); len(names) > 0 {
+		IGNORES.lists[clt.trip] = names
+	} else {
+		delete(IGNORES.lists, clt.trip)
+	}
+
+	if err := writeJSON(IGNORES_FILE, IGNORES.lists); err != nil {
+		ERROR.Printf("unable to save ignore lists: %s", err)
+	}
+}
+
+// does clt want to receive lines from from? Server lines (from == nil) always go through.
+func (clt *Client) hears(from *Client) bool {
+	return from == nil || from == clt || !clt.ignored.contains(from.Name)
+}
+
+// show or add to the ignore list
+func do_ignore(clt *Client, args string) {
+
+	if !clt.isLogged() {
+		clt.Say(">/ignore>0>/ignore requires you to be logged")
+
+		return
+	}
+
+	if no(args) {
+		names := clt.ignored.list()
+
+		if len(names) == 0 {
+			clt.Say(">/ignore>0>you're not ignoring anyone")
+			return
+		}
+
+		clt.SayN(">/ignore>", names)
+		return
+	}
+
+	name, _ := split2(args, " ")
+
+	username, err := ValidUsername(name)
+
+	if err != nil {
+		clt.Say(">/ignore>0>%s is not a valid username because %s", name, err.Error())
+		return
+	}
+
+	if username == clt.Name {
+		clt.Say(">/ignore>0>you can't ignore yourself")
+		return
+	}
+
+	if !clt.ignored.add(username) {
+		clt.Say(">/ignore>0>you can't ignore more than %d users", MAX_IGNORED)
+		return
+	}
+
+	clt.saveIgnored()
+
+	clt.Say(">/ignore>0>ignoring %s", username)
+}
+
+// remove from the ignore list
+func do_unignore(clt *Client, args string) {
+
+	if !clt.isLogged() {
+		clt.Say(">/unignore>0>/unignore requires you to be logged")
+
+		return
+	}
+
+	if no(args) {
+		clt.Say(">/unignore>0>/unignore <@user>")
+
+		return
+	}
+
+	name, _ := split2(args, " ")
+
+	if !clt.ignored.remove(name) {
+		clt.Say(">/unignore>0>you're not ignoring %s", name)
+		return
+	}
+
+	clt.saveIgnored()
+
+	clt.Say(">/unignore>0>not ignoring %s anymore", name)
+}
@@ -0,0 +1,140 @@
+package main
+
+import "testing"
+
+func TestIgnore(t *testing.T) {
+	// configure test server
+	init_logger()
+	init_commands()
+	gentoken = func() string { return "TOKEN" }
+	main_channel := NewChannelMain("#main")
+	CHANNELS.Store(main_channel.Key(), main_channel)
+
+	_, out1, in1 := genClient()
+	_, out2, in2 := genClient()
+
+	out1.Write([]byte("/login @quiet\n"))
+	expectLines(t, "Login", in1, out1, ">/login>0>you're now @quiet", ">#main>!token>TOKEN")
+	expectLines(t, "Login Notice", in2, out2, ">#main>!login>@quiet has joined the server")
+
+	out2.Write([]byte("/login @loud\n"))
+	expectLines(t, "Login #2", in2, out2, ">/login>0>you're now @loud", ">#main>!token>TOKEN")
+	expectLines(t, "Login Notice #2", in1, out1, ">#main>!login>@loud has joined the server")
+
+	out1.Write([]byte("/ignore\n"))
+	expectLines(t, "Empty List", in1, out1, ">/ignore>0>you're not ignoring anyone")
+
+	out2.Write([]byte("/msg @quiet psst\n"))
+	expectLines(t, "Private Message", in2, out2, ">@quiet>@loud>psst")
+	expectLines(t, "Private Message Received", in1, out1, ">@loud>@loud>psst")
+
+	out1.Write([]byte("/ignore @quiet\n"))
+	expectLines(t, "Ignore Myself", in1, out1, ">/ignore>0>you can't ignore yourself")
+
+	out1.Write([]byte("/ignore @loud\n"))
+	expectLines(t, "Ignore", in1, out1, ">/ignore>0>ignoring @loud")
+
+	out1.Write([]byte("/ignore\n"))
+	expectLines(t, "List", in1, out1, ">/ignore>0>@loud")
+
+	out2.Write([]byte("/say #main HELLO\n"))
+	expectLines(t, "Say", in2, out2, ">#main>@loud>HELLO")
+	expectLines(t, "Say Ignored", in1, out1)
+
+	out2.Write([]byte("/msg @quiet PSST\n"))
+	expectLines(t, "Private Message #2", in2, out2, ">@quiet>@loud>PSST")
+	expectLines(t, "Private Message Ignored", in1, out1)
+
+	out2.Write([]byte("/nick @louder\n"))
+	expectLines(t, "Nick", in2, out2, ">/nick>0>you're now @louder", ">#main>!nick>@loud @louder")
+	expectLines(t, "Nick Ignored", in1, out1)
+
+	out1.Write([]byte("/ignore\n"))
+	expectLines(t, "List After Nick", in1, out1, ">/ignore>0>@louder")
+
+	out1.Write([]byte("/unignore @loud\n"))
+	expectLines(t, "Unignore Unknown", in1, out1, ">/unignore>0>you're not ignoring @loud")
+
+	out1.Write([]byte("/unignore @louder\n"))
+	expectLines(t, "Unignore", in1, out1, ">/unignore>0>not ignoring @louder anymore")
+
+	out2.Write([]byte("/say #main hello\n"))
+	expectLines(t, "Say #2", in2, out2, ">#main>@louder>hello")
+	expectLines(t, "Say Heard", in1, out1, ">#main>@louder>hello")
+
+	out1.Write([]byte("/logoff\n"))
+	expectLines(t, "Logoff", in1, out1, ">/logoff>0>Goodbye @quiet")
+
+	out2.Write([]byte("/logoff\n"))
+	expectLines(t, "Logoff #2", in2, out2, ">#main>!logoff>@quiet is leaving", ">/logoff>0>Goodbye @louder")
+}
+
+func TestIgnoreStored(t *testing.T) {
+	// configure test server
+	init_logger()
+	init_commands()
+	gentoken = func() string { return "TOKEN" }
+	main_channel := NewChannelMain("#main")
+	CHANNELS.Store(main_channel.Key(), main_channel)
+
+	DATADIR = t.TempDir()
+	TRIPKEY = "key"
+	defer func() { DATADIR, TRIPKEY = "", "" }()
+
+	if err := load_ignores(); err != nil {
+		t.Fatalf("load_ignores failed with %s", err)
+	}
+
+	_, out1, in1 := genClient()
+
+	out1.Write([]byte("/login @keeper#secret\n"))
+	expectLines(t, "Login", in1, out1, ">/login>0>you're now @keeper", ">#main>!token>TOKEN")
+
+	out1.Write([]byte("/ignore @pest\n"))
+	expectLines(t, "Ignore", in1, out1, ">/ignore>0>ignoring @pest")
+
+	out1.Write([]byte("/logoff\n"))
+	expectLines(t, "Logoff", in1, out1, ">/logoff>0>Goodbye @keeper")
+
+	// the server starts again
+	IGNORES.lists = nil
+
+	if err := load_ignores(); err != nil {
+		t.Fatalf("load_ignores failed with %s", err)
+	}
+
+	// the same secret gets the list back, whatever the name
+	_, out2, in2 := genClient()
+
+	out2.Write([]byte("/login @keeper2#secret\n"))
+	expectLines(t, "Login Again", in2, out2, ">/login>0>you're now @keeper2", ">#main>!token>TOKEN")
+
+	out2.Write([]byte("/ignore\n"))
+	expectLines(t, "Stored List", in2, out2, ">/ignore>0>@pest")
+
+	out2.Write([]byte("/unignore @pest\n"))
+	expectLines(t, "Unignore", in2, out2, ">/unignore>0>not ignoring @pest anymore")
+
+	// another secret doesn't
+	_, out3, in3 := genClient()
+
+	out3.Write([]byte("/login @other#another\n"))
+	expectLines(t, "Login Other", in3, out3, ">/login>0>you're now @other", ">#main>!token>TOKEN")
+	expectLines(t, "Login Notice", in2, out2, ">#main>!login>@other has joined the server")
+
+	out3.Write([]byte("/ignore\n"))
+	expectLines(t, "Other List", in3, out3, ">/ignore>0>you're not ignoring anyone")
+
+	out3.Write([]byte("/logoff\n"))
+	expectLines(t, "Logoff Other", in3, out3, ">/logoff>0>Goodbye @other")
+
+	out2.Write([]byte("/logoff\n"))
+	expectLines(t, "Logoff Again", in2, out2, ">#main>!logoff>@other is leaving", ">/logoff>0>Goodbye @keeper2")
+
+	IGNORES.lists = nil
+	load_ignores()
+
+	if len(IGNORES.lists) != 0 {
+		t.Errorf("an emptied list is still stored: %v", IGNORES.lists)
+	}
+}
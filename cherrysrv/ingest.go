@@ -0,0 +1,294 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// HTTP ingest.
+//
+// Game servers and the lobby post events into channels without being chat
+// clients. Every source has its own key, sent as "Authorization: Bearer <key>"
+// or ?key=<key>, and can post INGESTRATE events per minute.
+//
+//	POST /event	{"channel": "#games", "event": "win", "text": "Alice won 5 Card Stud at The Den"}
+//			--> >#games>!win>@srv Alice won 5 Card Stud at The Den
+//	POST /lobby	the lobby event webhook (CallEventWebHook), a new game server
+//			online is announced in ?channel= (#games by default)
+//
+// The channel must exist (i.e. a registered one). Events in linked channels
+// are sent to the peers too.
+
+const (
+	INGEST_MAXBODY = 4096     // bytes accepted in a request
+	INGEST_CHANNEL = "#games" // default channel for the lobby webhook
+)
+
+var (
+	INGESTRATE = 30                  // events per minute and source
+	INGESTKEYS = map[string]string{} // key -> source
+	INGESTS    = map[string]*bucket{}
+	INGESTSMUX sync.Mutex // for INGESTS
+)
+
+// token bucket, to rate limit a source
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// take a token from the bucket of source, if there's any left
+func allowIngest(source string) bool {
+	INGESTSMUX.Lock()
+	defer INGESTSMUX.Unlock()
+
+	now := time.Now()
+	rate := float64(INGESTRATE)
+
+	b, ok := INGESTS[source]
+	if !ok {
+		b = &bucket{tokens: rate, last: now}
+		INGESTS[source] = b
+	}
+
+	b.tokens += now.Sub(b.last).Minutes() * rate
+	b.last = now
+
+	if b.tokens > rate {
+		b.tokens = rate
+	}
+
+	if b.tokens < 1 {
+		return false
+	}
+
+	b.tokens--
+
+	return true
+}
+
+// what a game server posts to /event
+type ingestEvent struct {
+	Channel string `json:"channel"`
+	Event   string `json:"event"`
+	Text    string `json:"text"`
+}
+
+// what the lobby posts to its webhook (GameServer in the lobby)
+type lobbyServer struct {
+	Game       string `json:"game"`
+	Server     string `json:"server"`
+	Serverurl  string `json:"serverurl"`
+	Status     string `json:"status"`
+	Maxplayers int    `json:"maxplayers"`
+	Curplayers int    `json:"curplayers"`
+}
+
+var (
+	LOBBYSEEN    = map[string]string{} // serverurl -> last status, only changes are announced
+	LOBBYSEENMUX sync.Mutex
+)
+
+// -ingestkey source:key
+func addIngestKey(sourcekey string) error {
+
+	source, key, found := strings.Cut(sourcekey, ":")
+
+	if !found || no(source) || len(key) < 8 {
+		return fmt.Errorf("-ingestkey %s must be source:key, with a key of 8 chars at least", sourcekey)
+	}
+
+	INGESTKEYS[key] = source
+
+	return nil
+}
+
+// start serving the ingest endpoints
+func init_ingest(ingestaddr string) error {
+
+	listener, err := net.Listen("tcp", ingestaddr)
+	if err != nil {
+		return err
+	}
+
+	INFO.Printf("Ready to ingest events on http://%s", ingestaddr)
+
+	go http.Serve(listener, ingestHandler())
+
+	return nil
+}
+
+func ingestHandler() http.Handler {
+
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("/event", ingest_event)
+	mux.HandleFunc("/lobby", ingest_lobby)
+
+	return mux
+}
+
+// return the source that sent the request, if the key is right
+func ingestSource(r *http.Request) (string, bool) {
+
+	key := r.URL.Query().Get("key")
+
+	if bearer := r.Header.Get("Authorization"); strings.HasPrefix(bearer, "Bearer ") {
+		key = strings.TrimPrefix(bearer, "Bearer ")
+	}
+
+	for known, source := range INGESTKEYS {
+		if subtle.ConstantTimeCompare([]byte(key), []byte(known)) == 1 {
+			return source, true
+		}
+	}
+
+	return "", false
+}
+
+func ingestReply(w http.ResponseWriter, status int, message string) {
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+
+	json.NewEncoder(w).Encode(map[string]any{"success": status < 300, "message": message})
+}
+
+// check the method, key and rate of a request, replying if it can't go on
+func ingestAccept(w http.ResponseWriter, r *http.Request, methods ...string) (string, bool) {
+
+	accepted := false
+
+	for _, method := range methods {
+		accepted = accepted || r.Method == method
+	}
+
+	if !accepted {
+		ingestReply(w, http.StatusMethodNotAllowed, "method not allowed")
+		return "", false
+	}
+
+	source, ok := ingestSource(r)
+
+	if !ok {
+		WARN.Printf("ingest from %s with a wrong key", r.RemoteAddr)
+		ingestReply(w, http.StatusUnauthorized, "wrong key")
+		return "", false
+	}
+
+	if !allowIngest(source) {
+		WARN.Printf("ingest from %s over the rate limit", source)
+		ingestReply(w, http.StatusTooManyRequests, "too many events")
+		return "", false
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, INGEST_MAXBODY)
+
+	return source, true
+}
+
+// is the name of an event valid (as a command, up to 16 letters or numbers)?
+func validEvent(event string) bool {
+	return len(event) > 0 && len(event) <= 16 && !isDigit(event[0]) && isASCIIPrintable(event)
+}
+
+// say the event in the channel as @srv
+func postEvent(channel *Channel, event string, text string) {
+
+	text = strings.Join(strings.Fields(text), " ") // no line breaks
+
+	channel.write(nil, shorten255(">"+channel.Name+">!"+event+">@srv "+text+"\n"))
+
+	if channel.linked {
+		linkBroadcast("EVENT %s %s %s", channel, event, text)
+	}
+}
+
+func ingest_event(w http.ResponseWriter, r *http.Request) {
+
+	source, ok := ingestAccept(w, r, http.MethodPost)
+	if !ok {
+		return
+	}
+
+	var event ingestEvent
+
+	if err := json.NewDecoder(r.Body).Decode(&event); err != nil {
+		ingestReply(w, http.StatusBadRequest, "unable to parse the event")
+		return
+	}
+
+	if no(event.Event) {
+		event.Event = "event"
+	}
+
+	if !validEvent(event.Event) || no(event.Text) {
+		ingestReply(w, http.StatusBadRequest, "the event needs a valid event name and some text")
+		return
+	}
+
+	channel, ok := CHANNELS.Load(event.Channel)
+
+	if !ok {
+		ingestReply(w, http.StatusNotFound, fmt.Sprintf("%s is not a valid channel", event.Channel))
+		return
+	}
+
+	postEvent(channel, event.Event, event.Text)
+
+	INFO.Printf("%s posted !%s in %s", source, event.Event, channel)
+	ingestReply(w, http.StatusOK, "event posted")
+}
+
+func ingest_lobby(w http.ResponseWriter, r *http.Request) {
+
+	source, ok := ingestAccept(w, r, http.MethodPost, http.MethodDelete)
+	if !ok {
+		return
+	}
+
+	var server lobbyServer
+
+	if err := json.NewDecoder(r.Body).Decode(&server); err != nil || no(server.Serverurl) {
+		ingestReply(w, http.StatusBadRequest, "unable to parse the server")
+		return
+	}
+
+	if r.Method == http.MethodDelete {
+		server.Status = "offline"
+	}
+
+	LOBBYSEENMUX.Lock()
+	previous := LOBBYSEEN[server.Serverurl]
+	LOBBYSEEN[server.Serverurl] = server.Status
+	LOBBYSEENMUX.Unlock()
+
+	if server.Status != "online" || previous == "online" {
+		ingestReply(w, http.StatusOK, "nothing to announce")
+		return
+	}
+
+	channelName := r.URL.Query().Get("channel")
+
+	if no(channelName) {
+		channelName = INGEST_CHANNEL
+	}
+
+	channel, ok := CHANNELS.Load(channelName)
+
+	if !ok {
+		ingestReply(w, http.StatusNotFound, fmt.Sprintf("%s is not a valid channel", channelName))
+		return
+	}
+
+	postEvent(channel, "game", fmt.Sprintf("New %s game starting at %s", server.Game, server.Server))
+
+	INFO.Printf("%s announced %s in %s", source, server.Serverurl, channel)
+	ingestReply(w, http.StatusOK, "event posted")
+}
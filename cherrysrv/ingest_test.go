@@ -0,0 +1,80 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestIngest(t *testing.T) {
+	// configure test server
+	init_logger()
+	init_commands()
+	gentoken = func() string { return "TOKEN" }
+	main_channel := NewChannelMain("#main")
+	CHANNELS.Store(main_channel.Key(), main_channel)
+
+	INGESTRATE = 2
+	INGESTKEYS = map[string]string{}
+	INGESTS = map[string]*bucket{}
+
+	if err := addIngestKey("lobby:short"); err == nil {
+		t.Fatalf("addIngestKey() accepted a short key")
+	}
+
+	addIngestKey("5cardstud:secretkey")
+
+	server := httptest.NewServer(ingestHandler())
+	defer server.Close()
+
+	post := func(name string, path string, key string, body string, status int) {
+		req, _ := http.NewRequest(http.MethodPost, server.URL+path, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+key)
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("%s failed with %s", name, err)
+		}
+		resp.Body.Close()
+
+		if resp.StatusCode != status {
+			t.Fatalf("%s got status %d, expected %d", name, resp.StatusCode, status)
+		}
+	}
+
+	_, out, in := genClient()
+
+	out.Write([]byte("/login @player\n"))
+	expectLines(t, "Login", in, out, ">/login>0>you're now @player", ">#main>!token>TOKEN")
+
+	out.Write([]byte("/join #games\n"))
+	expectLines(t, "Create Channel", in, out, ">/join>0>@player joined #games")
+
+	post("Wrong Key", "/event", "wrongkey", `{"channel": "#games", "text": "hi"}`, http.StatusUnauthorized)
+	post("No Channel", "/event", "secretkey", `{"channel": "#nope", "text": "hi"}`, http.StatusNotFound)
+
+	post("Event", "/event", "secretkey", `{"channel": "#games", "event": "win", "text": "Alice won 5 Card Stud\nat The Den"}`, http.StatusOK)
+	expectLines(t, "Event", in, out, ">#games>!win>@srv Alice won 5 Card Stud at The Den")
+
+	post("Rate Limit", "/event", "secretkey", `{"channel": "#games", "text": "too much"}`, http.StatusTooManyRequests)
+	expectLines(t, "Rate Limit", in, out)
+
+	INGESTS = map[string]*bucket{}
+
+	lobby := `{"game": "Fujitzee", "server": "The Bar", "serverurl": "https://fujitzee/bar", "status": "online"}`
+
+	post("Lobby", "/lobby?channel=%23games", "secretkey", lobby, http.StatusOK)
+	expectLines(t, "Lobby", in, out, ">#games>!game>@srv New Fujitzee game starting at The Bar")
+
+	post("Lobby Update", "/lobby?channel=%23games", "secretkey", lobby, http.StatusOK)
+	expectLines(t, "Lobby Update", in, out)
+
+	out.Write([]byte("/logoff\n"))
+	expectLines(t, "Logoff", in, out, ">/logoff>0>Goodbye @player")
+
+	for i := 0; i < 50 && !CLIENTS.IsEmpty(); i++ { // let the next test start clean
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,721 @@
+package main
+
+import (
+	"bufio"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lrita/cmap"
+)
+
+// Server to server links.
+//
+// Linked servers form a full mesh: every server connects to every other one and
+// nothing received from a peer is forwarded to a third server. The protocol is
+// line based, like the client one, with a verb followed by its arguments:
+//
+//	SERVER <name> <nonce> <version>	handshake, sent by both sides
+//	AUTH <proof>			answer to the peer's nonce (see linkProof)
+//	USER <@nick> <logintime> [trip]	a user logged in on the peer
+//	QUIT <@nick>			a user left the peer
+//	NICK <@nick> <@newnick>		a user changed their name
+//	JOIN <#channel> <@nick>		a user joined a linked channel
+//	PART <#channel> <@nick>		a user left a linked channel
+//	MSG <#channel> <@nick> <text>	a user talked in a linked channel
+//	ACTION <#channel> <@nick> <text>	a user acted (/me) in a linked channel
+//	NOTICE <#channel> <@nick> <text>	a user sent a notice to a linked channel
+//	ROLL <#channel> <@nick> <result>	a user rolled dice in a linked channel
+//	MODE <#channel> <@nick> <changes>	a user changed the modes of a linked channel
+//	PRIVMSG <@to> <@from> <text>	a user talked privately to a user of ours
+//	TOPIC <#channel> <@nick> <text>	a user changed the topic of a linked channel
+//	EVENT <#channel> <event> <text>	an event was posted to the peer (see ingest.go)
+//	ENDBURST			the initial state of the peer has been sent
+//	PING / PONG			keepalive
+//	ERROR <text>			the peer is closing the link
+
+const (
+	LINK_TIMEOUT  = 90 * time.Second // drop the link if the peer is silent for this long
+	LINK_PING     = 30 * time.Second // keepalive interval
+	LINK_RETRY    = 15 * time.Second // wait before redialing a lost peer
+	LINK_DIALWAIT = 10 * time.Second // timeout to connect and handshake
+)
+
+type do_link func(*Link, string)
+
+var (
+	LINKCOMMANDS  = make(map[string]do_link)
+	LINKS         cmap.Map[string, *Link]
+	SERVERNAME    string
+	LINKKEY       string
+	LOCALCHANNELS = make(map[string]bool) // channels that are never shared with peers
+)
+
+// Link is a connection to a peer server
+type Link struct {
+	conn     net.Conn
+	reader   *bufio.Reader
+	out      *outbox // queued output to the peer
+	Name     string  // Name of the peer server
+	bursting bool    // peer is still sending its initial state
+}
+
+func (l *Link) String() string {
+	return l.Name
+}
+
+func (l *Link) Key() string {
+	return l.Name
+}
+
+func init_link_commands() {
+	LINKCOMMANDS["USER"] = link_user
+	LINKCOMMANDS["QUIT"] = link_quit
+	LINKCOMMANDS["NICK"] = link_nick
+	LINKCOMMANDS["JOIN"] = link_join
+	LINKCOMMANDS["PART"] = link_part
+	LINKCOMMANDS["MSG"] = link_msg
+	LINKCOMMANDS["ACTION"] = link_action
+	LINKCOMMANDS["NOTICE"] = link_notice
+	LINKCOMMANDS["ROLL"] = link_roll
+	LINKCOMMANDS["MODE"] = link_mode
+	LINKCOMMANDS["PRIVMSG"] = link_privmsg
+	LINKCOMMANDS["TOPIC"] = link_topic
+	LINKCOMMANDS["EVENT"] = link_event
+	LINKCOMMANDS["ENDBURST"] = link_endburst
+	LINKCOMMANDS["PING"] = link_ping
+	LINKCOMMANDS["PONG"] = link_pong
+	LINKCOMMANDS["ERROR"] = link_error
+}
+
+// start accepting peers on linkaddr (if any) and dial every peer in peers
+func init_links(linkaddr string, peers []string) error {
+
+	init_link_commands()
+
+	if len(linkaddr) > 0 {
+		listener, err := net.Listen("tcp", linkaddr)
+		if err != nil {
+			return fmt.Errorf("unable to listen for links on %s (%s)", linkaddr, err)
+		}
+
+		INFO.Printf("Ready to link on tcp://%s as %s", linkaddr, SERVERNAME)
+
+		go acceptLinks(listener)
+	}
+
+	for _, peer := range peers {
+		go dialLink(peer)
+	}
+
+	go pingLinks()
+
+	return nil
+}
+
+func acceptLinks(listener net.Listener) {
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			WARN.Printf("Unable to accept link on %s (%s)", listener.Addr(), err)
+			continue
+		}
+
+		go serveLink(conn)
+	}
+}
+
+// keep a link to addr up for as long as the server runs
+func dialLink(addr string) {
+
+	for {
+		conn, err := net.DialTimeout("tcp", addr, LINK_DIALWAIT)
+
+		if err != nil {
+			DEBUG.Printf("unable to link to %s (%s)", addr, err)
+		} else {
+			serveLink(conn)
+		}
+
+		time.Sleep(LINK_RETRY)
+	}
+}
+
+func pingLinks() {
+
+	for {
+		time.Sleep(LINK_PING)
+
+		linkBroadcast("PING")
+	}
+}
+
+// serveLink runs a peer connection until it drops. It's used for both
+// accepted and dialed links, as the handshake is symmetrical.
+func serveLink(conn net.Conn) {
+
+	link := &Link{
+		conn:     conn,
+		reader:   bufio.NewReader(conn),
+		bursting: true,
+	}
+	link.out = newOutbox(conn, link, OVERFLOW_BLOCK) // dropping lines would desync the peer
+
+	defer link.out.close()
+
+	if err := link.handshake(); err != nil {
+		WARN.Printf("link with %s refused: %s", conn.RemoteAddr(), err)
+		link.send("ERROR %s", err)
+
+		return
+	}
+
+	if _, loaded := LINKS.LoadOrStore(link.Key(), link); loaded {
+		WARN.Printf("link with %s refused: already linked", link)
+		link.send("ERROR %s is already linked", link)
+
+		return
+	}
+
+	INFO.Printf("linked with %s (%s)", link, conn.RemoteAddr())
+
+	link.sendBurst()
+
+	for {
+		line, err := link.read()
+		if err != nil {
+			INFO.Printf("link with %s lost (%s)", link, err)
+			break
+		}
+
+		verb, args := split2(line, " ")
+
+		handler, ok := LINKCOMMANDS[verb]
+		if !ok {
+			DEBUG.Printf("%s sent unknown verb %s", link, verb)
+			continue
+		}
+
+		handler(link, args)
+	}
+
+	link.netsplit()
+	LINKS.Delete(link.Key())
+}
+
+// exchange SERVER and AUTH lines and validate the peer. The key itself
+// never goes over the wire: each side sends a nonce and proves it knows
+// the key by answering the other side's nonce.
+func (l *Link) handshake() error {
+
+	l.conn.SetReadDeadline(time.Now().Add(LINK_DIALWAIT))
+
+	nonce := linkNonce()
+
+	l.send("SERVER %s %s %s", SERVERNAME, nonce, VERSION)
+
+	line, err := l.reader.ReadString('\n')
+	if err != nil {
+		return err
+	}
+
+	fields := strings.Fields(line)
+
+	if len(fields) < 3 || fields[0] != "SERVER" {
+		return fmt.Errorf("expected SERVER <name> <nonce> <version>")
+	}
+
+	if fields[1] == SERVERNAME {
+		return fmt.Errorf("%s is my own name", fields[1])
+	}
+
+	if fields[2] == nonce {
+		return fmt.Errorf("peer replayed my nonce")
+	}
+
+	l.Name = fields[1]
+	challenge := fields[2]
+
+	l.send("AUTH %s", linkProof(SERVERNAME, challenge, nonce))
+
+	line, err = l.reader.ReadString('\n')
+	if err != nil {
+		return err
+	}
+
+	fields = strings.Fields(line)
+
+	if len(fields) != 2 || fields[0] != "AUTH" {
+		return fmt.Errorf("expected AUTH <proof>")
+	}
+
+	if !hmac.Equal([]byte(fields[1]), []byte(linkProof(l.Name, nonce, challenge))) {
+		return fmt.Errorf("bad link key")
+	}
+
+	return nil
+}
+
+// a random challenge for the peer
+func linkNonce() string {
+
+	buf := make([]byte, 16)
+	rand.Read(buf)
+
+	return hex.EncodeToString(buf)
+}
+
+// the answer of server name to a challenge: an HMAC of the challenge with
+// LINKKEY. The name and the sender's own nonce are part of it, so a proof
+// can't be reflected back or replayed on another link.
+func linkProof(name string, challenge string, nonce string) string {
+
+	mac := hmac.New(sha256.New, []byte(LINKKEY))
+	mac.Write([]byte(name + " " + challenge + " " + nonce))
+
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// send every local user and their linked channels to a new peer
+func (l *Link) sendBurst() {
+
+	sendUser := func(key string, clt *Client) bool {
+		if clt.isLocal() && clt.isLogged() {
+			l.send("%s", clt.userLine())
+		}
+		return true
+	}
+
+	CLIENTS.Range(sendUser)
+
+	sendChannel := func(key string, channel *Channel) bool {
+		if !channel.linked || channel.Name == "#main" { // #main is implicit in USER
+			return true
+		}
+
+		for _, clt := range channel.members() {
+			if clt.isLocal() && clt.isLogged() {
+				l.send("JOIN %s %s", channel, clt)
+			}
+		}
+		return true
+	}
+
+	sendModes := func(key string, channel *Channel) bool {
+		if channel.linked {
+			for _, changes := range channel.modeChanges() {
+				l.send("MODE %s %s %s", channel, SERVERNAME, changes)
+			}
+
+			if topic := channel.getTopic(); len(topic) > 0 {
+				l.send("TOPIC %s %s %s", channel, SERVERNAME, topic)
+			}
+		}
+		return true
+	}
+
+	CHANNELS.Range(sendChannel)
+	CHANNELS.Range(sendModes)
+
+	l.send("ENDBURST")
+}
+
+// remove every user that came through this link
+func (l *Link) netsplit() {
+
+	var lost []*Client
+
+	findRemote := func(key string, clt *Client) bool {
+		if clt.link == l {
+			lost = append(lost, clt)
+		}
+		return true
+	}
+
+	CLIENTS.Range(findRemote)
+
+	for _, clt := range lost {
+		clt.Close()
+		clt.UpdateInMain(">!netsplit>%s lost in netsplit (%s)", clt, l)
+	}
+
+	INFO.Printf("netsplit from %s, %d users lost", l, len(lost))
+}
+
+// send a line to the peer
+func (l *Link) send(format string, args ...interface{}) {
+
+	line := fmt.Sprintf(format, args...)
+
+	err := l.out.push(line + "\n")
+
+	if err != nil {
+		DEBUG.Printf("%s.send() failed with err: %s", l, err)
+	}
+}
+
+// read a line from the peer
+func (l *Link) read() (string, error) {
+
+	l.conn.SetReadDeadline(time.Now().Add(LINK_TIMEOUT))
+
+	line, err := l.reader.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+
+	return trim(line), nil
+}
+
+// send a line to every peer
+func linkBroadcast(format string, args ...interface{}) {
+
+	broadcast := func(key string, l *Link) bool {
+		l.send(format, args...)
+		return true
+	}
+
+	LINKS.Range(broadcast)
+}
+
+// the USER line that introduces a local user to peers
+func (clt *Client) userLine() string {
+
+	line := fmt.Sprintf("USER %s %d", clt, clt.loggedOn.UnixNano())
+
+	if len(clt.trip) > 0 {
+		line += " " + clt.trip
+	}
+
+	return line
+}
+
+// find a user that came through this link
+func (l *Link) remoteClient(name string) (*Client, bool) {
+
+	clt, ok := CLIENTS.Load(name)
+
+	if !ok || clt.link != l {
+		return nil, false
+	}
+
+	return clt, true
+}
+
+// does the local user win a nick collision against a remote one? The
+// oldest login wins; on a tie the lowest server name wins. Both servers
+// reach the same answer so only one of them has to act.
+func localWins(local time.Time, remote time.Time, peer string) bool {
+
+	if local.Equal(remote) {
+		return SERVERNAME < peer
+	}
+
+	return local.Before(remote)
+}
+
+// can a user logged in on the peer at loggedOn take name? If a local user
+// has it and loses the collision, they are disconnected. Call with NICKS held.
+func (l *Link) claim(name string, loggedOn time.Time) bool {
+
+	existing, ok := CLIENTS.Load(name)
+
+	if !ok {
+		return true
+	}
+
+	if !existing.isLocal() || localWins(existing.loggedOn, loggedOn, l.Name) {
+		DEBUG.Printf("%s sent %s, already in use here", l, name)
+		return false
+	}
+
+	WARN.Printf("nick collision on %s with %s, disconnecting the local user", name, l)
+	existing.Say(">#main>!collision>%s is in use on %s, disconnecting", name, l)
+	existing.Status.Store(USER_LOGGINOUT)
+	existing.Close()
+
+	return true
+}
+
+/*
+ *	Link commands start here.
+ */
+
+func link_user(l *Link, args string) {
+
+	name, rest := split2(args, " ")
+	since, trip := split2(rest, " ")
+
+	username, err := ValidUsername(name)
+	if err != nil {
+		DEBUG.Printf("%s sent invalid user %s: %s", l, name, err)
+		return
+	}
+
+	nanos, _ := strconv.ParseInt(since, 10, 64)
+	loggedOn := time.Unix(0, nanos)
+
+	NICKS.Lock()
+
+	if !l.claim(username, loggedOn) {
+		NICKS.Unlock()
+		return
+	}
+
+	clt := newRemoteClient(l, username, loggedOn, trip)
+
+	NICKS.Unlock()
+
+	if l.bursting {
+		clt.UpdateInMain(">!netjoin>%s has joined from %s", clt, l)
+		return
+	}
+
+	clt.UpdateInMain(">!login>%s has joined the server", clt)
+}
+
+func link_nick(l *Link, args string) {
+
+	oldName, newName := split2(args, " ")
+
+	clt, ok := l.remoteClient(oldName)
+	if !ok {
+		return
+	}
+
+	username, err := ValidUsername(newName)
+	if err != nil {
+		DEBUG.Printf("%s sent invalid user %s: %s", l, newName, err)
+		return
+	}
+
+	NICKS.Lock()
+
+	if !l.claim(username, clt.loggedOn) {
+		NICKS.Unlock()
+
+		// its server will disconnect it
+		clt.Close()
+		return
+	}
+
+	CLIENTS.Delete(oldName)
+	clt.Name = username
+	CLIENTS.Store(username, clt)
+
+	NICKS.Unlock()
+
+	clt.nickChanged(oldName)
+}
+
+func link_quit(l *Link, args string) {
+
+	name, _ := split2(args, " ")
+
+	clt, ok := l.remoteClient(name)
+	if !ok {
+		return
+	}
+
+	clt.Close()
+	clt.UpdateInMain(">!disconnect>%s disconnected", clt)
+}
+
+func link_join(l *Link, args string) {
+
+	channelName, name := split2(args, " ")
+
+	clt, ok := l.remoteClient(name)
+	if !ok {
+		return
+	}
+
+	channel, ok := CHANNELS.Load(channelName)
+
+	if !ok {
+		if _, err := ValidChannelname(channelName); err != nil {
+			DEBUG.Printf("%s sent invalid channel %s: %s", l, channelName, err)
+			return
+		}
+
+		// don't leave behind an empty channel that is never shared
+		if LOCALCHANNELS[channelName] {
+			DEBUG.Printf("%s joined local channel %s", l, channelName)
+			return
+		}
+
+		channel, ok = CHANNELS.LoadOrStore(channelName, newChannel(channelName, false))
+		if !ok {
+			DEBUG.Printf("adding %s to CHANNELS from %s", channel, l)
+		}
+	}
+
+	if !channel.linked || channel.contains(clt) {
+		return
+	}
+
+	channel.addClient(clt)
+}
+
+func link_part(l *Link, args string) {
+
+	channelName, name := split2(args, " ")
+
+	clt, ok := l.remoteClient(name)
+	if !ok {
+		return
+	}
+
+	channel, ok := CHANNELS.Load(channelName)
+
+	if ok && channel.linked {
+		channel.removeClient(clt)
+	}
+}
+
+func link_msg(l *Link, args string) {
+	l.deliver(LINE_SAY, args)
+}
+
+func link_action(l *Link, args string) {
+	l.deliver(LINE_ACTION, args)
+}
+
+func link_notice(l *Link, args string) {
+	l.deliver(LINE_NOTICE, args)
+}
+
+// find the channel and remote user of a line sent by the peer
+func (l *Link) channelLine(args string) (*Channel, *Client, string, bool) {
+
+	channelName, rest := split2(args, " ")
+	name, text := split2(rest, " ")
+
+	clt, ok := l.remoteClient(name)
+	if !ok {
+		return nil, nil, "", false
+	}
+
+	channel, ok := CHANNELS.Load(channelName)
+
+	if !ok || !channel.linked || !channel.contains(clt) {
+		return nil, nil, "", false
+	}
+
+	return channel, clt, text, true
+}
+
+// deliver a kind of line (see emote.go) sent by the peer
+func (l *Link) deliver(kind string, args string) {
+
+	if channel, clt, message, ok := l.channelLine(args); ok {
+		channel.deliver(kind, clt, message)
+	}
+}
+
+func link_roll(l *Link, args string) {
+
+	if channel, clt, result, ok := l.channelLine(args); ok {
+		channel.roll(clt, result)
+	}
+}
+
+func link_mode(l *Link, args string) {
+
+	channelName, rest := split2(args, " ")
+	setter, changes := split2(rest, " ")
+
+	channel, ok := CHANNELS.Load(channelName)
+
+	if !ok || !channel.linked {
+		return
+	}
+
+	applied, ok := channel.applyModes(changes)
+
+	if !ok {
+		DEBUG.Printf("%s sent invalid modes %s for %s", l, changes, channel)
+		return
+	}
+
+	if !l.bursting {
+		channel.write(nil, ">"+channel.Name+">!mode>"+setter+" "+hideKey(applied)+"\n")
+	}
+
+	channel.enforceBans()
+}
+
+func link_privmsg(l *Link, args string) {
+
+	to, rest := split2(args, " ")
+	name, message := split2(rest, " ")
+
+	from, ok := l.remoteClient(name)
+	if !ok {
+		return
+	}
+
+	clt, ok := CLIENTS.Load(to)
+
+	if !ok || !clt.isLocal() || !clt.isLogged() {
+		return
+	}
+
+	clt.privateSay(from, message)
+}
+
+func link_topic(l *Link, args string) {
+
+	channelName, rest := split2(args, " ")
+	setter, topic := split2(rest, " ")
+
+	channel, ok := CHANNELS.Load(channelName)
+
+	if !ok || !channel.linked {
+		return
+	}
+
+	channel.setTopic(topic)
+
+	if !l.bursting {
+		channel.write(nil, ">"+channel.Name+">!topic>"+setter+" "+topic+"\n")
+	}
+}
+
+func link_event(l *Link, args string) {
+
+	channelName, rest := split2(args, " ")
+	event, text := split2(rest, " ")
+
+	channel, ok := CHANNELS.Load(channelName)
+
+	if !ok || !channel.linked || !validEvent(event) {
+		return
+	}
+
+	channel.write(nil, shorten255(">"+channel.Name+">!"+event+">@srv "+text+"\n"))
+}
+
+func link_endburst(l *Link, args string) {
+	l.bursting = false
+}
+
+func link_ping(l *Link, args string) {
+	l.send("PONG")
+}
+
+func link_pong(l *Link, args string) {
+	// any line from the peer already refreshes the read deadline
+}
+
+func link_error(l *Link, args string) {
+	WARN.Printf("%s closed the link: %s", l, args)
+	l.conn.Close()
+}
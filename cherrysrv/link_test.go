@@ -0,0 +1,269 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// genPeer links a fake peer server called name and consumes its handshake and burst
+func genPeer(t *testing.T, name string) (out net.Conn, in *bufio.Reader, burst []string) {
+	server, out := net.Pipe()
+
+	in = bufio.NewReader(out)
+
+	go serveLink(server)
+
+	out.SetReadDeadline(time.Now().Add(time.Second))
+
+	hello, err := in.ReadString('\n')
+	fields := strings.Fields(hello)
+	if err != nil || len(fields) != 4 || fields[0] != "SERVER" || fields[1] != SERVERNAME || strings.Contains(hello, LINKKEY) {
+		t.Fatalf("handshake got %q (%v)", hello, err)
+	}
+
+	out.Write([]byte(fmt.Sprintf("SERVER %s %s %s\n", name, "peernonce", VERSION)))
+
+	auth, err := in.ReadString('\n')
+	if err != nil || trim(auth) != "AUTH "+linkProof(SERVERNAME, "peernonce", fields[2]) {
+		t.Fatalf("handshake got %q (%v)", auth, err)
+	}
+
+	out.Write([]byte(fmt.Sprintf("AUTH %s\n", linkProof(name, fields[2], "peernonce"))))
+
+	for {
+		line, err := in.ReadString('\n')
+		if err != nil {
+			t.Fatalf("burst failed with %s", err)
+		}
+
+		line = trim(line)
+		if line == "ENDBURST" {
+			break
+		}
+
+		burst = append(burst, line)
+	}
+
+	out.Write([]byte("ENDBURST\n"))
+
+	return
+}
+
+func TestLink(t *testing.T) {
+	// configure test server
+	init_logger()
+	init_commands()
+	init_link_commands()
+	gentoken = func() string { return "TOKEN" }
+	SERVERNAME = "alpha"
+	LINKKEY = "secret"
+	LOCALCHANNELS["#local"] = true
+	defer delete(LOCALCHANNELS, "#local")
+	main_channel := NewChannelMain("#main")
+	CHANNELS.Store(main_channel.Key(), main_channel)
+
+	c1, out, in := genClient()
+
+	out.Write([]byte("/login @local\n"))
+	expectLines(t, "Login", in, out, ">/login>0>you're now @local", ">#main>!token>TOKEN")
+
+	out.Write([]byte("/join #linked\n"))
+	expectLines(t, "Join", in, out, ">/join>0>@local joined #linked")
+
+	peer, peerIn, burst := genPeer(t, "beta")
+
+	if len(burst) != 3 || !strings.HasPrefix(burst[0], "USER @local ") || burst[1] != "JOIN #linked @local" || burst[2] != "MODE #linked alpha +o @local" {
+		t.Errorf("Burst got %v", burst)
+	}
+
+	peer.Write([]byte("USER @remote 1\n"))
+	expectLines(t, "Remote Login", in, out, ">#main>!login>@remote has joined the server")
+
+	// the peer lines are handled in order, so the join is done once the say arrives
+	peer.Write([]byte("JOIN #local @remote\n"))
+	peer.Write([]byte("MSG #main @remote hello\n"))
+	expectLines(t, "Remote Say", in, out, ">#main>@remote>hello")
+
+	if _, ok := CHANNELS.Load("#local"); ok {
+		t.Errorf("Remote Join created the local only channel #local")
+	}
+
+	peer.Write([]byte("ACTION #main @remote waves\n"))
+	expectLines(t, "Remote Action", in, out, ">#main>*@remote>waves")
+
+	peer.Write([]byte("ROLL #main @remote 2d6: 3 4 = 7\n"))
+	expectLines(t, "Remote Roll", in, out, ">#main>!roll>@remote 2d6: 3 4 = 7")
+
+	peer.Write([]byte("NICK @remote @renamed\n"))
+	expectLines(t, "Remote Nick", in, out, ">#main>!nick>@remote @renamed")
+
+	peer.Write([]byte("NICK @renamed @remote\n"))
+	expectLines(t, "Remote Nick #2", in, out, ">#main>!nick>@renamed @remote")
+
+	peer.Write([]byte("MSG #main @ghost boo\n"))
+	expectLines(t, "Unknown Remote Say", in, out)
+
+	out.Write([]byte("/nusers\n"))
+	expectLines(t, "Network User Count", in, out, ">/nusers>0>2")
+
+	out.Write([]byte("/users #main\n"))
+	expectLines(t, "Network Users", in, out, ">/users #main>1>@local", ">/users #main>0>@remote")
+
+	out.Write([]byte("/say #main hi\n"))
+	expectLines(t, "Local Say", in, out, ">#main>@local>hi")
+
+	peer.SetReadDeadline(time.Now().Add(time.Second))
+	if line, _ := peerIn.ReadString('\n'); line != "MSG #main @local hi\n" {
+		t.Errorf("Local Say Propagation got %q", line)
+	}
+
+	out.Write([]byte("/notice #main brb\n"))
+	expectLines(t, "Local Notice", in, out, ">#main>-@local>brb")
+
+	if line, _ := peerIn.ReadString('\n'); line != "NOTICE #main @local brb\n" {
+		t.Errorf("Local Notice Propagation got %q", line)
+	}
+
+	out.Write([]byte("/hjoin #secret\n"))
+	expectLines(t, "Local Only Join", in, out, ">/hjoin>0>@local hjoined #secret")
+
+	out.Write([]byte("/links\n"))
+	expectLines(t, "Links", in, out, ">/links>1>alpha (this server)", ">/links>0>beta")
+
+	peer.Close()
+	expectLines(t, "Netsplit", in, out, ">#main>!netsplit>@remote lost in netsplit (beta)")
+
+	if _, ok := CLIENTS.Load("@remote"); ok {
+		t.Errorf("Netsplit left @remote in CLIENTS")
+	}
+
+	// an older login on the peer wins the nick
+	peer, peerIn, _ = genPeer(t, "beta")
+
+	peer.Write([]byte("USER @local 1\n"))
+	expectLines(t, "Nick Collision", in, out, ">#main>!collision>@local is in use on beta, disconnecting")
+
+	peer.SetReadDeadline(time.Now().Add(time.Second))
+	if line, _ := peerIn.ReadString('\n'); line != "QUIT @local\n" {
+		t.Errorf("Nick Collision Propagation got %q", line)
+	}
+
+	if clt, ok := CLIENTS.Load("@local"); !ok || clt == c1 || clt.isLocal() {
+		t.Errorf("Nick Collision left %v in CLIENTS", clt)
+	}
+
+	peer.Close()
+
+	// wait for the netsplit so it doesn't overlap other tests
+	for i := 0; i < 100 && !LINKS.IsEmpty(); i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestLinkBadKey(t *testing.T) {
+	init_logger()
+	SERVERNAME = "alpha"
+	LINKKEY = "secret"
+
+	server, out := net.Pipe()
+	in := bufio.NewReader(out)
+
+	go serveLink(server)
+
+	out.SetReadDeadline(time.Now().Add(time.Second))
+
+	hello, _ := in.ReadString('\n')
+	fields := strings.Fields(hello)
+	if len(fields) != 4 {
+		t.Fatalf("handshake got %q", hello)
+	}
+
+	out.Write([]byte(fmt.Sprintf("SERVER beta peernonce %s\n", VERSION)))
+	in.ReadString('\n') // AUTH
+
+	// a proof made with another key
+	LINKKEY = "guess"
+	proof := linkProof("beta", fields[2], "peernonce")
+	LINKKEY = "secret"
+
+	out.Write([]byte(fmt.Sprintf("AUTH %s\n", proof)))
+
+	if line, _ := in.ReadString('\n'); trim(line) != "ERROR bad link key" {
+		t.Errorf("bad key got %q", line)
+	}
+
+	if !LINKS.IsEmpty() {
+		t.Errorf("bad key left a link in LINKS")
+	}
+
+	out.Close()
+}
+
+func Test_linkProof(t *testing.T) {
+	LINKKEY = "secret"
+
+	proof := linkProof("alpha", "n1", "n2")
+
+	if proof != linkProof("alpha", "n1", "n2") {
+		t.Errorf("linkProof() is not stable")
+	}
+
+	// the answer of the other side, or to another challenge, never matches
+	for _, other := range []string{linkProof("beta", "n1", "n2"), linkProof("alpha", "n2", "n1"), linkProof("alpha", "n3", "n2")} {
+		if other == proof {
+			t.Errorf("linkProof() collides: %s", other)
+		}
+	}
+
+	if strings.Contains(proof, LINKKEY) {
+		t.Errorf("linkProof() leaks the key")
+	}
+}
+
+func Test_localWins(t *testing.T) {
+	SERVERNAME = "alpha"
+
+	now := time.Now()
+
+	tests := []struct {
+		name   string
+		local  time.Time
+		remote time.Time
+		peer   string
+		want   bool
+	}{
+		{"local is older", now, now.Add(time.Second), "beta", true},
+		{"remote is older", now.Add(time.Second), now, "beta", false},
+		{"tie, local name is lower", now, now, "beta", true},
+		{"tie, peer name is lower", now, now, "aardvark", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := localWins(tt.local, tt.remote, tt.peer); got != tt.want {
+				t.Errorf("localWins() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// expectLines reads everything the server sends and compares it with expected
+func expectLines(t *testing.T, name string, in *bufio.Reader, out net.Conn, expected ...string) {
+	rets := make(chan []string)
+	go fullRead(in, out, rets)
+	res := <-rets
+
+	if len(res) != len(expected) {
+		t.Errorf("%s got %v, expected %v", name, res, expected)
+		return
+	}
+
+	for i, ex := range expected {
+		if res[i] != ex {
+			t.Errorf("%s got %s, expected %s", name, res[i], ex)
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// Listeners.
+//
+// The server can listen on several addresses at once (i.e. IPv4, IPv6 and a
+// LAN only port), each with its own options, given as -listen addr[,option...]:
+//
+//	net=tcp4|tcp6		restrict the network (tcp, both, by default)
+//	maxconns=N		connections accepted at the same time (0, no limit, by default)
+//			(see also access.go)
+//	anon=false		users must /login with a tripcode (see trip.go)
+//
+// All of them feed the same CLIENTS and CHANNELS.
+
+const LISTEN_RETRY = time.Second // wait after a failed accept
+
+type Listener struct {
+	addr     string
+	network  string // tcp, tcp4 or tcp6
+	maxconns int32  // 0 for no limit
+	anon     bool   // users may log in without a tripcode
+	conns    atomic.Int32
+}
+
+func (l *Listener) String() string {
+	return l.addr
+}
+
+// parse addr[,option...]
+func parseListener(spec string) (*Listener, error) {
+
+	options := strings.Split(spec, ",")
+
+	l := &Listener{
+		addr:    trim(options[0]),
+		network: "tcp",
+		anon:    true,
+	}
+
+	if no(l.addr) {
+		return nil, fmt.Errorf("-listen %s has no address", spec)
+	}
+
+	for _, option := range options[1:] {
+		key, value, _ := strings.Cut(trim(option), "=")
+
+		switch key {
+		case "net":
+			if value != "tcp" && value != "tcp4" && value != "tcp6" {
+				return nil, fmt.Errorf("-listen %s: net must be tcp, tcp4 or tcp6", spec)
+			}
+			l.network = value
+		case "maxconns":
+			maxconns, err := strconv.Atoi(value)
+			if err != nil || maxconns < 0 {
+				return nil, fmt.Errorf("-listen %s: maxconns must be a number", spec)
+			}
+			l.maxconns = int32(maxconns)
+		case "anon":
+			anon, err := strconv.ParseBool(value)
+			if err != nil {
+				return nil, fmt.Errorf("-listen %s: anon must be true or false", spec)
+			}
+			l.anon = anon
+		default:
+			return nil, fmt.Errorf("-listen %s: unknown option %s", spec, key)
+		}
+	}
+
+	return l, nil
+}
+
+// may the client log in without a tripcode?
+func (clt *Client) anonAllowed() bool {
+	return clt.listener == nil || clt.listener.anon
+}
+
+// tell the connection why it's not accepted and close it
+func reject(conn net.Conn, format string, args ...interface{}) {
+
+	conn.SetWriteDeadline(time.Now().Add(WRITETIMEOUT))
+	fmt.Fprintf(conn, ">#main>!rejected>"+format+"\n", args...)
+	conn.Close()
+}
+
+// open the listener, and accept connections in the background
+func (l *Listener) start() error {
+
+	server, err := net.Listen(l.network, l.addr)
+	if err != nil {
+		return err
+	}
+
+	INFO.Printf("Ready to serve on %s://%s", l.network, server.Addr())
+
+	go l.serve(server)
+
+	return nil
+}
+
+func (l *Listener) serve(server net.Listener) {
+
+	for {
+		conn, err := server.Accept()
+		if errors.Is(err, net.ErrClosed) {
+			return
+		}
+
+		if err != nil {
+			WARN.Printf("Unable to accept connection on %s (%s)", l, err)
+			time.Sleep(LISTEN_RETRY)
+			continue
+		}
+
+		if reason, ok := admit(conn, l); !ok {
+			WARN.Printf("rejecting %s on %s: %s", conn.RemoteAddr(), l, reason)
+			reject(conn, "%s", reason)
+			continue
+		}
+
+		go func() {
+			defer release(conn, l)
+
+			newClient(conn, l).clientLoop()
+		}()
+	}
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"bufio"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseListener(t *testing.T) {
+
+	tests := []struct {
+		spec     string
+		addr     string
+		network  string
+		maxconns int32
+		anon     bool
+		ok       bool
+	}{
+		{"0.0.0.0:1512", "0.0.0.0:1512", "tcp", 0, true, true},
+		{"[::]:1512,net=tcp6", "[::]:1512", "tcp6", 0, true, true},
+		{"192.168.1.2:1513, maxconns=50, anon=false", "192.168.1.2:1513", "tcp", 50, false, true},
+		{"", "", "", 0, false, false},
+		{":1512,net=udp", "", "", 0, false, false},
+		{":1512,maxconns=lots", "", "", 0, false, false},
+		{":1512,anon=maybe", "", "", 0, false, false},
+		{":1512,color=red", "", "", 0, false, false},
+	}
+
+	for _, test := range tests {
+		l, err := parseListener(test.spec)
+
+		if (err == nil) != test.ok {
+			t.Fatalf("parseListener(%s) failed with %v", test.spec, err)
+		}
+
+		if err == nil && (l.addr != test.addr || l.network != test.network || l.maxconns != test.maxconns || l.anon != test.anon) {
+			t.Fatalf("parseListener(%s) = %+v", test.spec, l)
+		}
+	}
+}
+
+func TestListener(t *testing.T) {
+	// configure test server
+	init_logger()
+	init_commands()
+	gentoken = func() string { return "TOKEN" }
+	main_channel := NewChannelMain("#main")
+	CHANNELS.Store(main_channel.Key(), main_channel)
+
+	l, _ := parseListener("127.0.0.1:0,maxconns=1,anon=false")
+
+	server, err := net.Listen(l.network, l.addr)
+	if err != nil {
+		t.Fatalf("unable to listen: %s", err)
+	}
+	defer server.Close()
+
+	go l.serve(server)
+
+	readLine := func(name string, reader *bufio.Reader, expected string) {
+		line, err := reader.ReadString('\n')
+
+		if err != nil || !strings.HasPrefix(line, expected) {
+			t.Fatalf("%s got %q (%v), expected %s", name, line, err, expected)
+		}
+	}
+
+	conn, err := net.Dial("tcp", server.Addr().String())
+	if err != nil {
+		t.Fatalf("unable to connect: %s", err)
+	}
+
+	reader := bufio.NewReader(conn)
+	readLine("Welcome", reader, ">#main>!welcome>")
+
+	conn.Write([]byte("/login @anon\n"))
+	readLine("Anonymous Login", reader, ">/login>0>this server requires /login <account>#secret")
+
+	full, err := net.Dial("tcp", server.Addr().String())
+	if err != nil {
+		t.Fatalf("unable to connect: %s", err)
+	}
+
+	readLine("Full", bufio.NewReader(full), ">#main>!rejected>this server is full")
+	full.Close()
+
+	conn.Write([]byte("/logoff\n"))
+	readLine("Logoff", reader, ">/logoff>0>Goodbye")
+	conn.Close()
+
+	for i := 0; i < 50 && l.conns.Load() > 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if l.conns.Load() != 0 {
+		t.Fatalf("%d connections still counted", l.conns.Load())
+	}
+}
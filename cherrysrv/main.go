@@ -22,7 +22,6 @@ import (
 	"flag"
 	"fmt"
 	"log"
-	"net"
 	"os"
 	"os/signal"
 	"runtime"
@@ -42,11 +41,12 @@ https://github.com/madflojo/tasks
 */
 
 var (
-	WARN   CustomLogger
-	INFO   CustomLogger
-	ERROR  CustomLogger
-	DEBUG  CustomLogger
-	LOGGER CustomLogger
+	WARN       CustomLogger
+	INFO       CustomLogger
+	ERROR      CustomLogger
+	DEBUG      CustomLogger
+	LOGGER     CustomLogger
+	MODERATION CustomLogger
 )
 
 type do_command func(*Client, string)
@@ -62,46 +62,125 @@ var (
 )
 
 const (
-	VERSION   = "3.0.2"
+	VERSION   = "3.12.0"
 	STRINGVER = "cherry srv " + VERSION + "/" + runtime.GOOS + " (c) Roger Sen 2023"
 )
 
 func main() {
 
 	var srvaddr string
+	var listens stringList
+	var listeners []*Listener
+	var linkaddr string
+	var peers stringList
+	var localchans string
+	var ingestaddr string
+	var ingestkeys stringList
+	var sysops stringList
 	var help bool
 
+	hostname, _ := os.Hostname()
+
 	flag.StringVar(&srvaddr, "srvaddr", "", "<address:port> for tcp4 server")
+	flag.Var(&listens, "listen", "<address:port>[,net=tcp4|tcp6][,maxconns=N][,anon=false] to serve on (repeatable)")
+	flag.StringVar(&SERVERNAME, "name", hostname, "name of this server for linked servers")
+	flag.StringVar(&linkaddr, "linkaddr", "", "<address:port> to accept links from peer servers")
+	flag.Var(&peers, "link", "<address:port> of a peer server to link to (repeatable)")
+	flag.StringVar(&LINKKEY, "linkkey", "", "shared secret between linked servers")
+	flag.StringVar(&localchans, "localchans", "", "comma separated #channels never shared with peers")
+	flag.IntVar(&OUTQUEUE, "outqueue", OUTQUEUE, "lines queued for each client before overflowing")
+	flag.DurationVar(&WRITETIMEOUT, "writetimeout", WRITETIMEOUT, "time allowed to write a line to a client")
+	flag.DurationVar(&RESUMEGRACE, "resumegrace", RESUMEGRACE, "time a lost session can be resumed (0 to disable)")
+	flag.StringVar(&OVERFLOW, "overflow", OVERFLOW, "when a client overflows its queue: drop (oldest lines) or disconnect")
+	flag.StringVar(&DATADIR, "datadir", DATADIR, "directory where registered channels are stored")
+	flag.StringVar(&FILTERFILE, "filter", "", "file with the words filtered in channels and private messages")
+	flag.StringVar(&FILTERPOLICY, "filterpolicy", FILTERPOLICY, "word filter policy by default: off, mask, reject or mute[:hits]")
+	flag.IntVar(&FILTERMUTE, "filtermute", FILTERMUTE, "word filter hits before being muted")
+	flag.StringVar(&TRIPKEY, "tripkey", "", "secret key to generate tripcodes for /login @nick#secret (shared by linked servers)")
+	flag.StringVar(&ingestaddr, "ingestaddr", "", "<address:port> to accept events over http")
+	flag.Var(&ingestkeys, "ingestkey", "source:key allowed to post events (repeatable)")
+	flag.IntVar(&INGESTRATE, "ingestrate", INGESTRATE, "events per minute allowed to each source")
+	flag.IntVar(&MAXCONNS, "maxconns", MAXCONNS, "connections to the server at the same time (0 for no limit)")
+	flag.IntVar(&MAXPERIP, "maxperip", MAXPERIP, "connections from the same address at the same time (0 for no limit)")
+	flag.Var(&sysops, "sysop", "!tripcode of a sysop, that can ban addresses (repeatable)")
 	flag.BoolVar(&help, "help", false, "show this help")
 
 	flag.Parse()
 
-	if help || len(srvaddr) == 0 {
+	if help || (len(srvaddr) == 0 && len(listens) == 0) {
 		flag.PrintDefaults()
 		return
 	}
 
+	if OVERFLOW != OVERFLOW_DROP && OVERFLOW != OVERFLOW_DISCONNECT {
+		fmt.Println("-overflow must be drop or disconnect")
+		return
+	}
+
+	if _, ok := parsePolicy(FILTERPOLICY); !ok || FILTERMUTE < 1 {
+		fmt.Println("-filterpolicy must be off, mask, reject or mute[:hits] and -filtermute at least 1")
+		return
+	}
+
+	if len(srvaddr) > 0 {
+		listeners = append(listeners, &Listener{addr: srvaddr, network: "tcp4", anon: true})
+	}
+
+	for _, spec := range listens {
+		listener, err := parseListener(spec)
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		listeners = append(listeners, listener)
+	}
+
+	for _, trip := range sysops {
+		if err := addSysop(trip); err != nil {
+			fmt.Println(err)
+			return
+		}
+	}
+
+	for _, sourcekey := range ingestkeys {
+		if err := addIngestKey(sourcekey); err != nil {
+			fmt.Println(err)
+			return
+		}
+	}
+
+	if len(ingestaddr) > 0 && (len(INGESTKEYS) == 0 || INGESTRATE < 1) {
+		fmt.Println("-ingestaddr requires at least an -ingestkey and an -ingestrate of 1 or more")
+		return
+	}
+
+	linking := len(linkaddr) > 0 || len(peers) > 0
+
+	if linking && (len(LINKKEY) == 0 || len(SERVERNAME) == 0 || strings.ContainsAny(SERVERNAME, " \t")) {
+		fmt.Println("linking requires -linkkey and a -name without spaces")
+		return
+	}
+
+	for _, channelName := range strings.Split(localchans, ",") {
+		if channelName = trim(channelName); len(channelName) > 0 {
+			LOCALCHANNELS[channelName] = true
+		}
+	}
+
 	init_logger()
 	init_os_signal()
 	init_commands()
 	init_scheduler()
 	init_time()
 
-	TCPAddr, err := net.ResolveTCPAddr("tcp", srvaddr)
-	if err != nil {
-		ERROR.Fatalf("Unable to resolve address on tcp4://%s (%s)", srvaddr, err)
-		return
-	}
-
-	server, err := net.ListenTCP("tcp4", TCPAddr)
-	if err != nil {
-		ERROR.Fatalf("Unable to serve on tcp4://%s (%s)", srvaddr, err)
-		return
+	if len(FILTERFILE) > 0 {
+		if err := init_filter(FILTERFILE); err != nil {
+			ERROR.Fatalf("Unable to load the word filter from %s (%s)", FILTERFILE, err)
+			return
+		}
 	}
-	defer server.Close()
 
 	INFO.Printf("Started %s", STRINGVER)
-	INFO.Printf("Ready to serve on tcp://%s (tcp)", srvaddr)
 
 	// We create tha main channel
 
@@ -109,14 +188,43 @@ func main() {
 	CHANNELS.Store(main_channel.Key(), main_channel)
 	DEBUG.Printf("adding %s to CHANNELS", main_channel)
 
-	for {
-		conn, err := server.AcceptTCP()
-		if err != nil {
-			WARN.Printf("Unable to accept connection on %s (%s)", srvaddr, err)
-			continue
+	if err := load_channels(); err != nil {
+		ERROR.Fatalf("Unable to load registered channels from %s (%s)", DATADIR, err)
+		return
+	}
+
+	if err := load_bans(); err != nil {
+		ERROR.Fatalf("Unable to load address bans from %s (%s)", DATADIR, err)
+		return
+	}
+
+	if err := load_ignores(); err != nil {
+		ERROR.Fatalf("Unable to load ignore lists from %s (%s)", DATADIR, err)
+		return
+	}
+
+	if len(ingestaddr) > 0 {
+		if err := init_ingest(ingestaddr); err != nil {
+			ERROR.Fatalf("Unable to ingest events on %s (%s)", ingestaddr, err)
+			return
 		}
-		go newClient(conn).clientLoop()
 	}
+
+	if linking {
+		if err := init_links(linkaddr, peers); err != nil {
+			ERROR.Fatalf("Unable to start links (%s)", err)
+			return
+		}
+	}
+
+	for _, listener := range listeners {
+		if err := listener.start(); err != nil {
+			ERROR.Fatalf("Unable to serve on %s://%s (%s)", listener.network, listener, err)
+			return
+		}
+	}
+
+	select {} // clients are served by the listeners from now on
 }
 
 /*
@@ -130,6 +238,7 @@ func init_logger() {
 	ERROR = NewCustomLogger("error", "ERROR: ", log.LstdFlags)
 	LOGGER = NewCustomLogger("logger", "LOGGER: ", log.LstdFlags)
 	DEBUG = NewCustomLogger("debug", "DEBUG: ", log.LstdFlags|log.Lshortfile)
+	MODERATION = NewCustomLogger("moderation", "MODERATION: ", log.LstdFlags)
 
 	value, ok := os.LookupEnv("LOG_LEVEL")
 
@@ -169,6 +278,8 @@ func update_log_level(logger string, onoff string) error {
 		ERROR.SetActive(newstatus)
 	case "debug":
 		DEBUG.SetActive(newstatus)
+	case "moderation":
+		MODERATION.SetActive(newstatus)
 
 	default:
 		LOGGER.Printf("unable to update logger. '%s' is not a valid loglevel", logger)
@@ -230,10 +341,12 @@ func SignalHandler(sigchan chan os.Signal) {
 		case syscall.SIGTERM:
 			WARN.Println("Got SIGTERM. Program will terminate cleanly now.")
 			Broadcast(">#main>!shutdown>Shutting down the server, it will re-start in a few minutes")
+			FlushAll(2 * time.Second)
 			os.Exit(143)
 		case syscall.SIGINT:
 			WARN.Println("Got SIGINT. Program will terminate cleanly now.")
 			Broadcast(">#main>!shutdown>Shutting down the server, it will re-start in a few minutes")
+			FlushAll(2 * time.Second)
 			os.Exit(137)
 		default:
 			INFO.Printf("Received signal %s. No action taken.", signal)
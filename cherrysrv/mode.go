@@ -0,0 +1,478 @@
+package main
+
+import (
+	"sort"
+	"strings"
+)
+
+// channel modes
+const (
+	MODE_MODERATED = 'm' // only ops and voiced users may speak
+	MODE_ANNOUNCE  = 'a' // only ops may speak
+	MODE_NOEVENTS  = 'n' // no join/leave/nick/login events in the channel
+	MODE_OP        = 'o' // +o @user, user is a channel operator
+	MODE_VOICE     = 'v' // +v @user|!trip, user may speak in a moderated channel
+	MODE_BAN       = 'b' // +b @user, user may not join the channel
+	MODE_KEY       = 'k' // +k key, joining requires /join #channel key
+	MODE_QUIET     = 'q' // +q @user|!trip, user may not speak (set by the word filter)
+	MODE_FILTER    = 'f' // +f policy, word filter policy (see filter.go)
+	MODE_ALLOW     = 'w' // +w !trip, only the allowed tripcodes may join (see trip.go)
+)
+
+// modes that are set on the channel itself, in the order they are listed
+const CHANNEL_MODES = "amn"
+
+// is the mode set on the channel?
+func (c *Channel) hasMode(mode byte) bool {
+	c.RLock()
+	defer c.RUnlock()
+
+	return c.modes[string(mode)]
+}
+
+// return the modes set on the channel itself, i.e. +mn
+func (c *Channel) flagString() string {
+	c.RLock()
+	defer c.RUnlock()
+
+	output := "+"
+
+	for i := 0; i < len(CHANNEL_MODES); i++ {
+		if c.modes[CHANNEL_MODES[i:i+1]] {
+			output += string(CHANNEL_MODES[i])
+		}
+	}
+
+	return output
+}
+
+// return the channel modes, i.e. +mnf reject
+func (c *Channel) modeString() string {
+
+	output := c.flagString()
+
+	c.RLock()
+	defer c.RUnlock()
+
+	if len(c.key) > 0 { // the key itself is a secret
+		output += string(MODE_KEY)
+	}
+
+	if len(c.filter) > 0 {
+		output += string(MODE_FILTER) + " " + c.filter
+	}
+
+	return output
+}
+
+func (c *Channel) isOp(name string) bool {
+	c.RLock()
+	defer c.RUnlock()
+
+	return c.ops[name]
+}
+
+// is clt in one of the channel lists by name or by tripcode? The caller holds the lock.
+func (c *Channel) listed(list map[string]bool, clt *Client) bool {
+	return list[clt.Name] || (len(clt.trip) > 0 && list["!"+clt.trip])
+}
+
+// can clt talk in the channel with its current modes?
+func (c *Channel) canSpeak(clt *Client) bool {
+	c.RLock()
+	defer c.RUnlock()
+
+	switch {
+	case c.ops[clt.Name]:
+		return true
+	case c.listed(c.muted, clt):
+		return false
+	case c.modes[string(MODE_ANNOUNCE)]:
+		return false
+	case c.modes[string(MODE_MODERATED)]:
+		return c.listed(c.voiced, clt)
+	}
+
+	return true
+}
+
+// should membership events be shown in the channel?
+func (c *Channel) showEvents() bool {
+	return !c.hasMode(MODE_NOEVENTS)
+}
+
+// is mode known, with a valid argument if it needs one?
+func validMode(on bool, mode byte, arg string) bool {
+
+	switch mode {
+	case MODE_OP:
+		_, err := ValidUsername(arg)
+		return err == nil
+	case MODE_BAN, MODE_VOICE, MODE_QUIET:
+		_, err := ValidUsername(arg)
+		return err == nil || ValidTrip(arg)
+	case MODE_ALLOW:
+		return ValidTrip(arg)
+	case MODE_KEY:
+		return !on || (len(arg) > 0 && !strings.ContainsAny(arg, " >"))
+	case MODE_FILTER:
+		_, ok := parsePolicy(arg)
+		return !on || ok
+	}
+
+	return strings.IndexByte(CHANNEL_MODES, mode) >= 0
+}
+
+// apply a single valid mode change (i.e. '+', 'm' or '-', 'o', "@john")
+func (c *Channel) setMode(on bool, mode byte, arg string) {
+	c.Lock()
+	defer c.Unlock()
+
+	list := c.modes
+
+	switch mode {
+	case MODE_OP:
+		list = c.ops
+	case MODE_VOICE:
+		list = c.voiced
+	case MODE_BAN:
+		list = c.bans
+	case MODE_ALLOW:
+		list = c.allowed
+	case MODE_QUIET:
+		list = c.muted
+		delete(c.hits, arg)
+	case MODE_KEY:
+		c.key = ""
+		if on {
+			c.key = arg
+		}
+		return
+	case MODE_FILTER:
+		c.filter = ""
+		if on {
+			c.filter = arg
+		}
+		return
+	default:
+		arg = string(mode)
+	}
+
+	if on {
+		list[arg] = true
+	} else {
+		delete(list, arg)
+	}
+
+	if mode == MODE_OP {
+		if clt, ok := CLIENTS.Load(arg); ok && len(clt.trip) > 0 {
+			if on {
+				c.opTrips[clt.trip] = true
+			} else {
+				delete(c.opTrips, clt.trip)
+			}
+		}
+	}
+}
+
+// drop the name of clt, that left the channel, from the lists of ops, voiced
+// and muted users, so nobody gets them by taking the name. Voice and quiet
+// stay with its tripcode until it joins again.
+func (c *Channel) forgetMember(clt *Client) {
+	c.Lock()
+
+	delete(c.ops, clt.Name)
+
+	changed := false
+
+	for _, list := range []map[string]bool{c.voiced, c.muted} {
+		if !list[clt.Name] {
+			continue
+		}
+
+		delete(list, clt.Name)
+		if len(clt.trip) > 0 {
+			list["!"+clt.trip] = true
+		}
+		changed = true
+	}
+
+	c.Unlock()
+
+	if changed {
+		c.changed()
+	}
+}
+
+// give back to clt, that joined, the voice and quiet of its tripcode, and ops
+// if it has the tripcode of an operator
+func (c *Channel) restoreModes(clt *Client) {
+
+	if len(clt.trip) == 0 {
+		return
+	}
+
+	c.Lock()
+
+	changed := false
+
+	for _, list := range []map[string]bool{c.voiced, c.muted} {
+		if list["!"+clt.trip] {
+			delete(list, "!"+clt.trip)
+			list[clt.Name] = true
+			changed = true
+		}
+	}
+
+	restore := !c.ops[clt.Name] && (c.opTrips[clt.trip] || c.owner == clt.trip)
+
+	c.Unlock()
+
+	if changed && !restore {
+		c.changed()
+	}
+
+	if !restore {
+		return
+	}
+
+	c.setMode(true, MODE_OP, clt.Name)
+	c.changed()
+
+	if c.linked && clt.isLocal() {
+		linkBroadcast("MODE %s %s +o %s", c, clt, clt)
+	}
+}
+
+// is clt banned by name or by tripcode?
+func (c *Channel) isBanned(clt *Client) bool {
+	c.RLock()
+	defer c.RUnlock()
+
+	return c.bans[clt.Name] || (len(clt.trip) > 0 && c.bans["!"+clt.trip])
+}
+
+// can clt join when only some tripcodes are allowed? Ops, and operators
+// coming back with their tripcode, always can.
+func (c *Channel) isAllowed(clt *Client) bool {
+	c.RLock()
+	defer c.RUnlock()
+
+	if len(c.allowed) == 0 || c.ops[clt.Name] {
+		return true
+	}
+
+	return len(clt.trip) > 0 && (c.allowed["!"+clt.trip] || c.opTrips[clt.trip] || c.owner == clt.trip)
+}
+
+// can someone join with this key?
+func (c *Channel) keyMatches(key string) bool {
+	c.RLock()
+	defer c.RUnlock()
+
+	return len(c.key) == 0 || c.key == key
+}
+
+// remove local members that have been banned
+func (c *Channel) enforceBans() {
+
+	for _, clt := range c.members() {
+		if clt.isLocal() && c.isBanned(clt) {
+			clt.Say(">%s>!banned>you have been banned from %s", c, c)
+			c.removeClient(clt)
+			c.linkPart(clt)
+		}
+	}
+}
+
+// return the sorted names in one of the channel lists
+func (c *Channel) sortedNames(list map[string]bool) (output []string) {
+	c.RLock()
+	defer c.RUnlock()
+
+	for name := range list {
+		output = append(output, name)
+	}
+
+	sort.Strings(output)
+
+	return output
+}
+
+// follow a user that changed name
+func (c *Channel) renameMember(oldName string, newName string) {
+	c.Lock()
+
+	renamed := false
+
+	for _, list := range []map[string]bool{c.ops, c.voiced, c.muted} {
+		if list[oldName] {
+			delete(list, oldName)
+			list[newName] = true
+			renamed = true
+		}
+	}
+
+	c.Unlock()
+
+	if renamed {
+		c.changed()
+	}
+}
+
+// list the mode changes that recreate the channel modes, ops and voices
+func (c *Channel) modeChanges() (output []string) {
+
+	if modes := c.flagString(); modes != "+" {
+		output = append(output, modes)
+	}
+
+	c.RLock()
+	key, filter := c.key, c.filter
+	c.RUnlock()
+
+	if len(key) > 0 {
+		output = append(output, "+k "+key)
+	}
+
+	if len(filter) > 0 {
+		output = append(output, "+f "+filter)
+	}
+
+	for _, list := range []struct {
+		mode  string
+		names map[string]bool
+	}{{"+o", c.ops}, {"+v", c.voiced}, {"+b", c.bans}, {"+q", c.muted}, {"+w", c.allowed}} {
+		for _, name := range c.sortedNames(list.names) {
+			output = append(output, list.mode+" "+name)
+		}
+	}
+
+	return output
+}
+
+// apply changes like "+mn", "-a" or "+o @john" and return the ones that were
+// valid, ready to be announced.
+func (c *Channel) applyModes(changes string) (applied string, ok bool) {
+
+	flags, user := split2(changes, " ")
+
+	if len(flags) < 2 || (flags[0] != '+' && flags[0] != '-') {
+		return "", false
+	}
+
+	on := flags[0] == '+'
+
+	for i := 1; i < len(flags); i++ {
+		if !validMode(on, flags[i], user) {
+			return "", false
+		}
+	}
+
+	for i := 1; i < len(flags); i++ {
+		c.setMode(on, flags[i], user)
+	}
+
+	c.changed()
+
+	return changes, true
+}
+
+// don't tell everybody the key in "+k key"
+func hideKey(changes string) string {
+
+	flags, _ := split2(changes, " ")
+
+	if flags[0] == '+' && strings.IndexByte(flags, MODE_KEY) >= 0 {
+		return flags
+	}
+
+	return changes
+}
+
+// show or change the modes of a channel
+func do_mode(clt *Client, args string) {
+
+	if !clt.isLogged() {
+		clt.Say(">/mode>0>/mode requires you to be logged")
+
+		return
+	}
+
+	if no(args) {
+		clt.Say(">/mode>0>/mode <#channel> [+|-][amnovbqkfw] [@user|!trip|key|policy]")
+
+		return
+	}
+
+	channelName, changes := split2(args, " ")
+
+	channel, ok := CHANNELS.Load(channelName)
+
+	if !ok {
+		clt.Say(">/mode>0>%s is not a valid channel", channelName)
+		return
+	}
+
+	if no(changes) {
+		clt.Say(">/mode>0>%s %s", channel, channel.modeString())
+		return
+	}
+
+	if !channel.isOp(clt.Name) {
+		clt.Say(">/mode>0>you must be an operator of %s to change its modes", channel)
+		return
+	}
+
+	applied, ok := channel.applyModes(changes)
+
+	if !ok {
+		clt.Say(">/mode>0>/mode <#channel> [+|-][amnovbqkfw] [@user|!trip|key|policy]")
+		return
+	}
+
+	if channel.linked {
+		linkBroadcast("MODE %s %s %s", channel, clt, applied)
+	}
+
+	applied = hideKey(applied)
+
+	channel.write(clt, ">"+channel.Name+">!mode>"+clt.Name+" "+applied+"\n")
+	channel.enforceBans()
+
+	INFO.Printf("%s set %s %s", clt, channel, applied)
+}
+
+// show who is banned from a channel
+func do_bans(clt *Client, args string) {
+
+	if !clt.isLogged() {
+		clt.Say(">/bans>0>/bans requires you to be logged")
+
+		return
+	}
+
+	if no(args) {
+		clt.Say(">/bans>0>/bans <#channel>")
+
+		return
+	}
+
+	channelName, _ := split2(args, " ")
+
+	channel, ok := CHANNELS.Load(channelName)
+
+	if !ok {
+		clt.Say(">/bans>0>%s is not a valid channel", channelName)
+		return
+	}
+
+	names := channel.sortedNames(channel.bans)
+
+	if len(names) == 0 {
+		clt.Say(">/bans>0>nobody is banned from %s", channel)
+		return
+	}
+
+	clt.SayN(">/bans>", names)
+}
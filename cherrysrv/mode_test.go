@@ -0,0 +1,150 @@
+package main
+
+import "testing"
+
+func TestModes(t *testing.T) {
+	// configure test server
+	init_logger()
+	init_commands()
+	gentoken = func() string { return "TOKEN" }
+	main_channel := NewChannelMain("#main")
+	CHANNELS.Store(main_channel.Key(), main_channel)
+
+	_, out1, in1 := genClient()
+	_, out2, in2 := genClient()
+
+	out1.Write([]byte("/login @op\n"))
+	expectLines(t, "Login", in1, out1, ">/login>0>you're now @op", ">#main>!token>TOKEN")
+	expectLines(t, "Login Notice", in2, out2, ">#main>!login>@op has joined the server")
+
+	out2.Write([]byte("/login @user\n"))
+	expectLines(t, "Login #2", in2, out2, ">/login>0>you're now @user", ">#main>!token>TOKEN")
+	expectLines(t, "Login Notice #2", in1, out1, ">#main>!login>@user has joined the server")
+
+	out1.Write([]byte("/join #news\n"))
+	expectLines(t, "Create Channel", in1, out1, ">/join>0>@op joined #news")
+
+	out2.Write([]byte("/join #news\n"))
+	expectLines(t, "Join", in2, out2, ">#news>@user>joined the channel")
+	expectLines(t, "Join Notice", in1, out1, ">#news>@user>joined the channel")
+
+	out2.Write([]byte("/mode #news +m\n"))
+	expectLines(t, "Mode Not Op", in2, out2, ">/mode>0>you must be an operator of #news to change its modes")
+
+	out1.Write([]byte("/mode #news +mx\n"))
+	expectLines(t, "Mode Unknown", in1, out1, ">/mode>0>/mode <#channel> [+|-][amnovbqkfw] [@user|!trip|key|policy]")
+
+	out1.Write([]byte("/mode #news +mn\n"))
+	expectLines(t, "Mode Set", in1, out1, ">#news>!mode>@op +mn")
+	expectLines(t, "Mode Set Notice", in2, out2, ">#news>!mode>@op +mn")
+
+	out2.Write([]byte("/mode #news\n"))
+	expectLines(t, "Mode List", in2, out2, ">/mode>0>#news +mn")
+
+	out2.Write([]byte("/say #news hello\n"))
+	expectLines(t, "Moderated Say", in2, out2, ">/say>0>#news is moderated, only operators and voiced users can write")
+
+	out1.Write([]byte("/mode #news +v @user\n"))
+	expectLines(t, "Voice", in1, out1, ">#news>!mode>@op +v @user")
+	expectLines(t, "Voice Notice", in2, out2, ">#news>!mode>@op +v @user")
+
+	out2.Write([]byte("/say #news hello\n"))
+	expectLines(t, "Voiced Say", in2, out2, ">#news>@user>hello")
+	expectLines(t, "Voiced Say Notice", in1, out1, ">#news>@user>hello")
+
+	out1.Write([]byte("/mode #news -m+a\n"))
+	expectLines(t, "Mode Bad Syntax", in1, out1, ">/mode>0>/mode <#channel> [+|-][amnovbqkfw] [@user|!trip|key|policy]")
+
+	out1.Write([]byte("/mode #news +a\n"))
+	expectLines(t, "Announce", in1, out1, ">#news>!mode>@op +a")
+	expectLines(t, "Announce Notice", in2, out2, ">#news>!mode>@op +a")
+
+	out2.Write([]byte("/say #news hello again\n"))
+	expectLines(t, "Announce Say", in2, out2, ">/say>0>#news is announce only, only operators can write")
+
+	out1.Write([]byte("/say #news news!\n"))
+	expectLines(t, "Op Say", in1, out1, ">#news>@op>news!")
+	expectLines(t, "Op Say Notice", in2, out2, ">#news>@op>news!")
+
+	out2.Write([]byte("/leave #news\n"))
+	expectLines(t, "Quiet Leave", in2, out2, ">/leave>0>@user left #news")
+	expectLines(t, "Quiet Leave Notice", in1, out1)
+
+	out1.Write([]byte("/logoff\n"))
+	expectLines(t, "Logoff", in1, out1, ">/logoff>0>Goodbye @op")
+
+	out2.Write([]byte("/logoff\n"))
+	expectLines(t, "Logoff #2", in2, out2, ">#main>!logoff>@op is leaving", ">/logoff>0>Goodbye @user")
+}
+
+// ops, voice and quiet stay with the user, nobody gets them by taking the name
+func TestModesFollowTheUser(t *testing.T) {
+	// configure test server
+	init_logger()
+	init_commands()
+	gentoken = func() string { return "TOKEN" }
+	main_channel := NewChannelMain("#main")
+	CHANNELS.Store(main_channel.Key(), main_channel)
+
+	TRIPKEY = "key"
+	defer func() { TRIPKEY = "" }()
+
+	_, out1, in1 := genClient()
+	_, out2, in2 := genClient()
+
+	out1.Write([]byte("/login @alice\n"))
+	expectLines(t, "Login", in1, out1, ">/login>0>you're now @alice", ">#main>!token>TOKEN")
+	expectLines(t, "Login Notice", in2, out2, ">#main>!login>@alice has joined the server")
+
+	out2.Write([]byte("/login @bob#secret\n"))
+	expectLines(t, "Login #2", in2, out2, ">/login>0>you're now @bob", ">#main>!token>TOKEN")
+	expectLines(t, "Login Notice #2", in1, out1, ">#main>!login>@bob has joined the server")
+
+	out1.Write([]byte("/join #retro\n"))
+	expectLines(t, "Create Channel", in1, out1, ">/join>0>@alice joined #retro")
+
+	out1.Write([]byte("/mode #retro +mn\n"))
+	expectLines(t, "Mode Set", in1, out1, ">#retro>!mode>@alice +mn")
+
+	out2.Write([]byte("/join #retro\n"))
+	expectLines(t, "Join", in2, out2, ">/join>0>@bob joined #retro")
+
+	out1.Write([]byte("/mode #retro +v @bob\n"))
+	expectLines(t, "Voice", in1, out1, ">#retro>!mode>@alice +v @bob")
+	expectLines(t, "Voice Notice", in2, out2, ">#retro>!mode>@alice +v @bob")
+
+	// the voice waits for the tripcode of bob while he's away
+	out2.Write([]byte("/leave #retro\n"))
+	expectLines(t, "Leave", in2, out2, ">/leave>0>@bob left #retro")
+
+	out2.Write([]byte("/join #retro\n"))
+	expectLines(t, "Join Again", in2, out2, ">/join>0>@bob joined #retro")
+
+	out2.Write([]byte("/say #retro hello\n"))
+	expectLines(t, "Voiced Say", in2, out2, ">#retro>@bob>hello")
+	expectLines(t, "Voiced Say Notice", in1, out1, ">#retro>@bob>hello")
+
+	// the ops of alice go with her
+	out1.Write([]byte("/logoff\n"))
+	expectLines(t, "Logoff", in1, out1, ">/logoff>0>Goodbye @alice")
+	expectLines(t, "Logoff Notice", in2, out2, ">#main>!logoff>@alice is leaving")
+
+	_, out3, in3 := genClient()
+
+	out3.Write([]byte("/login @alice\n"))
+	expectLines(t, "Squatter Login", in3, out3, ">/login>0>you're now @alice", ">#main>!token>TOKEN")
+	expectLines(t, "Squatter Login Notice", in2, out2, ">#main>!login>@alice has joined the server")
+
+	out3.Write([]byte("/join #retro\n"))
+	expectLines(t, "Squatter Join", in3, out3, ">/join>0>@alice joined #retro")
+
+	out3.Write([]byte("/mode #retro +b @bob\n"))
+	expectLines(t, "Squatter Mode", in3, out3, ">/mode>0>you must be an operator of #retro to change its modes")
+
+	out3.Write([]byte("/logoff\n"))
+	expectLines(t, "Squatter Logoff", in3, out3, ">/logoff>0>Goodbye @alice")
+	expectLines(t, "Squatter Logoff Notice", in2, out2, ">#main>!logoff>@alice is leaving")
+
+	out2.Write([]byte("/logoff\n"))
+	expectLines(t, "Logoff #2", in2, out2, ">/logoff>0>Goodbye @bob")
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// what to do when a connection can't keep up with its output
+const (
+	OVERFLOW_DROP       = "drop"       // discard the oldest queued line
+	OVERFLOW_DISCONNECT = "disconnect" // drop the connection as a slow consumer
+	OVERFLOW_BLOCK      = "block"      // wait for the writer, used by links
+)
+
+// output settings, changed by command line flags
+var (
+	OUTQUEUE     = 128              // lines queued per connection
+	LINKQUEUE    = 4096             // lines queued per link, enough for a burst
+	WRITETIMEOUT = 30 * time.Second // time allowed to write a line
+	OVERFLOW     = OVERFLOW_DROP    // policy for client connections
+)
+
+// outbox is a bounded queue of lines sent to a connection by its own writer
+// goroutine, so nobody else ever blocks on the socket.
+type outbox struct {
+	conn     net.Conn
+	lines    chan string
+	done     chan struct{}       // closed to stop accepting lines
+	stop     chan struct{}       // closed to stop the writer but keep queueing
+	flushed  chan struct{}       // closed when the writer is gone
+	policy   string              // OVERFLOW_DROP, OVERFLOW_DISCONNECT, OVERFLOW_BLOCK
+	encode   func(string) string // applied by the writer, queued lines stay plain text
+	owner    fmt.Stringer        // for logging
+	detached atomic.Bool         // the connection is gone, lines are kept for later
+	closing  sync.Once
+	stopping sync.Once
+}
+
+func newOutbox(conn net.Conn, owner fmt.Stringer, policy string) *outbox {
+
+	size := OUTQUEUE
+	if policy == OVERFLOW_BLOCK {
+		size = LINKQUEUE
+	}
+
+	out := &outbox{
+		conn:    conn,
+		lines:   make(chan string, size),
+		done:    make(chan struct{}),
+		stop:    make(chan struct{}),
+		flushed: make(chan struct{}),
+		policy:  policy,
+		owner:   owner,
+	}
+
+	go out.writeLoop()
+
+	return out
+}
+
+// queue a line without blocking, unless the policy is OVERFLOW_BLOCK. It
+// fails if the line can't be queued.
+func (out *outbox) push(line string) error {
+
+	select {
+	case <-out.done:
+		return fmt.Errorf("connection closed")
+	default:
+	}
+
+	select {
+	case out.lines <- line:
+		return nil
+	default:
+	}
+
+	if out.policy == OVERFLOW_BLOCK {
+		return out.pushWait(line)
+	}
+
+	if out.policy == OVERFLOW_DISCONNECT && !out.detached.Load() {
+		WARN.Printf("%s is a slow consumer, disconnecting", out.owner)
+		out.conn.Close() // the reader will notice and clean up
+
+		return fmt.Errorf("slow consumer")
+	}
+
+	select {
+	case <-out.lines: // make room dropping the oldest line
+		DEBUG.Printf("%s is a slow consumer, dropping output", out.owner)
+	default:
+	}
+
+	select {
+	case out.lines <- line:
+		return nil
+	default:
+		return fmt.Errorf("output queue full")
+	}
+}
+
+// wait for room in the queue. Every write of the writer is bounded by
+// WRITETIMEOUT, so a stuck peer is disconnected rather than blocking us.
+func (out *outbox) pushWait(line string) error {
+
+	timeout := time.NewTimer(WRITETIMEOUT)
+	defer timeout.Stop()
+
+	select {
+	case out.lines <- line:
+		return nil
+	case <-out.done:
+		return fmt.Errorf("connection closed")
+	case <-out.flushed:
+		return fmt.Errorf("connection closed")
+	case <-timeout.C:
+		WARN.Printf("%s is a slow consumer, disconnecting", out.owner)
+		out.conn.Close() // the reader will notice and clean up
+
+		return fmt.Errorf("slow consumer")
+	}
+}
+
+// stop accepting lines, flush what is queued and close the connection
+func (out *outbox) close() {
+	out.closing.Do(func() { close(out.done) })
+}
+
+// the connection is gone: stop writing but keep queueing (dropping the
+// oldest lines) until the queue is drained or closed.
+func (out *outbox) detach() {
+	out.detached.Store(true)
+	out.stopping.Do(func() { close(out.stop) })
+	out.conn.Close()
+}
+
+// return and remove everything queued
+func (out *outbox) drain() (lines []string) {
+
+	for {
+		select {
+		case line := <-out.lines:
+			lines = append(lines, line)
+		default:
+			return lines
+		}
+	}
+}
+
+// wait until the queue is flushed, at most timeout
+func (out *outbox) wait(timeout time.Duration) {
+	select {
+	case <-out.flushed:
+	case <-time.After(timeout):
+	}
+}
+
+func (out *outbox) writeLoop() {
+
+	defer close(out.flushed)
+	defer out.conn.Close()
+
+	for {
+		select {
+		case line := <-out.lines:
+			if !out.write(line) {
+				return
+			}
+		case <-out.stop:
+			return
+		case <-out.done:
+			for {
+				select {
+				case line := <-out.lines:
+					if !out.write(line) {
+						return
+					}
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+func (out *outbox) write(line string) bool {
+
+	if out.encode != nil {
+		line = out.encode(line)
+	}
+
+	out.conn.SetWriteDeadline(time.Now().Add(WRITETIMEOUT))
+
+	_, err := out.conn.Write([]byte(line))
+
+	if err != nil {
+		DEBUG.Printf("%s.write() failed with err: %s", out.owner, err)
+		out.conn.Close() // the reader will notice and clean up
+
+		return false
+	}
+
+	return true
+}
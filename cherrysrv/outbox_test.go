@@ -0,0 +1,140 @@
+package main
+
+import (
+	"bufio"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+type testOwner string
+
+func (o testOwner) String() string {
+	return string(o)
+}
+
+func TestOutboxDrop(t *testing.T) {
+	init_logger()
+
+	server, client := net.Pipe()
+
+	OUTQUEUE = 2
+	defer func() { OUTQUEUE = 128 }()
+
+	out := newOutbox(server, testOwner("@slow"), OVERFLOW_DROP)
+
+	// nobody reads the client side, so the writer gets stuck on the first line
+	// and the queue fills with the next two.
+	out.push("1\n")
+	time.Sleep(50 * time.Millisecond)
+
+	for _, line := range []string{"2\n", "3\n", "4\n"} {
+		start := time.Now()
+
+		if err := out.push(line); err != nil {
+			t.Errorf("push(%q) failed with %s", line, err)
+		}
+
+		if time.Since(start) > 100*time.Millisecond {
+			t.Errorf("push(%q) blocked", line)
+		}
+	}
+
+	in := bufio.NewReader(client)
+	client.SetReadDeadline(time.Now().Add(time.Second))
+
+	var got []string
+	for i := 0; i < 3; i++ {
+		line, err := in.ReadString('\n')
+		if err != nil {
+			break
+		}
+		got = append(got, line)
+	}
+
+	// line 2 was dropped to make room for line 4
+	if len(got) != 3 || got[0] != "1\n" || got[1] != "3\n" || got[2] != "4\n" {
+		t.Errorf("got %q, expected the oldest queued line to be dropped", got)
+	}
+
+	out.close()
+	out.wait(time.Second)
+}
+
+func TestOutboxDisconnect(t *testing.T) {
+	init_logger()
+
+	server, client := net.Pipe()
+
+	OUTQUEUE = 2
+	defer func() { OUTQUEUE = 128 }()
+
+	out := newOutbox(server, testOwner("@slow"), OVERFLOW_DISCONNECT)
+
+	var err error
+	for _, line := range []string{"1\n", "2\n", "3\n", "4\n", "5\n"} {
+		if err = out.push(line); err != nil {
+			break
+		}
+	}
+
+	if err == nil {
+		t.Errorf("overflow did not fail")
+	}
+
+	client.SetReadDeadline(time.Now().Add(time.Second))
+
+	if _, err := bufio.NewReader(client).ReadString('\n'); err == nil {
+		t.Errorf("slow consumer was not disconnected")
+	}
+
+	out.close()
+	out.wait(time.Second)
+}
+
+func TestOutboxBlock(t *testing.T) {
+	init_logger()
+
+	server, client := net.Pipe()
+
+	LINKQUEUE = 2
+	defer func() { LINKQUEUE = 4096 }()
+
+	out := newOutbox(server, testOwner("beta"), OVERFLOW_BLOCK)
+
+	lines := []string{"1\n", "2\n", "3\n", "4\n", "5\n", "6\n"}
+
+	// the client reads late, so pushes past the queue size have to wait
+	// for it instead of failing.
+	rets := make(chan []string)
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+
+		in := bufio.NewReader(client)
+		client.SetReadDeadline(time.Now().Add(time.Second))
+
+		var got []string
+		for range lines {
+			line, err := in.ReadString('\n')
+			if err != nil {
+				break
+			}
+			got = append(got, line)
+		}
+		rets <- got
+	}()
+
+	for _, line := range lines {
+		if err := out.push(line); err != nil {
+			t.Fatalf("push(%q) failed with %s", line, err)
+		}
+	}
+
+	if got := <-rets; strings.Join(got, "") != strings.Join(lines, "") {
+		t.Errorf("got %q, expected every line in order", got)
+	}
+
+	out.close()
+	out.wait(time.Second)
+}
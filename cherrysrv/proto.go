@@ -0,0 +1,205 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Binary protocol.
+//
+// Parsing text lines is slow on 6502 clients, so after /proto bin both sides
+// talk in frames. Every field is prefixed by its length in one byte (lines are
+// never longer than 255 chars, so neither are fields). Numbers are 16 bits,
+// little endian.
+//
+// Client to server:
+//
+//	opcode, len, args		args as in text mode (i.e. "#channel text" for say)
+//
+// Server to client:
+//
+//	FRAME_MSG,   len, #channel, len, @user,    len, text	(*@user and -@user too)
+//	FRAME_EVENT, len, #channel, len, !event,   len, text
+//	FRAME_REPLY, len, /command, num lo, num hi, len, text
+//	FRAME_RAW,   len, text		anything that doesn't fit the above
+
+const (
+	FRAME_RAW   = 0x00
+	FRAME_MSG   = 0x01
+	FRAME_EVENT = 0x02
+	FRAME_REPLY = 0x03
+)
+
+// client to server opcodes. Never reorder, only append.
+var OPCODES = []string{
+	0x00: "",
+	0x01: "login",
+	0x02: "logoff",
+	0x03: "who",
+	0x04: "users",
+	0x05: "nusers",
+	0x06: "say",
+	0x07: "clock",
+	0x08: "help",
+	0x09: "version",
+	0x0a: "uptime",
+	0x0b: "join",
+	0x0c: "hjoin",
+	0x0d: "leave",
+	0x0e: "list",
+	0x0f: "license",
+	0x10: "links",
+	0x11: "resume",
+	0x12: "proto",
+	0x13: "nick",
+	0x14: "mode",
+	0x15: "msg",
+	0x16: "ignore",
+	0x17: "unignore",
+	0x18: "topic",
+	0x19: "bans",
+	0x1a: "register",
+	0x1b: "unregister",
+	0x1c: "whois",
+	0x1d: "ipban",
+	0x1e: "ipunban",
+	0x1f: "me",
+	0x20: "notice",
+	0x21: "roll",
+}
+
+// encode output for the protocol the client talks now. It's done when the
+// output is written, so lines queued for a resumed session follow the new
+// connection.
+func (clt *Client) encode(output string) string {
+
+	if clt.binary.Load() {
+		return encodeFrames(output)
+	}
+
+	return output
+}
+
+// encode the text lines in output as frames
+func encodeFrames(output string) string {
+
+	var frames strings.Builder
+
+	for _, line := range strings.Split(output, "\n") {
+		if len(line) > 0 {
+			frames.WriteString(encodeFrame(line))
+		}
+	}
+
+	return frames.String()
+}
+
+// encode a text line (without EOL) as a frame
+func encodeFrame(line string) string {
+
+	var frame strings.Builder
+
+	fields := strings.SplitN(line, ">", 4)
+
+	if len(fields) != 4 || len(fields[0]) != 0 || len(fields[1]) == 0 || len(fields[2]) == 0 {
+		frame.WriteByte(FRAME_RAW)
+		writeField(&frame, line)
+
+		return frame.String()
+	}
+
+	target, from, text := fields[1], fields[2], fields[3]
+
+	switch {
+	case target[0] == '/':
+		num, err := strconv.ParseUint(from, 10, 16)
+		if err != nil {
+			frame.WriteByte(FRAME_RAW)
+			writeField(&frame, line)
+
+			return frame.String()
+		}
+
+		frame.WriteByte(FRAME_REPLY)
+		writeField(&frame, target)
+		frame.WriteByte(byte(num))
+		frame.WriteByte(byte(num >> 8))
+		writeField(&frame, text)
+
+	case from[0] == '!':
+		frame.WriteByte(FRAME_EVENT)
+		writeField(&frame, target)
+		writeField(&frame, from)
+		writeField(&frame, text)
+
+	default:
+		frame.WriteByte(FRAME_MSG)
+		writeField(&frame, target)
+		writeField(&frame, from)
+		writeField(&frame, text)
+	}
+
+	return frame.String()
+}
+
+func writeField(frame *strings.Builder, field string) {
+
+	if len(field) > 255 {
+		field = field[:255]
+	}
+
+	frame.WriteByte(byte(len(field)))
+	frame.WriteString(field)
+}
+
+// read a client frame and return the command it stands for
+func (client *Client) readFrame() (command string, args string, err error) {
+
+	var header [2]byte
+
+	if _, err = io.ReadFull(client.reader, header[:]); err != nil {
+		DEBUG.Printf("%s.readFrame() failed with err: %s", client, err)
+		return
+	}
+
+	body := make([]byte, header[1])
+
+	if _, err = io.ReadFull(client.reader, body); err != nil {
+		DEBUG.Printf("%s.readFrame() failed with err: %s", client, err)
+		return
+	}
+
+	opcode := int(header[0])
+
+	if opcode == 0 || opcode >= len(OPCODES) {
+		return fmt.Sprintf("op%d", opcode), "", nil
+	}
+
+	return OPCODES[opcode], trim(string(body)), nil
+}
+
+// switch between text and binary protocols
+func do_proto(clt *Client, args string) {
+
+	proto, _ := split2(args, " ")
+
+	switch proto {
+	case "":
+	case "bin":
+		clt.binary.Store(true)
+	case "text":
+		clt.binary.Store(false)
+	default:
+		clt.Say(">/proto>0>/proto <text|bin>")
+		return
+	}
+
+	if clt.binary.Load() {
+		clt.Say(">/proto>0>bin")
+		return
+	}
+
+	clt.Say(">/proto>0>text")
+}
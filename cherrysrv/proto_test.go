@@ -0,0 +1,76 @@
+package main
+
+import (
+	"io"
+	"testing"
+	"time"
+)
+
+func Test_encodeFrame(t *testing.T) {
+
+	tests := []struct {
+		name string
+		line string
+		want string
+	}{
+		{"channel message", ">#main>@john>hi", "\x01\x05#main\x05@john\x02hi"},
+		{"event", ">#main>!login>@john has joined", "\x02\x05#main\x06!login\x10@john has joined"},
+		{"reply", ">/users>3>@john", "\x03\x06/users\x03\x00\x05@john"},
+		{"reply with big num", ">/users>258>@john", "\x03\x06/users\x02\x01\x05@john"},
+		{"reply with text including >", ">/say>0>a>b", "\x03\x04/say\x00\x00\x03a>b"},
+		{"raw", "hello", "\x00\x05hello"},
+		{"reply with bad num", ">/who>x>@john", "\x00\x0d>/who>x>@john"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := encodeFrame(tt.line); got != tt.want {
+				t.Errorf("encodeFrame() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBinaryClient(t *testing.T) {
+	// configure test server
+	init_logger()
+	init_commands()
+	gentoken = func() string { return "TOKEN" }
+	main_channel := NewChannelMain("#main")
+	CHANNELS.Store(main_channel.Key(), main_channel)
+
+	_, out, in := genClient()
+
+	out.Write([]byte("/proto bin\n"))
+
+	frame := func(opcode byte, args string) []byte {
+		return append([]byte{opcode, byte(len(args))}, args...)
+	}
+
+	clientTests := []struct {
+		name     string
+		input    []byte
+		expected string
+	}{
+		{"Switch", nil, "\x03\x06/proto\x00\x00\x03bin"},
+		{"Login", frame(0x01, "@bin"), "\x03\x06/login\x00\x00\x0fyou're now @bin\x02\x05#main\x06!token\x05TOKEN"},
+		{"Join", frame(0x0b, "#bin"), "\x03\x05/join\x00\x00\x10@bin joined #bin"},
+		{"Say", frame(0x06, "#bin hello"), "\x01\x04#bin\x04@bin\x05hello"},
+		{"Unknown Opcode", frame(0xfe, ""), "\x03\x06/op254\x00\x00\x1ccommand op254 does not exist"},
+		{"Back To Text", frame(0x12, "text"), ">/proto>0>text\n"},
+	}
+
+	for _, test := range clientTests {
+		out.Write(test.input)
+
+		out.SetReadDeadline(time.Now().Add(250 * time.Millisecond))
+		got := make([]byte, len(test.expected))
+		n, _ := io.ReadFull(in, got)
+
+		if string(got[:n]) != test.expected {
+			t.Errorf("%s got %q, expected %q", test.name, got[:n], test.expected)
+		}
+	}
+
+	out.Write([]byte("/logoff\n"))
+	expectLines(t, "Logoff", in, out, ">/logoff>0>Goodbye @bin")
+}
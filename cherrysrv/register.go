@@ -0,0 +1,335 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Registered channels.
+//
+// A registered channel is never closed when it gets empty and is stored in
+// DATADIR, with its topic, modes, key, operators and bans, so it's recreated
+// when the server starts again.
+
+const CHANNELS_FILE = "channels.json"
+
+var (
+	DATADIR = "."      // where the server keeps its files
+	STORE   sync.Mutex // serialises writes to the files in DATADIR
+)
+
+// what we store of a registered channel
+type channelRecord struct {
+	Name    string   `json:"name"`
+	Hidden  bool     `json:"hidden,omitempty"`
+	Owner   string   `json:"owner"` // !trip
+	Topic   string   `json:"topic,omitempty"`
+	Key     string   `json:"key,omitempty"`
+	Modes   string   `json:"modes,omitempty"`
+	Ops     []string `json:"ops,omitempty"` // !trip of each operator
+	Voiced  []string `json:"voiced,omitempty"`
+	Bans    []string `json:"bans,omitempty"`
+	Muted   []string `json:"muted,omitempty"`
+	Allowed []string `json:"allowed,omitempty"`
+	Filter  string   `json:"filter,omitempty"`
+}
+
+func (c *Channel) isRegistered() bool {
+	c.RLock()
+	defer c.RUnlock()
+
+	return c.registered
+}
+
+// the channel state changed, store it if it's registered
+func (c *Channel) changed() {
+	if c.isRegistered() {
+		saveChannels()
+	}
+}
+
+func (c *Channel) record() channelRecord {
+
+	record := channelRecord{
+		Name:    c.Name,
+		Modes:   strings.TrimPrefix(c.flagString(), "+"),
+		Voiced:  c.storedNames(c.voiced),
+		Bans:    c.sortedNames(c.bans),
+		Muted:   c.storedNames(c.muted),
+		Allowed: c.sortedNames(c.allowed),
+	}
+
+	for _, trip := range c.sortedNames(c.opTrips) {
+		record.Ops = append(record.Ops, "!"+trip)
+	}
+
+	c.RLock()
+	defer c.RUnlock()
+
+	record.Hidden = c.hidden
+	if len(c.owner) > 0 {
+		record.Owner = "!" + c.owner
+	}
+	record.Topic = c.topic
+	record.Key = c.key
+	record.Filter = c.filter
+
+	return record
+}
+
+// return the voiced or muted users as stored. Once they are gone users are
+// only known by tripcode, so members are stored as !trip and users without
+// one are not stored.
+func (c *Channel) storedNames(list map[string]bool) (output []string) {
+
+	trips := map[string]string{}
+
+	for _, clt := range c.members() {
+		if len(clt.trip) > 0 {
+			trips[clt.Name] = "!" + clt.trip
+		}
+	}
+
+	for _, name := range c.sortedNames(list) {
+		if ValidTrip(name) {
+			output = append(output, name)
+		} else if trip, ok := trips[name]; ok {
+			output = append(output, trip)
+		}
+	}
+
+	sort.Strings(output)
+
+	return output
+}
+
+// create a channel from what was stored
+func channelFromRecord(record channelRecord) *Channel {
+
+	channel := newChannel(record.Name, record.Hidden)
+
+	channel.registered = true
+	channel.closeOnEmpty = false
+	if ValidTrip(record.Owner) {
+		channel.owner = record.Owner[1:]
+	}
+	channel.topic = record.Topic
+	channel.key = record.Key
+	channel.filter = record.Filter
+
+	for i := 0; i < len(record.Modes); i++ {
+		if strings.IndexByte(CHANNEL_MODES, record.Modes[i]) >= 0 {
+			channel.modes[record.Modes[i:i+1]] = true
+		}
+	}
+
+	for _, list := range []struct {
+		names []string
+		set   map[string]bool
+	}{{record.Bans, channel.bans}, {record.Allowed, channel.allowed}} {
+		for _, name := range list.names {
+			list.set[name] = true
+		}
+	}
+
+	// voice and quiet by name went with the users that left
+	for _, list := range []struct {
+		names []string
+		set   map[string]bool
+	}{{record.Voiced, channel.voiced}, {record.Muted, channel.muted}} {
+		for _, trip := range list.names {
+			if ValidTrip(trip) {
+				list.set[trip] = true
+			}
+		}
+	}
+
+	// operators get their ops back when they join with their tripcode
+	for _, trip := range record.Ops {
+		if ValidTrip(trip) {
+			channel.opTrips[trip[1:]] = true
+		}
+	}
+
+	return channel
+}
+
+// write every registered channel to disk
+func saveChannels() {
+
+	var records []channelRecord
+
+	collect := func(key string, channel *Channel) bool {
+		if channel.isRegistered() {
+			records = append(records, channel.record())
+		}
+		return true
+	}
+
+	CHANNELS.Range(collect)
+
+	sort.Slice(records, func(i, j int) bool { return records[i].Name < records[j].Name })
+
+	if err := writeJSON(CHANNELS_FILE, records); err != nil {
+		ERROR.Printf("unable to save registered channels: %s", err)
+	}
+}
+
+// recreate the registered channels stored on disk
+func load_channels() error {
+
+	var records []channelRecord
+
+	if err := readJSON(CHANNELS_FILE, &records); err != nil {
+		return err
+	}
+
+	for _, record := range records {
+		if _, err := ValidChannelname(record.Name); err != nil {
+			WARN.Printf("ignoring stored channel %s: %s", record.Name, err)
+			continue
+		}
+
+		channel := channelFromRecord(record)
+		CHANNELS.Store(channel.Key(), channel)
+		DEBUG.Printf("adding registered %s to CHANNELS", channel)
+	}
+
+	INFO.Printf("%d registered channels loaded", len(records))
+
+	return nil
+}
+
+// write v as json to name in DATADIR, replacing it atomically
+func writeJSON(name string, v interface{}) error {
+	STORE.Lock()
+	defer STORE.Unlock()
+
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	path := filepath.Join(DATADIR, name)
+
+	if err := os.WriteFile(path+".tmp", data, 0600); err != nil {
+		return err
+	}
+
+	return os.Rename(path+".tmp", path)
+}
+
+// read json from name in DATADIR into v. A missing file is not an error.
+func readJSON(name string, v interface{}) error {
+	STORE.Lock()
+	defer STORE.Unlock()
+
+	data, err := os.ReadFile(filepath.Join(DATADIR, name))
+
+	if os.IsNotExist(err) {
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(data, v)
+}
+
+// keep the channel (and its state) across restarts
+func do_register(clt *Client, args string) {
+
+	if !clt.isLogged() {
+		clt.Say(">/register>0>/register requires you to be logged")
+
+		return
+	}
+
+	if no(args) {
+		clt.Say(">/register>0>/register <#channel>")
+
+		return
+	}
+
+	channelName, _ := split2(args, " ")
+
+	channel, ok := CHANNELS.Load(channelName)
+
+	if !ok || channel.Name == "#main" {
+		clt.Say(">/register>0>%s is not a valid channel", channelName)
+		return
+	}
+
+	if len(clt.trip) == 0 {
+		clt.Say(">/register>0>/register requires a tripcode, /login <account>#secret")
+		return
+	}
+
+	if !channel.isOwner(clt) {
+		clt.Say(">/register>0>only the owner of %s can register it", channel)
+		return
+	}
+
+	channel.Lock()
+	channel.registered = true
+	channel.closeOnEmpty = false
+	channel.Unlock()
+
+	saveChannels()
+
+	clt.Say(">/register>0>%s registered", channel)
+	INFO.Printf("%s registered %s", clt, channel)
+}
+
+// forget a registered channel, it will close when it gets empty
+func do_unregister(clt *Client, args string) {
+
+	if !clt.isLogged() {
+		clt.Say(">/unregister>0>/unregister requires you to be logged")
+
+		return
+	}
+
+	if no(args) {
+		clt.Say(">/unregister>0>/unregister <#channel>")
+
+		return
+	}
+
+	channelName, _ := split2(args, " ")
+
+	channel, ok := CHANNELS.Load(channelName)
+
+	if !ok || !channel.isRegistered() {
+		clt.Say(">/unregister>0>%s is not a registered channel", channelName)
+		return
+	}
+
+	if !channel.isOwner(clt) {
+		clt.Say(">/unregister>0>only the owner of %s can unregister it", channel)
+		return
+	}
+
+	channel.Lock()
+	channel.registered = false
+	channel.closeOnEmpty = true
+	empty := len(channel.clients) == 0
+	if empty {
+		channel.Status = CHANNEL_SHUTTINGDOWN
+	}
+	channel.Unlock()
+
+	if empty {
+		CHANNELS.Delete(channel.Name)
+	}
+
+	saveChannels()
+
+	clt.Say(">/unregister>0>%s unregistered", channel)
+	INFO.Printf("%s unregistered %s", clt, channel)
+}
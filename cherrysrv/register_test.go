@@ -0,0 +1,107 @@
+package main
+
+import "testing"
+
+func TestRegister(t *testing.T) {
+	// configure test server
+	init_logger()
+	init_commands()
+	gentoken = func() string { return "TOKEN" }
+	main_channel := NewChannelMain("#main")
+	CHANNELS.Store(main_channel.Key(), main_channel)
+	DATADIR = t.TempDir()
+	TRIPKEY = "key"
+	defer func() { TRIPKEY = "" }()
+
+	_, out1, in1 := genClient()
+	_, out2, in2 := genClient()
+
+	out1.Write([]byte("/login @owner#secret\n"))
+	expectLines(t, "Login", in1, out1, ">/login>0>you're now @owner", ">#main>!token>TOKEN")
+	expectLines(t, "Login Notice", in2, out2, ">#main>!login>@owner has joined the server")
+
+	out2.Write([]byte("/login @user\n"))
+	expectLines(t, "Login #2", in2, out2, ">/login>0>you're now @user", ">#main>!token>TOKEN")
+	expectLines(t, "Login Notice #2", in1, out1, ">#main>!login>@user has joined the server")
+
+	out1.Write([]byte("/join #club\n"))
+	expectLines(t, "Create Channel", in1, out1, ">/join>0>@owner joined #club")
+
+	out2.Write([]byte("/register #club\n"))
+	expectLines(t, "Register Without Tripcode", in2, out2, ">/register>0>/register requires a tripcode, /login <account>#secret")
+
+	out1.Write([]byte("/topic #club all about clubs\n"))
+	expectLines(t, "Topic", in1, out1, ">#club>!topic>@owner all about clubs")
+
+	out1.Write([]byte("/mode #club +k secret\n"))
+	expectLines(t, "Key", in1, out1, ">#club>!mode>@owner +k")
+
+	out1.Write([]byte("/register #club\n"))
+	expectLines(t, "Register", in1, out1, ">/register>0>#club registered")
+
+	out2.Write([]byte("/join #club\n"))
+	expectLines(t, "Join Without Key", in2, out2, ">/join>0>#club requires a key, /join #club <key>")
+
+	out2.Write([]byte("/join #club secret\n"))
+	expectLines(t, "Join With Key", in2, out2, ">#club>@user>joined the channel", ">/topic>0>#club all about clubs")
+	expectLines(t, "Join Notice", in1, out1, ">#club>@user>joined the channel")
+
+	out1.Write([]byte("/mode #club +b @user\n"))
+	expectLines(t, "Ban", in1, out1, ">#club>!mode>@owner +b @user")
+	expectLines(t, "Ban Notice", in2, out2, ">#club>!mode>@owner +b @user", ">#club>!banned>you have been banned from #club")
+
+	out2.Write([]byte("/join #club secret\n"))
+	expectLines(t, "Join Banned", in2, out2, ">/join>0>you are banned from #club")
+
+	out2.Write([]byte("/bans #club\n"))
+	expectLines(t, "Bans", in2, out2, ">/bans>0>@user")
+
+	out1.Write([]byte("/leave #club\n"))
+	expectLines(t, "Leave", in1, out1, ">#club>@owner>left the channel")
+
+	out2.Write([]byte("/topic #club\n"))
+	expectLines(t, "Registered Stays", in2, out2, ">/topic>0>#club all about clubs")
+
+	// a restarted server gets the channel back
+	CHANNELS.Delete("#club")
+
+	if err := load_channels(); err != nil {
+		t.Fatalf("load_channels() failed with %s", err)
+	}
+
+	channel, ok := CHANNELS.Load("#club")
+
+	if !ok {
+		t.Fatalf("#club was not loaded")
+	}
+
+	owner := &Client{Name: "@owner", trip: generateTrip("secret", TRIPKEY)}
+
+	// ops come back with the tripcode, not the name
+	if !channel.isOwner(owner) || channel.isOwner(&Client{Name: "@owner"}) || channel.isOp("@owner") || !channel.isBanned(&Client{Name: "@user"}) ||
+		!channel.keyMatches("secret") || channel.getTopic() != "all about clubs" || channel.modeString() != "+k" {
+		t.Fatalf("#club loaded as %+v", channel.record())
+	}
+
+	out1.Write([]byte("/join #club secret\n"))
+	expectLines(t, "Owner Joins", in1, out1, ">#club>@owner>joined the channel", ">/topic>0>#club all about clubs")
+
+	if !channel.isOp("@owner") {
+		t.Errorf("the owner didn't get ops back")
+	}
+
+	out1.Write([]byte("/unregister #club\n"))
+	expectLines(t, "Unregister", in1, out1, ">/unregister>0>#club unregistered")
+
+	out1.Write([]byte("/leave #club\n"))
+	expectLines(t, "Leave Again", in1, out1, ">#club>@owner>left the channel")
+
+	out2.Write([]byte("/topic #club\n"))
+	expectLines(t, "Unregistered Closes", in2, out2, ">/topic>0>#club is not a valid channel")
+
+	out1.Write([]byte("/logoff\n"))
+	expectLines(t, "Logoff", in1, out1, ">/logoff>0>Goodbye @owner")
+
+	out2.Write([]byte("/logoff\n"))
+	expectLines(t, "Logoff #2", in2, out2, ">#main>!logoff>@owner is leaving", ">/logoff>0>Goodbye @user")
+}
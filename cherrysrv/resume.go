@@ -0,0 +1,145 @@
+package main
+
+import (
+	"time"
+
+	"github.com/dchest/uniuri"
+	"github.com/lrita/cmap"
+)
+
+// Session resume.
+//
+// Every user gets a token when logging in. If the connection drops (i.e. a
+// WiFi hiccup) the user stays logged and in their channels for RESUMEGRACE,
+// with their output queued, and nobody is told. Connecting again and sending
+// /resume <token> before /login takes the session back.
+
+var (
+	RESUMEGRACE = 2 * time.Minute
+	RESUMES     cmap.Map[string, *Client] // token -> detached (or still connected) client
+)
+
+// tokens are handed to 8bit clients, so keep them short but unguessable
+var gentoken = func() string {
+	return uniuri.NewLen(16)
+}
+
+// give the client a new resume token and tell them
+func (clt *Client) issueToken() {
+
+	if len(clt.token) > 0 {
+		RESUMES.Delete(clt.token)
+	}
+
+	clt.token = gentoken()
+	RESUMES.Store(clt.token, clt)
+
+	clt.Say(">#main>!token>%s", clt.token)
+}
+
+// forget the resume token, the session can't be resumed anymore
+func (clt *Client) dropToken() {
+
+	if len(clt.token) == 0 {
+		return
+	}
+
+	if current, ok := RESUMES.Load(clt.token); ok && current == clt {
+		RESUMES.Delete(clt.token)
+	}
+}
+
+// the connection dropped: keep the user around waiting for a /resume
+func (clt *Client) detach() {
+
+	INFO.Printf("%s detached (%s), waiting %s to resume", clt, clt.conn.RemoteAddr(), RESUMEGRACE)
+
+	clt.detached.Store(true)
+	clt.out.detach()
+
+	time.AfterFunc(RESUMEGRACE, clt.expire)
+}
+
+// nobody resumed the session in time, now it's a disconnection
+func (clt *Client) expire() {
+
+	if !clt.detached.CompareAndSwap(true, false) { // resumed, or collided with a peer
+		return
+	}
+
+	INFO.Printf("%s disconnected (%s)", clt, clt.conn.RemoteAddr())
+	clt.UpdateInMain(">!disconnect>%s disconnected", clt)
+	clt.Close()
+}
+
+// take over a detached session, clt becomes the old client
+func do_resume(clt *Client, args string) {
+
+	if clt.isLogged() {
+		if no(args) {
+			clt.Say(">/resume>0>%s", clt.token)
+			return
+		}
+
+		clt.Say(">/resume>0>you're already logged in")
+		return
+	}
+
+	if no(args) {
+		clt.Say(">/resume>0>/resume <token>")
+		return
+	}
+
+	token, _ := split2(args, " ")
+
+	old, ok := RESUMES.Load(token)
+
+	if !ok || !old.detached.CompareAndSwap(true, false) {
+		clt.Say(">/resume>0>unable to resume, please /login again")
+		WARN.Printf("%s unable to resume (%s)", clt, clt.conn.RemoteAddr())
+		return
+	}
+
+	oldName := clt.Name
+
+	RESUMES.Delete(token)
+
+	NICKS.Lock()
+	CLIENTS.Delete(oldName)
+	clt.Name = old.Name
+	clt.loggedOn = old.loggedOn
+	clt.trip = old.trip
+	clt.Status.Store(USER_LOGGED)
+	CLIENTS.Store(clt.Name, clt)
+	NICKS.Unlock()
+
+	if old.binary.Load() { // the session keeps talking frames
+		clt.binary.Store(true)
+	}
+
+	clt.Say(">/resume>0>welcome back %s", clt)
+
+	replaceClient := func(key string, channel *Channel) bool {
+		channel.replaceClient(old, clt)
+		return true
+	}
+
+	CHANNELS.Range(replaceClient)
+
+	clt.filterHits.Store(old.filterHits.Load())
+
+	for _, name := range old.ignored.list() {
+		clt.ignored.add(name)
+	}
+
+	old.Status.Store(USER_LOGGINOUT)
+	old.out.close()
+
+	for _, line := range old.out.drain() { // plain text, encoded when written
+		clt.out.push(line)
+	}
+
+	clt.issueToken()
+
+	INFO.Printf("%s has resumed as %s (%s)", oldName, clt, clt.conn.RemoteAddr())
+}
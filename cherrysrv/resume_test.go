@@ -0,0 +1,134 @@
+package main
+
+import (
+	"io"
+	"testing"
+	"time"
+)
+
+func TestResume(t *testing.T) {
+	// configure test server
+	init_logger()
+	init_commands()
+	gentoken = func() string { return "TOKEN1" }
+	main_channel := NewChannelMain("#main")
+	CHANNELS.Store(main_channel.Key(), main_channel)
+
+	c1, out1, in1 := genClient()
+	_, out2, in2 := genClient()
+
+	out1.Write([]byte("/login @wifi\n"))
+	expectLines(t, "Login", in1, out1, ">/login>0>you're now @wifi", ">#main>!token>TOKEN1")
+	expectLines(t, "Login Notice", in2, out2, ">#main>!login>@wifi has joined the server")
+
+	gentoken = func() string { return "TOKEN2" }
+
+	out2.Write([]byte("/login @wired\n"))
+	expectLines(t, "Login #2", in2, out2, ">/login>0>you're now @wired", ">#main>!token>TOKEN2")
+	expectLines(t, "Login Notice #2", in1, out1, ">#main>!login>@wired has joined the server")
+
+	out1.Write([]byte("/join #retro\n"))
+	expectLines(t, "Join", in1, out1, ">/join>0>@wifi joined #retro")
+
+	out2.Write([]byte("/join #retro\n"))
+	expectLines(t, "Join #2", in2, out2, ">#retro>@wired>joined the channel")
+	expectLines(t, "Join Notice", in1, out1, ">#retro>@wired>joined the channel")
+
+	// the WiFi drops
+	out1.Close()
+
+	for i := 0; i < 100 && !c1.detached.Load(); i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	out2.Write([]byte("/say #retro are you there?\n"))
+	expectLines(t, "Say While Detached", in2, out2, ">#retro>@wired>are you there?")
+
+	out2.Write([]byte("/users #retro\n"))
+	expectLines(t, "Users While Detached", in2, out2, ">/users #retro>1>@wifi", ">/users #retro>0>@wired")
+
+	gentoken = func() string { return "TOKEN3" }
+
+	_, out3, in3 := genClient()
+
+	out3.Write([]byte("/resume BADTOKEN\n"))
+	expectLines(t, "Resume Bad Token", in3, out3, ">/resume>0>unable to resume, please /login again")
+
+	out3.Write([]byte("/resume TOKEN1\n"))
+	expectLines(t, "Resume", in3, out3, ">/resume>0>welcome back @wifi", ">#retro>@wired>are you there?", ">#main>!token>TOKEN3")
+
+	out3.Write([]byte("/resume TOKEN1\n"))
+	expectLines(t, "Resume Again", in3, out3, ">/resume>0>you're already logged in")
+
+	out3.Write([]byte("/say #retro back!\n"))
+	expectLines(t, "Say After Resume", in3, out3, ">#retro>@wifi>back!")
+	expectLines(t, "No Disconnect Noise", in2, out2, ">#retro>@wifi>back!")
+
+	out3.Write([]byte("/logoff\n"))
+	expectLines(t, "Logoff", in3, out3, ">/logoff>0>Goodbye @wifi")
+
+	out2.Write([]byte("/logoff\n"))
+	expectLines(t, "Logoff #2", in2, out2, ">#main>!logoff>@wifi is leaving", ">/logoff>0>Goodbye @wired")
+}
+
+func TestResumeBinary(t *testing.T) {
+	// configure test server
+	init_logger()
+	init_commands()
+	gentoken = func() string { return "BINTOKEN1" }
+	main_channel := NewChannelMain("#main")
+	CHANNELS.Store(main_channel.Key(), main_channel)
+
+	c1, out1, in1 := genClient()
+	_, out2, in2 := genClient()
+
+	out1.Write([]byte("/login @binwifi\n"))
+	expectLines(t, "Login", in1, out1, ">/login>0>you're now @binwifi", ">#main>!token>BINTOKEN1")
+	expectLines(t, "Login Notice", in2, out2, ">#main>!login>@binwifi has joined the server")
+
+	gentoken = func() string { return "BINTOKEN2" }
+
+	out2.Write([]byte("/login @binwired\n"))
+	expectLines(t, "Login #2", in2, out2, ">/login>0>you're now @binwired", ">#main>!token>BINTOKEN2")
+	expectLines(t, "Login Notice #2", in1, out1, ">#main>!login>@binwired has joined the server")
+
+	out1.Write([]byte("/proto bin\n"))
+	out1.SetReadDeadline(time.Now().Add(250 * time.Millisecond))
+	io.ReadFull(in1, make([]byte, len("\x03\x06/proto\x00\x00\x03bin")))
+
+	// the WiFi drops
+	out1.Close()
+
+	for i := 0; i < 100 && !c1.detached.Load(); i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	out2.Write([]byte("/msg @binwifi are you there?\n"))
+	expectLines(t, "Msg While Detached", in2, out2, ">@binwifi>@binwired>are you there?")
+
+	gentoken = func() string { return "BINTOKEN3" }
+
+	_, out3, in3 := genClient()
+
+	// the lines queued while away come in frames, like the rest of the session
+	out3.Write([]byte("/resume BINTOKEN1\n"))
+
+	expected := encodeFrames(">/resume>0>welcome back @binwifi\n>@binwired>@binwired>are you there?\n>#main>!token>BINTOKEN3\n")
+
+	out3.SetReadDeadline(time.Now().Add(250 * time.Millisecond))
+	got := make([]byte, len(expected))
+	n, _ := io.ReadFull(in3, got)
+
+	if string(got[:n]) != expected {
+		t.Errorf("Resume got %q, expected %q", got[:n], expected)
+	}
+
+	out3.Write([]byte{0x12, 4, 't', 'e', 'x', 't'})
+	expectLines(t, "Back To Text", in3, out3, ">/proto>0>text")
+
+	out3.Write([]byte("/logoff\n"))
+	expectLines(t, "Logoff", in3, out3, ">/logoff>0>Goodbye @binwifi")
+
+	out2.Write([]byte("/logoff\n"))
+	expectLines(t, "Logoff #2", in2, out2, ">#main>!logoff>@binwifi is leaving", ">/logoff>0>Goodbye @binwired")
+}
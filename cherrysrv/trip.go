@@ -0,0 +1,88 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"strings"
+)
+
+// Tripcodes.
+//
+// As in fujinet-id, logging in as @nick#secret gives the user the tripcode of
+// the secret, a HMAC of it with TRIPKEY. Only who knows the secret gets the
+// same tripcode, so it identifies the user whatever their name is, and channel
+// operators can ban (+b !trip) or allow (+w !trip) users by tripcode. Linked
+// servers should share TRIPKEY for their tripcodes to match.
+//
+// Unlike fujinet-id, tripcodes are encoded in base64url rather than Ascii85,
+// whose alphabet has '>', '#', '@' and '!' and would break the line grammar
+// (i.e. in @nick!trip).
+
+var TRIPKEY = "" // no tripcodes without a key
+
+// secret --> tripcode, as generatePubKey() in fujinet-id but in base64url
+func generateTrip(secret string, serverkey string) string {
+
+	hmac := hmac.New(sha256.New, []byte(serverkey))
+
+	hmac.Write([]byte(secret))
+	encrypted := hmac.Sum(nil)
+
+	return base64.RawURLEncoding.EncodeToString(encrypted)
+}
+
+// @nick#secret --> @nick, secret
+func splitPrivKey(privkey string) (username string, secret string) {
+	return split2(privkey, "#")
+}
+
+// the base64url alphabet of tripcodes
+const TRIPCHARS = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789-_"
+
+// is it a tripcode as used in modes, i.e. !nYSgJ78ZY7...?
+func ValidTrip(trip string) bool {
+	return len(trip) > 1 && trip[0] == '!' && len(strings.TrimLeft(trip[1:], TRIPCHARS)) == 0
+}
+
+// return the user as @nick!trip if they have a tripcode
+func (clt *Client) fullName() string {
+
+	if len(clt.trip) == 0 {
+		return clt.Name
+	}
+
+	return clt.Name + "!" + clt.trip
+}
+
+// show who a user is, with their tripcode
+func do_whois(clt *Client, args string) {
+
+	if !clt.isLogged() {
+		clt.Say(">/whois>0>/whois requires you to be logged")
+
+		return
+	}
+
+	if no(args) {
+		clt.Say(">/whois>0>/whois <@user>")
+
+		return
+	}
+
+	name, _ := split2(args, " ")
+
+	target, ok := CLIENTS.Load(name)
+
+	if !ok || !target.isLogged() {
+		clt.Say(">/whois>0>%s is not logged", name)
+		return
+	}
+
+	if target.isLocal() {
+		clt.Say(">/whois>0>%s", target.fullName())
+		return
+	}
+
+	clt.Say(">/whois>0>%s on %s", target.fullName(), target.link)
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestGenerateTrip(t *testing.T) {
+
+	// same key as fujinet-id, same HMAC in base64url
+	TEST_SERVERKEY := "46;79YV-YmoMwLS·YdWkA!ciIIfBqkq!KK$2EhRX9;:812,,/Fl9GlfmM%R&4YKF"
+
+	tests := []struct {
+		secret string
+		want   string
+	}{
+		{"secreto", "nYSgJ78ZY7vVLA0H81cbiHSaYOCSdfhKjBr5v1qco8k"},
+		{"secreto2", "00FbqZbjOh9le0ov3lwafec4wB2IJaPBgx3vb1csySc"},
+	}
+
+	for _, tt := range tests {
+		got := generateTrip(tt.secret, TEST_SERVERKEY)
+
+		if got != tt.want {
+			t.Errorf("generateTrip(%s) = %v, want %v", tt.secret, got, tt.want)
+		}
+
+		// nothing that means something in a line, i.e. @nick!trip
+		if strings.ContainsAny(got, ">#@! \t") {
+			t.Errorf("generateTrip(%s) = %v breaks the line grammar", tt.secret, got)
+		}
+	}
+}
+
+func TestTrip(t *testing.T) {
+	// configure test server
+	init_logger()
+	init_commands()
+	gentoken = func() string { return "TOKEN" }
+	main_channel := NewChannelMain("#main")
+	CHANNELS.Store(main_channel.Key(), main_channel)
+
+	TRIPKEY = ""
+	defer func() { TRIPKEY = "" }()
+
+	_, out1, in1 := genClient()
+	_, out2, in2 := genClient()
+
+	out2.Write([]byte("/login @alice#secreto\n"))
+	expectLines(t, "Login Disabled", in2, out2, ">/login>0>tripcodes are not enabled in this server")
+
+	TRIPKEY = "key"
+	trip := generateTrip("secreto", TRIPKEY)
+
+	out1.Write([]byte("/login @op\n"))
+	expectLines(t, "Login", in1, out1, ">/login>0>you're now @op", ">#main>!token>TOKEN")
+	expectLines(t, "Login Notice", in2, out2, ">#main>!login>@op has joined the server")
+
+	out2.Write([]byte("/login @alice#\n"))
+	expectLines(t, "Login Empty Secret", in2, out2, ">/login>0>/login <account>[#secret]")
+
+	out2.Write([]byte("/login @alice#secreto\n"))
+	expectLines(t, "Login Trip", in2, out2, ">/login>0>you're now @alice", ">#main>!token>TOKEN")
+	expectLines(t, "Login Trip Notice", in1, out1, ">#main>!login>@alice has joined the server")
+
+	out1.Write([]byte("/whois @alice\n"))
+	expectLines(t, "Whois", in1, out1, ">/whois>0>@alice!"+trip)
+
+	out2.Write([]byte("/whois @op\n"))
+	expectLines(t, "Whois No Trip", in2, out2, ">/whois>0>@op")
+
+	out1.Write([]byte("/join #vip\n"))
+	expectLines(t, "Create Channel", in1, out1, ">/join>0>@op joined #vip")
+
+	out1.Write([]byte("/mode #vip +w !" + trip + "\n"))
+	expectLines(t, "Allow", in1, out1, ">#vip>!mode>@op +w !"+trip)
+
+	out2.Write([]byte("/nick @bob\n"))
+	expectLines(t, "Nick", in2, out2, ">/nick>0>you're now @bob", ">#main>!nick>@alice @bob")
+	expectLines(t, "Nick Notice", in1, out1, ">#main>!nick>@alice @bob")
+
+	out2.Write([]byte("/join #vip\n"))
+	expectLines(t, "Join Allowed", in2, out2, ">#vip>@bob>joined the channel")
+	expectLines(t, "Join Allowed Notice", in1, out1, ">#vip>@bob>joined the channel")
+
+	out1.Write([]byte("/mode #vip +b !" + trip + "\n"))
+	expectLines(t, "Ban Trip", in1, out1, ">#vip>!mode>@op +b !"+trip)
+	expectLines(t, "Ban Trip Notice", in2, out2, ">#vip>!mode>@op +b !"+trip, ">#vip>!banned>you have been banned from #vip")
+
+	out2.Write([]byte("/join #vip\n"))
+	expectLines(t, "Join Banned", in2, out2, ">/join>0>you are banned from #vip")
+
+	out1.Write([]byte("/mode #vip -b !" + trip + "\n"))
+	expectLines(t, "Unban Trip", in1, out1, ">#vip>!mode>@op -b !"+trip)
+
+	out1.Write([]byte("/mode #vip -w !" + trip + "\n"))
+	expectLines(t, "Disallow", in1, out1, ">#vip>!mode>@op -w !"+trip)
+
+	out1.Write([]byte("/mode #vip +w !someoneelse\n"))
+	expectLines(t, "Allow Other", in1, out1, ">#vip>!mode>@op +w !someoneelse")
+
+	out2.Write([]byte("/join #vip\n"))
+	expectLines(t, "Join Not Allowed", in2, out2, ">/join>0>only allowed tripcodes can join #vip")
+
+	out1.Write([]byte("/logoff\n"))
+	expectLines(t, "Logoff", in1, out1, ">/logoff>0>Goodbye @op")
+
+	out2.Write([]byte("/logoff\n"))
+	expectLines(t, "Logoff #2", in2, out2, ">#main>!logoff>@op is leaving", ">/logoff>0>Goodbye @bob")
+}
@@ -36,6 +36,10 @@ func ValidUsername(username string) (validusername string, err error) {
 
 	var notvalid string
 
+	if len(username) < 2 {
+		return notvalid, fmt.Errorf("username is too short")
+	}
+
 	if username[0] != '@' {
 		return notvalid, fmt.Errorf("username must start with '@'")
 	}
@@ -63,6 +67,10 @@ func ValidChannelname(channelname string) (vaalidchannelname string, err error)
 
 	var notvalid string
 
+	if len(channelname) < 2 {
+		return notvalid, fmt.Errorf("channelname is too short")
+	}
+
 	if channelname[0] != '#' {
 		return notvalid, fmt.Errorf("channelname must start with '#'")
 	}
@@ -137,3 +145,15 @@ func shorten255(line string) string {
 
 	return line
 }
+
+// stringList is a flag.Value that can be repeated in the command line
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
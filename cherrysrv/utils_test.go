@@ -42,7 +42,8 @@ func TestValidUsername(t *testing.T) {
 		wantValidusername string
 		wantErr           bool
 	}{
-		//		{"empty string", "", NOSTRING, true},
+		{"empty string", "", NOSTRING, true},
+		{"only @", "@", NOSTRING, true},
 		{"valid name", "@JohnnyCash", "@JohnnyCash", false},
 		{"valid name w/numbers", "@JohnnyCash12", "@JohnnyCash12", false},
 		{"name with space", "@Johnny Cash", NOSTRING, true},
@@ -101,7 +102,8 @@ func TestValidChannelname(t *testing.T) {
 		wantVaalidchannelname string
 		wantErr               bool
 	}{
-		//		{"empty string", "", NOSTRING, true},
+		{"empty string", "", NOSTRING, true},
+		{"only #", "#", NOSTRING, true},
 		{"valid name", "#fun", "#fun", false},
 		{"valid name w/numbers", "#channel1", "#channel1", false},
 		{"name with space", "#more channel", NOSTRING, true},
@@ -0,0 +1,245 @@
+package main
+
+import (
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/goccy/go-json"
+)
+
+/*
+Bankrolls - a player's chips are kept between visits, keyed by (case insensitive) player name.
+
+A player brings their whole bankroll to the table they sit at, and takes what is left of it back
+when they leave or are dropped. The chips at each table are saved at the end of every game, so a
+restart of the server returns them to the player. New players start with STARTING_PURSE.
+
+A broke player (under TOPUP_BELOW chips in total) gets a free top-up to STARTING_PURSE once a day,
+when they sit down or when the next game starts.
+
+Bankrolls are saved as json in DATA_DIR (env, default "data").
+*/
+
+const TOPUP_BELOW = 25
+const TOPUP_INTERVAL = time.Hour * time.Duration(24)
+const LEADERBOARD_SIZE = 10
+
+type Bankroll struct {
+	Name       string         `json:"name"`
+	Chips      int            `json:"chips"`  // Chips not at a table
+	Tables     map[string]int `json:"tables"` // Chips at each table the player sits at
+	BiggestPot int            `json:"biggestPot"`
+	LastTopUp  time.Time      `json:"lastTopUp"`
+}
+
+// Used to send the leaderboard
+type Leaderboard struct {
+	Stacks []LeaderboardEntry `json:"st"`
+	Pots   []LeaderboardEntry `json:"po"`
+}
+
+type LeaderboardEntry struct {
+	Name   string `json:"n"`
+	Amount int    `json:"a"`
+}
+
+type BankrollStore struct {
+	mutex     sync.Mutex
+	path      string
+	bankrolls map[string]*Bankroll
+}
+
+var bankrolls = BankrollStore{bankrolls: map[string]*Bankroll{}}
+
+func dataDir() string {
+	dir := os.Getenv("DATA_DIR")
+	if dir == "" {
+		dir = "data"
+	}
+	return dir
+}
+
+// Loads the saved bankrolls. Chips left at tables by the last run go back to their players.
+func initializeBankrolls() {
+	bankrolls.mutex.Lock()
+	defer bankrolls.mutex.Unlock()
+
+	bankrolls.path = filepath.Join(dataDir(), "bankrolls.json")
+
+	data, err := os.ReadFile(bankrolls.path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Printf("Unable to read bankrolls: %s", err)
+		}
+		return
+	}
+
+	list := []*Bankroll{}
+	if err := json.Unmarshal(data, &list); err != nil {
+		log.Printf("Unable to read bankrolls: %s", err)
+		return
+	}
+
+	for _, bankroll := range list {
+		for _, chips := range bankroll.Tables {
+			bankroll.Chips += chips
+		}
+		bankroll.Tables = map[string]int{}
+		bankrolls.bankrolls[strings.ToLower(bankroll.Name)] = bankroll
+	}
+
+	log.Printf("Loaded %d bankrolls", len(list))
+}
+
+// Returns the bankroll of a player, creating it for new players. Expects the mutex to be held.
+func (store *BankrollStore) get(name string) *Bankroll {
+	bankroll, ok := store.bankrolls[strings.ToLower(name)]
+	if !ok {
+		bankroll = &Bankroll{Name: name, Chips: STARTING_PURSE, Tables: map[string]int{}}
+		store.bankrolls[strings.ToLower(name)] = bankroll
+	}
+	return bankroll
+}
+
+// Saves all bankrolls. Expects the mutex to be held.
+func (store *BankrollStore) save() {
+	if store.path == "" {
+		return
+	}
+
+	list := []*Bankroll{}
+	for _, bankroll := range store.bankrolls {
+		list = append(list, bankroll)
+	}
+
+	data, err := json.Marshal(list)
+	if err == nil {
+		err = os.MkdirAll(filepath.Dir(store.path), 0755)
+	}
+
+	// Write to a temp file first, so a crash never leaves a partial file
+	if err == nil {
+		err = os.WriteFile(store.path+".tmp", data, 0644)
+	}
+	if err == nil {
+		err = os.Rename(store.path+".tmp", store.path)
+	}
+
+	if err != nil {
+		log.Printf("Unable to save bankrolls: %s", err)
+	}
+}
+
+func (bankroll *Bankroll) total() int {
+	total := bankroll.Chips
+	for _, chips := range bankroll.Tables {
+		total += chips
+	}
+	return total
+}
+
+// Tops up a broke player, if they have not had a top-up today, adding the chips to the table.
+// Returns true if the player was topped up.
+func (bankroll *Bankroll) topUp(table string) bool {
+	total := bankroll.total()
+	if total >= TOPUP_BELOW || time.Since(bankroll.LastTopUp) < TOPUP_INTERVAL {
+		return false
+	}
+
+	bankroll.Tables[table] += STARTING_PURSE - total
+	bankroll.LastTopUp = time.Now()
+	return true
+}
+
+// A player sits at a table, bringing their chips. Returns the player's purse at the table.
+func (store *BankrollStore) sitDown(name string, table string) int {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	bankroll := store.get(name)
+	bankroll.Tables[table] += bankroll.Chips
+	bankroll.Chips = 0
+	bankroll.topUp(table)
+	store.save()
+
+	return bankroll.Tables[table]
+}
+
+// A player leaves a table, taking what is left of their purse. Does nothing if the player already
+// left the table, so a purse is never taken back twice.
+func (store *BankrollStore) standUp(name string, table string, purse int) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	bankroll := store.get(name)
+	if _, seated := bankroll.Tables[table]; !seated {
+		return
+	}
+	bankroll.Chips += purse
+	delete(bankroll.Tables, table)
+	store.save()
+}
+
+// Records the purse of a player at the end of a game, and the pot they won (0 if none)
+func (store *BankrollStore) endGame(name string, table string, purse int, won int) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	bankroll := store.get(name)
+	bankroll.Tables[table] = purse
+	bankroll.BiggestPot = maxInt(bankroll.BiggestPot, won)
+	store.save()
+}
+
+// Returns the purse of a broke player after their daily top-up, or the same purse if none is due
+func (store *BankrollStore) topUp(name string, table string, purse int) int {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	bankroll := store.get(name)
+	bankroll.Tables[table] = purse
+	if bankroll.topUp(table) {
+		log.Printf("%s topped up to %d", name, STARTING_PURSE)
+		store.save()
+	}
+	return bankroll.Tables[table]
+}
+
+// Returns the biggest stacks and the biggest pots won
+func (store *BankrollStore) leaderboard() Leaderboard {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	leaderboard := Leaderboard{Stacks: []LeaderboardEntry{}, Pots: []LeaderboardEntry{}}
+
+	for _, bankroll := range store.bankrolls {
+		leaderboard.Stacks = append(leaderboard.Stacks, LeaderboardEntry{Name: bankroll.Name, Amount: bankroll.total()})
+		if bankroll.BiggestPot > 0 {
+			leaderboard.Pots = append(leaderboard.Pots, LeaderboardEntry{Name: bankroll.Name, Amount: bankroll.BiggestPot})
+		}
+	}
+
+	leaderboard.Stacks = topEntries(leaderboard.Stacks)
+	leaderboard.Pots = topEntries(leaderboard.Pots)
+
+	return leaderboard
+}
+
+func topEntries(entries []LeaderboardEntry) []LeaderboardEntry {
+	sort.SliceStable(entries, func(i, j int) bool {
+		if entries[i].Amount != entries[j].Amount {
+			return entries[i].Amount > entries[j].Amount
+		}
+		return strings.ToLower(entries[i].Name) < strings.ToLower(entries[j].Name)
+	})
+
+	if len(entries) > LEADERBOARD_SIZE {
+		entries = entries[:LEADERBOARD_SIZE]
+	}
+	return entries
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// A player that timed out is dropped once, however many requests see the table before it is saved
+func TestDroppedPlayerStandsUpOnce(t *testing.T) {
+	bankrolls = BankrollStore{bankrolls: map[string]*Bankroll{}}
+
+	state := createGameState(GAME_FIVE_STUD, fixedLimitStakes, 0, false)
+	state.table = "test"
+	state.maxSeats = 2
+	state.addPlayer("Gone", false)
+	state.addPlayer("Here", false)
+	state.Players[0].Purse = 150
+	state.Players[1].lastPing = time.Now()
+	saveState(state)
+
+	// Requests that don't seat anyone leave the players alone
+	for i := 0; i < 3; i++ {
+		stateCopy := *state
+		stateCopy.setClientPlayerByName("Visitor", false)
+		if len(stateCopy.Players) != 2 {
+			t.Fatalf("a read only request dropped a player")
+		}
+	}
+
+	// A new player at a full table drops the player that timed out, even from copies of the
+	// state that are never saved
+	for i := 0; i < 3; i++ {
+		stateCopy := *state
+		stateCopy.setClientPlayerByName("Visitor", true)
+	}
+
+	bankroll := bankrolls.get("Gone")
+	if bankroll.Chips != 150 || len(bankroll.Tables) != 0 {
+		t.Fatalf("dropped player has %d chips and tables %v, want 150 chips and no tables", bankroll.Chips, bankroll.Tables)
+	}
+}
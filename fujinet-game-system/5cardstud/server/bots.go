@@ -0,0 +1,228 @@
+package main
+
+import (
+	"math/rand"
+	"time"
+
+	"github.com/ericcarrgh/cardrank"
+)
+
+/*
+Bot engine - a bot estimates its chance of winning (equity) by dealing out the rest of the hand many
+times (Monte Carlo), with the cards it can see fixed: its own, the up cards of the other players and
+the community cards. Then:
+
+- With a strong hand for the number of players left, it bets or raises, more if it acts late
+- With a free option, it checks
+- Facing a bet, it calls if its equity beats the pot odds, otherwise it folds
+- Now and then, against one or two players, it bluffs
+
+Each table sets how well its bots play. Easy bots deal out few hands, misjudge them and call too much.
+Hard bots deal out more hands, use their position and bluff more often.
+*/
+
+const (
+	BOT_EASY   = "easy"
+	BOT_NORMAL = "normal"
+	BOT_HARD   = "hard"
+)
+
+// Bots stop dealing out hands after this long, so they always move within BOT_TIME_LIMIT
+const BOT_THINK_TIME = BOT_TIME_LIMIT / time.Duration(4)
+
+type botLevel struct {
+	simulations int     // Hands dealt out to estimate the equity
+	noise       float64 // Random error added to the equity
+	raiseAt     float64 // Strength (equity relative to an even share) to bet or raise with
+	callMargin  float64 // Equity below the pot odds that is still called
+	position    float64 // Strength added when acting last
+	bluff       float64 // Chance to bet or raise with any hand against one or two players
+}
+
+var botLevels = map[string]botLevel{
+	BOT_EASY:   {simulations: 100, noise: 0.15, raiseAt: 1.8, callMargin: 0.08, position: 0, bluff: 0.01},
+	BOT_NORMAL: {simulations: 400, noise: 0.06, raiseAt: 1.5, callMargin: 0.03, position: 0.1, bluff: 0.04},
+	BOT_HARD:   {simulations: 1500, noise: 0.02, raiseAt: 1.35, callMargin: 0, position: 0.2, bluff: 0.07},
+}
+
+// Every card of the deck as a cardrank card, by value and suit
+var rankCards = map[card]cardrank.Card{}
+
+func init() {
+	for suit := 0; suit < 4; suit++ {
+		for value := 2; value < 15; value++ {
+			rankCards[card{value: value, suit: suit}] = cardrank.Must(valueLookup[value] + suitLookup[suit])[0]
+		}
+	}
+}
+
+// Picks the move of the active bot, and the amount for moves that carry one
+func (state *GameState) botMove(moves []validMove) (string, int) {
+	level, ok := botLevels[state.botLevel]
+	if !ok {
+		level = botLevels[BOT_NORMAL]
+	}
+
+	bot := state.Players[state.ActivePlayer]
+	toCall := state.currentBet - bot.Bet
+	pot := state.potAfterCall(toCall)
+
+	opponents := 0
+	toAct := 0
+	for i, player := range state.Players {
+		if i != state.ActivePlayer && player.Status == STATUS_PLAYING {
+			opponents++
+			if player.canAct() && player.Move == "" {
+				toAct++
+			}
+		}
+	}
+
+	equity := state.botEquity(state.ActivePlayer, level.simulations) + (rand.Float64()*2-1)*level.noise
+
+	// Equity relative to an even share of the pot: 1 is average, 2 is twice as likely to win as that.
+	// Acting after the others is worth a little.
+	strength := equity * float64(opponents+1)
+	if opponents > 0 {
+		strength += level.position * (1 - float64(toAct)/float64(opponents))
+	}
+
+	bluffing := opponents <= 2 && rand.Float64() < level.bluff
+
+	findMove := func(codes ...string) (validMove, bool) {
+		for _, code := range codes {
+			for _, move := range moves {
+				if move.Move == code {
+					return move, true
+				}
+			}
+		}
+		return validMove{}, false
+	}
+
+	// Bet or raise a strong hand (or a bluff). Only keep re-raising with a very strong hand.
+	if (strength > level.raiseAt && (state.raiseCount < 2 || strength > level.raiseAt*1.5)) || bluffing {
+		if move, ok := findMove("RA", "BH", "BL", "AI"); ok && (move.Move != "AI" || strength > level.raiseAt*1.5) {
+			return move.Move, botAmount(move, pot, strength-level.raiseAt, bluffing)
+		}
+	}
+
+	if move, ok := findMove("CH", "BB"); ok {
+		return move.Move, 0
+	}
+
+	// Call if the equity beats the pot odds
+	if toCall > 0 && equity+level.callMargin >= float64(toCall)/float64(pot) {
+		if move, ok := findMove("CA"); ok {
+			return move.Move, 0
+		}
+	}
+
+	return "FO", 0
+}
+
+// The amount of a pot or no limit bet or raise, from half the pot up to the pot the stronger the hand
+func botAmount(move validMove, pot int, margin float64, bluffing bool) int {
+	if move.Max == 0 {
+		return 0
+	}
+
+	fraction := 0.5
+	if !bluffing {
+		fraction = minFloat(1, 0.5+margin/2)
+	}
+
+	return minInt(move.Max, maxInt(move.Min, int(fraction*float64(pot))))
+}
+
+// Estimates the chance of a player winning the hand, by dealing out the cards they can't see.
+// Ties count as a share of a win.
+func (state *GameState) botEquity(seat int, simulations int) float64 {
+	typ := state.rankType()
+	player := &state.Players[seat]
+
+	// Cards the player can see are out of the deck
+	seen := map[card]bool{}
+	for _, card := range player.cards {
+		seen[card] = true
+	}
+	for _, card := range state.community {
+		seen[card] = true
+	}
+
+	opponents := [][]card{}
+	for i := range state.Players {
+		visible := state.visibleCards(&state.Players[i])
+		for _, card := range visible {
+			seen[card] = true
+		}
+		if i != seat && state.Players[i].Status == STATUS_PLAYING {
+			opponents = append(opponents, visible)
+		}
+	}
+
+	unseen := []card{}
+	for _, card := range state.deck {
+		if !seen[card] {
+			unseen = append(unseen, card)
+		}
+	}
+
+	if len(opponents) == 0 {
+		return 1
+	}
+
+	handSize := state.handSize()
+	deadline := time.Now().Add(BOT_THINK_TIME)
+	wins := 0.0
+	dealt := 0
+
+	for dealt < simulations && time.Now().Before(deadline) {
+		rand.Shuffle(len(unseen), func(i, j int) { unseen[i], unseen[j] = unseen[j], unseen[i] })
+		next := 0
+
+		// Deals the rest of a hand (or the board) from the unseen cards
+		deal := func(cards []card, size int) []cardrank.Card {
+			hand := make([]cardrank.Card, 0, size)
+			for _, card := range cards {
+				hand = append(hand, rankCards[card])
+			}
+			for len(hand) < size && next < len(unseen) {
+				hand = append(hand, rankCards[unseen[next]])
+				next++
+			}
+			return hand
+		}
+
+		var board []cardrank.Card
+		if state.gameType == GAME_HOLDEM {
+			board = deal(state.community, 5)
+		}
+
+		eval := typ.Eval(deal(player.cards, handSize), board)
+		lost := false
+		ties := 1
+
+		for _, opponent := range opponents {
+			switch eval.Comp(typ.Eval(deal(opponent, handSize), board), false) {
+			case 1:
+				lost = true
+			case 0:
+				ties++
+			}
+			if lost {
+				break
+			}
+		}
+
+		if !lost {
+			wins += 1 / float64(ties)
+		}
+		dealt++
+	}
+
+	if dealt == 0 {
+		return 0
+	}
+	return wins / float64(dealt)
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// A heads up table on the last round, with the cards of each player and the board
+func createBotState(t *testing.T, game string, community string, cards ...string) *GameState {
+	state := createGameState(game, noLimitStakes, 0, false)
+	state.Round = state.lastRound()
+	state.Pot = 100
+	state.ActivePlayer = 0
+	state.community = testCards(t, community)
+	for i, hand := range cards {
+		state.Players = append(state.Players, Player{Name: string(rune('A' + i)), Status: STATUS_PLAYING, Purse: 500, isBot: true, cards: testCards(t, hand)})
+	}
+	return state
+}
+
+func TestBotEquity(t *testing.T) {
+	tests := []struct {
+		name      string
+		game      string
+		community string
+		cards     []string
+		want      float64
+	}{
+		{"made royal flush", GAME_HOLDEM, "AS KS QS JS 2D", []string{"TS 3C", "2C 2H"}, 1},
+		{"royal flush on the board is a tie", GAME_HOLDEM, "AS KS QS JS TS", []string{"2C 3D", "4C 5D"}, 0.5},
+		{"drawing dead against four aces showing", GAME_FIVE_STUD, "", []string{"2C 3D 4H 5S 7C", "KD AS AD AH AC"}, 0},
+		{"alone in the hand", GAME_FIVE_STUD, "", []string{"2C 3D 4H 5S 7C"}, 1},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			state := createBotState(t, test.game, test.community, test.cards...)
+
+			if equity := state.botEquity(0, 200); equity != test.want {
+				t.Fatalf("equity is %f, want %f", equity, test.want)
+			}
+		})
+	}
+}
+
+// However many hands it is asked to deal out, a bot moves in time
+func TestBotThinkTime(t *testing.T) {
+	state := createBotState(t, GAME_HOLDEM, "", "AS KS", "2C 7D", "9H 9D")
+
+	start := time.Now()
+	state.botEquity(0, 1000000000)
+
+	if elapsed := time.Since(start); elapsed > BOT_THINK_TIME+BOT_THINK_TIME/2 {
+		t.Fatalf("bot thought for %s, over %s", elapsed, BOT_THINK_TIME)
+	}
+}
+
+func TestBotMove(t *testing.T) {
+	// Bots that always play by the numbers
+	botLevels["test"] = botLevel{simulations: 200}
+	defer delete(botLevels, "test")
+
+	tests := []struct {
+		name      string
+		game      string
+		community string
+		cards     []string
+		toCall    int
+		want      string
+	}{
+		{"bets the nuts", GAME_HOLDEM, "AS KS QS JS 2D", []string{"TS 3C", "2C 2H"}, 0, "BL"},
+		{"raises the nuts", GAME_HOLDEM, "AS KS QS JS 2D", []string{"TS 3C", "2C 2H"}, 50, "RA"},
+		{"checks a dead hand", GAME_FIVE_STUD, "", []string{"2C 3D 4H 5S 7C", "KD AS AD AH AC"}, 0, "CH"},
+		{"folds a dead hand", GAME_FIVE_STUD, "", []string{"2C 3D 4H 5S 7C", "KD AS AD AH AC"}, 50, "FO"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			state := createBotState(t, test.game, test.community, test.cards...)
+			state.botLevel = "test"
+			state.Players[1].Bet = test.toCall
+			state.currentBet = test.toCall
+			state.raiseAmount = test.toCall
+
+			moves := state.getValidMoves()
+			move, amount := state.botMove(moves)
+			if move != test.want {
+				t.Fatalf("bot moved %s, want %s", move, test.want)
+			}
+
+			// Amounts are always in the range of the move
+			if valid, _ := findMove(moves, move); valid.Max > 0 && (amount < valid.Min || amount > valid.Max) {
+				t.Fatalf("bot moved %s %d, out of %d to %d", move, amount, valid.Min, valid.Max)
+			}
+		})
+	}
+}
+
+func TestBotAmount(t *testing.T) {
+	tests := []struct {
+		name     string
+		move     validMove
+		pot      int
+		margin   float64
+		bluffing bool
+		want     int
+	}{
+		{"fixed limit has no amount", validMove{Move: "BL"}, 100, 1, false, 0},
+		{"half the pot with a fair hand", validMove{Move: "BL", Min: 5, Max: 500}, 100, 0, false, 50},
+		{"the pot with a strong hand", validMove{Move: "BL", Min: 5, Max: 500}, 100, 2, false, 100},
+		{"half the pot to bluff", validMove{Move: "BL", Min: 5, Max: 500}, 100, 2, true, 50},
+		{"at least the smallest bet", validMove{Move: "RA", Min: 80, Max: 500}, 100, 0, false, 80},
+		{"at most the purse", validMove{Move: "RA", Min: 5, Max: 30}, 100, 0, false, 30},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := botAmount(test.move, test.pot, test.margin, test.bluffing); got != test.want {
+				t.Fatalf("botAmount() = %d, want %d", got, test.want)
+			}
+		})
+	}
+}
@@ -3,7 +3,6 @@ package main
 import (
 	"fmt"
 	"log"
-	"math"
 	"math/rand"
 	"sort"
 	"strings"
@@ -15,15 +14,20 @@ import (
 )
 
 /*
-5 Card Stud Rules below to serve as guideline.
+5 Card Stud Rules below to serve as guideline. Seven Card Stud and Texas Hold'em tables follow the
+same betting, see gameVariants.go for how they differ.
 
 The logic to support below is not all implemented, and will be done as time allows.
 
-Rules -  Assume Limit betting: Anti 1, Bringin 2,  Low 5, High 10
+Rules -  Assume Limit betting: Anti 1, Bringin 2,  Low 5, High 10 (the default stakes, see stakes.go for others)
 Suit Rank (for comparing first to act): S,H,D,C
 
 Winning hands - tied hands split the pot, remainder is discarded
 
+All-in - a player that can't cover a bet may call (or bet) with whatever is left in their purse.
+They stay in the hand without acting further, and can only win the part of the pot they matched.
+The pot is split in a main pot and side pots by contribution level when the game ends.
+
 1. All players anti (e.g.) 1
 2. First round
   - Player with lowest card goes first, with a mandatory bring in of 2. Option to make full bet (5)
@@ -37,6 +41,7 @@ Winning hands - tied hands split the pot, remainder is discarded
 	- 4th street+ - 10
 */
 
+// Default stakes of a table, see stakes.go
 const ANTE = 1
 const BRINGIN = 2
 const LOW = 5
@@ -63,8 +68,11 @@ var moveLookup = map[string]string{
 	"BH": "BET", // BET HIGH (e.g. 10)
 	"CA": "CALL",
 	"RA": "RAISE",
+	"AI": "ALL-IN", // BET or RAISE everything left, when short of a full bet
 }
 
+const MOVE_ALL_IN = "ALL-IN"
+
 var botNames = []string{"Clyd", "Jim", "Kirk", "Hulk", "Fry", "Meg", "Grif", "GPT"}
 
 // For simplicity on the 8bit side (using switch statement), using a single character for each key.
@@ -74,6 +82,8 @@ var botNames = []string{"Clyd", "Jim", "Kirk", "Hulk", "Fry", "Meg", "Grif", "GP
 type validMove struct {
 	Move string `json:"m"`
 	Name string `json:"n"`
+	Min  int    `json:"l,omitempty"` // Smallest and largest amount, for moves that carry one
+	Max  int    `json:"h,omitempty"`
 }
 
 type card struct {
@@ -102,6 +112,14 @@ type Player struct {
 	isBot    bool
 	cards    []card
 	lastPing time.Time
+	allIn    bool // No chips left to bet this game, but still in the hand
+	invested int  // Total put in the pot this game (ante and bets), to build the side pots
+}
+
+// A pot (main or side) and the players that can win it
+type pot struct {
+	amount   int
+	eligible []int
 }
 
 type GameState struct {
@@ -114,10 +132,22 @@ type GameState struct {
 	Viewing      int         `json:"v"`
 	ValidMoves   []validMove `json:"vm"`
 	Players      []Player    `json:"pl"`
+	Game         string      `json:"g,omitempty"`
+	Community    string      `json:"c,omitempty"`
+	Betting      string      `json:"b,omitempty"`
+	Tournament   string      `json:"t,omitempty"`
 
 	// Internal
 	deck          []card
 	deckIndex     int
+	gameType      string
+	stakes        Stakes
+	botLevel      string
+	maxSeats      int         // Fewer seats than the game allows, 0 for all of them
+	hand          HandHistory // The hand being played, for the hand history
+	tournament    Tournament
+	community     []card
+	dealer        int
 	currentBet    int
 	gameOver      bool
 	clientPlayer  int
@@ -128,6 +158,8 @@ type GameState struct {
 	raiseCount    int
 	raiseAmount   int
 	registerLobby bool
+	reportResults bool   // Tournament results go to the lobby, even from tables that aren't listed there
+	inviteCode    string // Needed to join a private table
 	hash          string //   `json:"z"` // external later
 }
 
@@ -137,6 +169,11 @@ type GameTable struct {
 	Name       string `json:"n"`
 	CurPlayers int    `json:"p"`
 	MaxPlayers int    `json:"m"`
+	Game       string `json:"g,omitempty"`
+	Betting    string `json:"b,omitempty"`
+
+	// Internal
+	config TableConfig
 }
 
 func initializeGameServer() {
@@ -147,7 +184,7 @@ func initializeGameServer() {
 	}
 }
 
-func createGameState(playerCount int, registerLobby bool) *GameState {
+func createGameState(gameType string, stakes Stakes, playerCount int, registerLobby bool) *GameState {
 
 	deck := []card{}
 
@@ -164,6 +201,9 @@ func createGameState(playerCount int, registerLobby bool) *GameState {
 	state.Round = 0
 	state.ActivePlayer = -1
 	state.registerLobby = registerLobby
+	state.gameType = gameType
+	state.stakes = stakes
+	state.community = []card{}
 
 	// Pre-populate player pool with bots
 	for i := 0; i < playerCount; i++ {
@@ -222,8 +262,8 @@ func (state *GameState) newRound() {
 
 			// First round of a new game
 
-			// A bot will leave if it has under 25 chips, another will take their place
-			if player.isBot && player.Purse < 25 {
+			// A bot will leave if it has under 25 chips, another will take their place (except in a tournament)
+			if player.isBot && player.Purse < 25 && !state.isTournament() {
 				player.Purse = STARTING_PURSE
 				for j := 0; j < len(botNames); j++ {
 					botNameUsed := false
@@ -240,11 +280,24 @@ func (state *GameState) newRound() {
 				}
 			}
 
-			// Reset player status and take the ANTI
-			if player.Purse > 2 {
+			// A broke player may be due their daily top-up
+			if !player.isBot && player.Purse < TOPUP_BELOW && !state.isTournament() {
+				player.Purse = bankrolls.topUp(player.Name, state.table, player.Purse)
+			}
+
+			// Reset player status and take the ANTI (Hold'em posts blinds instead).
+			// In a tournament, a player plays on until their purse is empty.
+			player.allIn = false
+			player.invested = 0
+			if player.Purse > 2 || (state.isTournament() && player.Purse > 0) {
 				player.Status = STATUS_PLAYING
-				player.Purse -= ANTE
-				state.Pot += ANTE
+				if state.gameType != GAME_HOLDEM {
+					ante := minInt(state.stakes.Ante, player.Purse)
+					player.Purse -= ante
+					player.invested += ante
+					state.Pot += ante
+					player.allIn = player.Purse == 0
+				}
 			} else {
 				// Player doesn't have enough money to play
 				player.Status = STATUS_WAITING
@@ -252,8 +305,11 @@ func (state *GameState) newRound() {
 			player.cards = []card{}
 		}
 
-		// Reset player's last move/bet for this round
+		// Reset player's last move/bet for this round. All-in players keep showing they are all-in.
 		player.Move = ""
+		if player.allIn && player.Status == STATUS_PLAYING {
+			player.Move = MOVE_ALL_IN
+		}
 		player.Bet = 0
 	}
 
@@ -261,7 +317,7 @@ func (state *GameState) newRound() {
 	state.raiseCount = 0
 	state.raiseAmount = 0
 
-	// First round of a new game? Shuffle the cards and deal an extra card
+	// First round of a new game? Shuffle the cards
 	if state.Round == 1 {
 
 		// Shuffle the deck 7 times :)
@@ -269,14 +325,16 @@ func (state *GameState) newRound() {
 			rand.Shuffle(len(state.deck), func(i, j int) { state.deck[i], state.deck[j] = state.deck[j], state.deck[i] })
 		}
 		state.deckIndex = 0
-		state.dealCards()
+		state.community = []card{}
 		if state.LastResult == WAITING_MESSAGE {
 			state.LastResult = ""
 		}
+
+		state.startHand()
 	}
 
-	state.dealCards()
-	state.ActivePlayer = state.getPlayerWithBestVisibleHand(state.Round > 1)
+	state.dealRound()
+	state.setFirstToAct()
 	state.resetPlayerTimer(true)
 }
 
@@ -287,7 +345,7 @@ func (state *GameState) getPlayerWithBestVisibleHand(highHand bool) int {
 	for i := 0; i < len(state.Players); i++ {
 		player := &state.Players[i]
 		if player.Status == STATUS_PLAYING {
-			rank := getRank(player.cards[1:len(player.cards)])
+			rank := getRank(state.visibleCards(player))
 
 			// Add player number to start of rank to hold on to when sorting
 			rank = append([]int{i}, rank...)
@@ -326,6 +384,7 @@ func (state *GameState) dealCards() {
 			player.cards = append(player.cards, state.deck[state.deckIndex])
 			state.Players[i] = player
 			state.deckIndex++
+			state.recordCard(&player, state.deck[state.deckIndex-1], state.isCardVisible(len(player.cards)-1))
 		}
 	}
 }
@@ -340,10 +399,19 @@ func (state *GameState) addPlayer(playerName string, isBot bool) {
 		isBot:  isBot,
 	}
 
+	// Players bring their bankroll to the table. Tournaments start everybody with the same stack.
+	if state.isTournament() {
+		newPlayer.Purse = TOURNAMENT_STACK
+	} else if !isBot {
+		newPlayer.Purse = bankrolls.sitDown(playerName, state.table)
+	}
+
 	state.Players = append(state.Players, newPlayer)
 }
 
-func (state *GameState) setClientPlayerByName(playerName string) {
+// Sets the player making the request. With seat, a player that is not at the table is seated if there
+// is room, dropping players that timed out to make it. Without it, the players are left as they are.
+func (state *GameState) setClientPlayerByName(playerName string, seat bool) {
 	// If no player name was passed, simply return. This is an anonymous viewer.
 	if len(playerName) == 0 {
 		state.clientPlayer = -1
@@ -351,6 +419,10 @@ func (state *GameState) setClientPlayerByName(playerName string) {
 	}
 	state.clientPlayer = slices.IndexFunc(state.Players, func(p Player) bool { return strings.EqualFold(p.Name, playerName) })
 
+	if !seat {
+		return
+	}
+
 	// If a new player is joining, remove any old players that timed out to make space
 	if state.clientPlayer < 0 {
 		// Drop any players that left to make space
@@ -358,7 +430,7 @@ func (state *GameState) setClientPlayerByName(playerName string) {
 	}
 
 	// Add new player if there is room
-	if state.clientPlayer < 0 && len(state.Players) < 8 {
+	if state.clientPlayer < 0 && state.canSeat() {
 		state.addPlayer(playerName, false)
 		state.clientPlayer = len(state.Players) - 1
 
@@ -372,8 +444,9 @@ func (state *GameState) setClientPlayerByName(playerName string) {
 	// Extra logic if a player is requesting
 	if state.clientPlayer > 0 {
 
-		// In case a player returns while they are still in the "LEFT" status (before the current game ended), add them back in as waiting
-		if state.Players[state.clientPlayer].Status == STATUS_LEFT {
+		// In case a player returns while they are still in the "LEFT" status (before the current game ended), add them back in as waiting.
+		// A player that left a tournament is out.
+		if state.Players[state.clientPlayer].Status == STATUS_LEFT && !state.tournament.started {
 			state.Players[state.clientPlayer].Status = STATUS_WAITING
 		}
 	}
@@ -387,7 +460,7 @@ func (state *GameState) endGame(abortGame bool) {
 
 	state.gameOver = true
 	state.ActivePlayer = -1
-	state.Round = 5
+	state.Round = state.lastRound() + 1
 
 	remainingPlayers := []int{}
 	pockets := [][]cardrank.Card{}
@@ -396,67 +469,189 @@ func (state *GameState) endGame(abortGame bool) {
 		state.Pot += player.Bet
 		if !abortGame && player.Status == STATUS_PLAYING {
 			remainingPlayers = append(remainingPlayers, index)
-			hand := ""
-			// Loop through and build hand string
-			for _, card := range player.cards {
-				hand += valueLookup[card.value] + suitLookup[card.suit]
-			}
-			pockets = append(pockets, cardrank.Must(hand))
+			pockets = append(pockets, cardrank.Must(cardsString(player.cards)))
 		}
 	}
 
-	evs := cardrank.StudFive.EvalPockets(pockets, nil)
-	order, pivot := cardrank.Order(evs, false)
-
-	if pivot == 0 {
+	if len(remainingPlayers) == 0 {
 		// If nobody won, the game was aborted. Display the waiting message if this
 		// server does not contains bots.
 		humanAvailSlots, _ := state.getHumanPlayerCountInfo()
-		if humanAvailSlots == 8 {
+		if humanAvailSlots == state.seats() {
 			state.LastResult = WAITING_MESSAGE
 			state.moveExpires = time.Now().Add(ENDGAME_TIME_LIMIT)
 		} else {
 			state.moveExpires = time.Now()
 		}
+		state.finishHand("Game aborted")
 		return
 	}
 
-	// Int divide, so "house" takes remainder
-	perPlayerWinnings := state.Pot / pivot
+	// Hands are only evaluated at a showdown. A player that won by folds may not have all their cards yet.
+	evs := []*cardrank.Eval{}
+	if len(remainingPlayers) > 1 {
+		evs = state.evalPockets(pockets)
+
+		for i, index := range remainingPlayers {
+			player := state.Players[index]
+			state.hand.Showdown = append(state.hand.Showdown, HistoryShowdown{Player: player.Name, Cards: cardsString(player.cards), Hand: strings.Split(fmt.Sprint(evs[i]), " [")[0]})
+		}
+	}
 
 	result := ""
+	sideWinners := []string{}
+	winnings := map[string]int{} // By name, as players that left are dropped during the hand
+
+	for potIndex, pot := range state.buildPots(remainingPlayers) {
+
+		// Find the best hands among the players eligible for this pot
+		winners := pot.eligible
+		var bestHand *cardrank.Eval
+		if len(pot.eligible) > 1 {
+			potEvs := []*cardrank.Eval{}
+			for _, index := range pot.eligible {
+				potEvs = append(potEvs, evs[slices.Index(remainingPlayers, index)])
+			}
+			potOrder, potPivot := cardrank.Order(potEvs, false)
+
+			winners = []int{}
+			for i := 0; i < potPivot; i++ {
+				winners = append(winners, pot.eligible[potOrder[i]])
+			}
+			bestHand = potEvs[potOrder[0]]
+		}
+
+		// Int divide, so "house" takes remainder
+		perPlayerWinnings := pot.amount / len(winners)
+
+		historyPot := HistoryPot{Amount: pot.amount, Winners: []string{}, Share: perPlayerWinnings}
 
-	for i := 0; i < pivot; i++ {
-		player := &state.Players[remainingPlayers[order[i]]]
+		names := ""
+		for _, index := range winners {
+			player := &state.Players[index]
 
-		// Award winnings to player's purse
-		player.Purse += int(perPlayerWinnings)
+			// Award winnings to player's purse
+			player.Purse += perPlayerWinnings
+			winnings[player.Name] += perPlayerWinnings
 
-		// Add player's name to result
-		if result != "" {
-			result += " and "
+			// Add player's name to result
+			if names != "" {
+				names += " and "
+			}
+			names += player.Name
+			historyPot.Winners = append(historyPot.Winners, player.Name)
+		}
+		state.hand.Pots = append(state.hand.Pots, historyPot)
+
+		if potIndex == 0 {
+			result = names
+
+			if bestHand != nil {
+				result += strings.Join(strings.Split(strings.Split(fmt.Sprintf(" won with %s", bestHand), " [")[0], ",")[0:2], ",")
+				result = strings.ReplaceAll(result, "kickers", "kicker")
+			}
+		} else if !strings.HasPrefix(result, names+" ") && !slices.Contains(sideWinners, names) {
+			sideWinners = append(sideWinners, names)
 		}
-		result += player.Name
 	}
 
 	if len(remainingPlayers) > 1 {
 		state.wonByFolds = false
-		result += strings.Join(strings.Split(strings.Split(fmt.Sprintf(" won with %s", evs[order[0]]), " [")[0], ",")[0:2], ",")
-		result = strings.ReplaceAll(result, "kickers", "kicker")
+		if len(sideWinners) > 0 {
+			result += ", side pot to " + strings.Join(sideWinners, ", ")
+		}
 	} else {
 		state.wonByFolds = true
 		result += " won by default"
 	}
 	state.LastResult = result
 
+	// Save the purses of the players, and the pots they won, to their bankrolls
+	for _, player := range state.Players {
+		if !player.isBot && !state.isTournament() {
+			bankrolls.endGame(player.Name, state.table, player.Purse, winnings[player.Name])
+		}
+	}
+
 	state.moveExpires = time.Now().Add(ENDGAME_TIME_LIMIT)
 
+	// Players with an empty purse are out of a tournament
+	if state.isTournament() {
+		state.LastResult = state.eliminatePlayers(state.LastResult)
+	}
+
+	for i, seat := range state.hand.Seats {
+		state.hand.Seats[i].Won = winnings[seat.Name]
+	}
+	state.finishHand(state.LastResult)
+
 	log.Println(result)
 }
 
-// Emulates simplified player/logic for 5 card stud
+// Splits the pot in a main pot and side pots, one per all-in contribution level,
+// each with the remaining players that put in at least that much
+func (state *GameState) buildPots(remainingPlayers []int) []pot {
+	levels := []int{}
+	for _, index := range remainingPlayers {
+		if !slices.Contains(levels, state.Players[index].invested) {
+			levels = append(levels, state.Players[index].invested)
+		}
+	}
+	sort.Ints(levels)
+
+	pots := []pot{}
+	previous := 0
+	total := 0
+
+	for _, level := range levels {
+		newPot := pot{}
+
+		// Every player (including those who folded or left) contributes up to the level
+		for _, player := range state.Players {
+			newPot.amount += maxInt(0, minInt(player.invested, level)-previous)
+		}
+
+		for _, index := range remainingPlayers {
+			if state.Players[index].invested >= level {
+				newPot.eligible = append(newPot.eligible, index)
+			}
+		}
+
+		total += newPot.amount
+		previous = level
+		pots = append(pots, newPot)
+	}
+
+	if len(pots) == 0 {
+		return pots
+	}
+
+	// Players that folded after betting more than any remaining player contribute to the last pot
+	for _, player := range state.Players {
+		if player.invested > previous {
+			pots[len(pots)-1].amount += player.invested - previous
+			total += player.invested - previous
+		}
+	}
+
+	// Anything not accounted for by contributions (e.g. from players dropped mid game) goes to the main pot
+	if state.Pot > total {
+		pots[0].amount += state.Pot - total
+	}
+
+	return pots
+}
+
+// Emulates simplified player/logic for 5 card stud. Called by the ticker of the table (see ticker.go).
 func (state *GameState) runGameLogic() {
-	state.playerPing()
+
+	// A tournament waits for every seat to be taken
+	if state.isTournament() && !state.startTournament() {
+		state.Round = 0
+		state.Pot = 0
+		state.ActivePlayer = -1
+		return
+	}
 
 	// We can't play a game until there are at least 2 players
 	if len(state.Players) < 2 {
@@ -479,6 +674,9 @@ func (state *GameState) runGameLogic() {
 
 		// Create a new game if the end game delay is past
 		if int(time.Until(state.moveExpires).Seconds()) < 0 {
+			if state.isTournament() && !state.nextTournamentGame() {
+				return
+			}
 			state.dropInactivePlayers(false, false)
 			state.Round = 0
 			state.Pot = 0
@@ -502,13 +700,10 @@ func (state *GameState) runGameLogic() {
 		return
 	}
 
-	// Check if we should start the next round. One of the following must be true
-	// 1. We got back to the player who made the most recent bet/raise
-	// 2. There were checks/folds around the table
+	// Check if we should start the next round
 	if state.ActivePlayer > -1 {
-		if (state.currentBet > 0 && state.Players[state.ActivePlayer].Bet == state.currentBet) ||
-			(state.currentBet == 0 && state.Players[state.ActivePlayer].Move != "") {
-			if state.Round == 4 {
+		if state.roundComplete() {
+			if state.Round == state.lastRound() {
 				state.endGame(false)
 			} else {
 				state.newRound()
@@ -542,73 +737,26 @@ func (state *GameState) runGameLogic() {
 
 	// Force a move for this player or BOT if they are in the game and have not folded
 	if state.Players[state.ActivePlayer].Status == STATUS_PLAYING {
-		cards := state.Players[state.ActivePlayer].cards
 		moves := state.getValidMoves()
 
+		// If this is a bot, let the bot engine pick the move (see bots.go)
+		if state.Players[state.ActivePlayer].isBot {
+			move, amount := state.botMove(moves)
+			state.performMove(move, amount, true)
+			return
+		}
+
 		// Default to FOLD
 		choice := 0
 
-		// Never fold if CHECK is an option. This applies to forced player moves as well as bots
+		// Never fold if CHECK is an option
 		if len(moves) > 1 && moves[1].Move == "CH" {
 			choice = 1
 		}
 
-		// If this is a bot, pick the best move using some simple logic (sometimes random)
-		if state.Players[state.ActivePlayer].isBot {
-
-			// Potential TODO: If on round 5 and check is not an option, fold if there is a visible hand that beats the bot's hand.
-			//if len(cards) == 5 && len(moves) > 1 && moves[1].Move == "CH" {}
-
-			// Hardly ever fold early if a BOT has an jack or higher.
-			if state.Round < 3 && len(moves) > 1 && rand.Intn(3) > 0 && slices.ContainsFunc(cards, func(c card) bool { return c.value > 10 }) {
-				choice = 1
-			}
-
-			// Likely don't fold if BOT has a pair or better
-			rank := getRank(cards)
-			if rank[0] < 300 && rand.Intn(20) > 0 {
-				choice = 1
-			}
-
-			// Don't fold if BOT has a 2 pair or better
-			if rank[0] < 200 {
-				choice = 1
-			}
-
-			// Raise the bet if three of a kind or better
-			if len(moves) > 2 && rank[0] < 312 && state.currentBet < LOW {
-				choice = 2
-			} else if len(moves) > 2 && state.getPlayerWithBestVisibleHand(true) == state.ActivePlayer && state.currentBet < HIGH && (rank[0] < 306) {
-				choice = len(moves) - 1
-			} else {
-
-				// Consider bet/call/raise most of the time
-				if len(moves) > 1 && rand.Intn(3) > 0 && (len(cards) > 2 ||
-					cards[0].value == cards[1].value ||
-					math.Abs(float64(cards[1].value-cards[0].value)) < 3 ||
-					cards[0].value > 8 ||
-					cards[1].value > 5) {
-
-					// Avoid endless raises
-					if state.currentBet >= 20 || rand.Intn(3) > 0 {
-						choice = 1
-					} else {
-						choice = rand.Intn(len(moves)-1) + 1
-					}
-
-				}
-			}
-		}
-
-		// Bounds check - clamp the move to the end of the array if a higher move is desired.
-		// This may occur if a bot wants to call, but cannot, due to limited funds.
-		if choice > len(moves)-1 {
-			choice = len(moves) - 1
-		}
-
 		move := moves[choice]
 
-		state.performMove(move.Move, true)
+		state.performMove(move.Move, 0, true)
 	}
 
 }
@@ -622,9 +770,13 @@ func (state *GameState) dropInactivePlayers(inMiddleOfGame bool, dropForNewPlaye
 		currentPlayerName = state.Players[state.clientPlayer].Name
 	}
 
+	dropped := []Player{}
+
 	for _, player := range state.Players {
 		if len(state.Players) > 0 && player.Status != STATUS_LEFT && (inMiddleOfGame || player.isBot || player.lastPing.Compare(cutoff) > 0) {
 			players = append(players, player)
+		} else {
+			dropped = append(dropped, player)
 		}
 	}
 
@@ -633,6 +785,17 @@ func (state *GameState) dropInactivePlayers(inMiddleOfGame bool, dropForNewPlaye
 		return
 	}
 
+	// Dropped players take what is left of their purse back to their bankroll, or are out of a tournament
+	for _, player := range dropped {
+		if state.tournament.started {
+			if !state.isPlaced(player.Name) {
+				state.placePlayer(player)
+			}
+		} else if !player.isBot && !state.isTournament() {
+			bankrolls.standUp(player.Name, state.table, player.Purse)
+		}
+	}
+
 	// Store if players were dropped, before updating the state player array
 	playersWereDropped := len(state.Players) != len(players)
 
@@ -668,6 +831,10 @@ func (state *GameState) clientLeave() {
 	}
 	player := &state.Players[state.clientPlayer]
 
+	if player.Status == STATUS_PLAYING && !state.gameOver {
+		state.recordAction(HistoryAction{Player: player.Name, Action: ACTION_LEAVE})
+	}
+
 	player.Status = STATUS_LEFT
 	player.Move = "LEFT"
 
@@ -692,8 +859,9 @@ func (state *GameState) playerPing() {
 	state.Players[state.clientPlayer].lastPing = time.Now()
 }
 
-// Performs the requested move for the active player, and returns true if successful
-func (state *GameState) performMove(move string, internalCall ...bool) bool {
+// Performs the requested move for the active player, and returns true if successful.
+// The amount is only used by moves that carry one (pot and no limit), 0 for the smallest allowed.
+func (state *GameState) performMove(move string, amount int, internalCall ...bool) bool {
 
 	if len(internalCall) == 0 || !internalCall[0] {
 		state.playerPing()
@@ -708,10 +876,25 @@ func (state *GameState) performMove(move string, internalCall ...bool) bool {
 	}
 
 	// Only perform move if it is a valid move for this player
-	if !slices.ContainsFunc(state.getValidMoves(), func(m validMove) bool { return m.Move == move }) {
+	moves := state.getValidMoves()
+	moveIndex := slices.IndexFunc(moves, func(m validMove) bool { return m.Move == move })
+	if moveIndex < 0 {
 		return false
 	}
 
+	// The amount must be within the range of the move, if it has one
+	if moves[moveIndex].Max > 0 {
+		if amount == 0 {
+			amount = moves[moveIndex].Min
+		}
+		if amount < moves[moveIndex].Min || amount > moves[moveIndex].Max {
+			return false
+		}
+	}
+
+	bet := state.currentBet
+	paid := 0
+
 	if move == "FO" { // FOLD
 		player.Status = STATUS_FOLDED
 	} else if move != "CH" { // Not Checking
@@ -721,31 +904,56 @@ func (state *GameState) performMove(move string, internalCall ...bool) bool {
 
 		if move == "RA" {
 			raise = state.raiseAmount
+			if state.hasAmounts() {
+				// The next raise must be at least as big as this one
+				raise = amount
+				state.raiseAmount = maxInt(state.raiseAmount, amount)
+			}
 			state.raiseCount++
 		} else if move == "BH" {
-			raise = HIGH
-			state.raiseAmount = HIGH
+			raise = state.stakes.High
+			state.raiseAmount = state.stakes.High
 		} else if move == "BL" {
-			raise = LOW
-			state.raiseAmount = LOW
-
-			// If betting LOW the very first time and the pot is BRINGIN
-			// just make their bet enough to make the total bet LOW
-			if state.currentBet == BRINGIN {
-				raise -= BRINGIN
+			bet := state.stakes.Low
+			if state.hasAmounts() {
+				bet = amount
 			}
+			state.raiseAmount = bet
+
+			// If betting the very first time over a BRINGIN (or a short blind)
+			// just make their bet enough to make the total bet the size of the bet
+			raise = bet - state.currentBet
 		} else if move == "BB" {
-			raise = BRINGIN
+			raise = state.stakes.BringIn
+		} else if move == "AI" {
+			// Bet everything left, raising by whatever is above the current bet
+			raise = maxInt(0, player.Bet+player.Purse-state.currentBet)
+			if state.raiseAmount == 0 {
+				state.raiseAmount = state.streetBet()
+			}
+			if raise >= state.raiseAmount {
+				state.raiseCount++
+			}
 		}
 
-		// Place the bet
+		// Place the bet. A player that can't cover it is all-in with what is left in their purse
 		delta := state.currentBet + raise - player.Bet
-		state.currentBet += raise
+		if delta >= player.Purse {
+			delta = player.Purse
+			player.allIn = true
+		}
+		state.currentBet = maxInt(state.currentBet, player.Bet+delta)
 		player.Bet += delta
 		player.Purse -= delta
+		player.invested += delta
+		paid = delta
 	}
 
 	player.Move = moveLookup[move]
+	if player.allIn {
+		player.Move = MOVE_ALL_IN
+	}
+	state.recordMove(player, move, bet, paid, len(internalCall) > 0 && internalCall[0])
 	state.nextValidPlayer()
 
 	return true
@@ -766,16 +974,48 @@ func (state *GameState) resetPlayerTimer(newRound bool) {
 }
 
 func (state *GameState) nextValidPlayer() {
-	// Move to next player
-	state.ActivePlayer = (state.ActivePlayer + 1) % len(state.Players)
-
-	// Skip over player if not in this game (joined late / folded)
-	for state.Players[state.ActivePlayer].Status != STATUS_PLAYING {
+	// Move to next player, skipping over players not in this game (joined late / folded) or all-in.
+	// If nobody can act (everyone left is all-in), the round is complete anyway.
+	for i := 0; i < len(state.Players); i++ {
 		state.ActivePlayer = (state.ActivePlayer + 1) % len(state.Players)
+		if state.Players[state.ActivePlayer].canAct() {
+			break
+		}
 	}
 	state.resetPlayerTimer(false)
 }
 
+// Returns true if the player is in the hand and has chips left to bet
+func (player *Player) canAct() bool {
+	return player.Status == STATUS_PLAYING && !player.allIn
+}
+
+// The round of betting is complete when every player that can still act has moved and matched
+// the current bet. If only one player can act (the others are all-in), they just need to match it.
+func (state *GameState) roundComplete() bool {
+	canAct := 0
+	for _, player := range state.Players {
+		if player.canAct() {
+			canAct++
+		}
+	}
+
+	for _, player := range state.Players {
+		if player.canAct() && (player.Bet < state.currentBet || (canAct > 1 && player.Move == "")) {
+			return false
+		}
+	}
+	return true
+}
+
+// The size of a bet on this street (LOW on 2nd and 3rd street, HIGH after). Pot and no limit bets start at LOW.
+func (state *GameState) streetBet() int {
+	if state.Round < 3 || state.hasAmounts() {
+		return state.stakes.Low
+	}
+	return state.stakes.High
+}
+
 func (state *GameState) getValidMoves() []validMove {
 	moves := []validMove{}
 
@@ -785,55 +1025,99 @@ func (state *GameState) getValidMoves() []validMove {
 	}
 
 	player := state.Players[state.ActivePlayer]
+	toCall := state.currentBet - player.Bet
 
 	// First check options if there is no BET yet (a BRINGIN is not considered a BET)
-	if state.currentBet < LOW {
+	if state.currentBet < state.stakes.Low {
 		// If nothing has been bet, force BET BRINGIN (2) on round 1
 		// otherwise a CHECK.
-		// If there is a bet, allow for a CALL
+		// If there is a bet, allow for a CALL (all-in if short)
 		if state.currentBet == 0 {
 			if state.Round == 1 {
-				moves = append(moves, validMove{Move: "BB", Name: fmt.Sprint("Post ", BRINGIN)})
+				moves = append(moves, validMove{Move: "BB", Name: fmt.Sprint("Post ", minInt(state.stakes.BringIn, player.Purse))})
 			} else {
 				moves = append(moves, validMove{Move: "CH", Name: "Check"})
 			}
-		} else if player.Purse >= state.currentBet-player.Bet {
-			moves = append(moves, validMove{Move: "CA", Name: "Call"})
+		} else {
+			moves = append(moves, callMove(player, toCall))
 		}
 
-		// Allow LOW bet on 2nd and 3rd street
-		if player.Purse >= LOW && state.Round < 3 {
-			moves = append(moves, validMove{Move: "BL", Name: fmt.Sprint("Bet ", LOW)})
+		if state.hasAmounts() {
+			// Allow a bet of any amount from LOW up to the limit
+			if player.Purse >= state.stakes.Low {
+				moves = append(moves, validMove{Move: "BL", Name: "Bet", Min: state.stakes.Low, Max: state.maxBet(player, toCall)})
+			}
+		} else {
+			// Allow LOW bet on 2nd and 3rd street
+			if player.Purse >= state.stakes.Low && state.Round < 3 {
+				moves = append(moves, validMove{Move: "BL", Name: fmt.Sprint("Bet ", state.stakes.Low)})
+			}
+
+			// Allow HIGH bet if on 4th or 5th street, or 3rd street + pair showing
+			if player.Purse >= state.stakes.High && (state.Round >= 3 || (state.Round == 2 && state.openPairShowing())) {
+				moves = append(moves, validMove{Move: "BH", Name: fmt.Sprint("Bet ", state.stakes.High)})
+			}
 		}
 
-		// Allow HIGH bet if on 4th or 5th street, or 3rd street + pair showing
-		if player.Purse >= HIGH && (state.Round >= 3 ||
-			(state.Round == 2 && slices.IndexFunc(state.Players, func(p Player) bool {
-				return p.Status == STATUS_PLAYING && p.cards[1].value == p.cards[2].value
-			}) >= 0)) {
-			moves = append(moves, validMove{Move: "BH", Name: fmt.Sprint("Bet ", HIGH)})
+		// Short of a full bet, but with more than needed to call, a player may bet all-in
+		lastMove := moves[len(moves)-1].Move
+		if lastMove != "BB" && lastMove != "BL" && lastMove != "BH" && player.Purse > toCall && player.Purse < state.streetBet() {
+			moves = append(moves, validMove{Move: "AI", Name: "All-in"})
 		}
 	} else {
-		// A bet as already been made. Allow a call
-		if player.Purse >= state.currentBet-player.Bet {
-			moves = append(moves, validMove{Move: "CA", Name: "Call"})
+		// A bet as already been made. Allow a call (all-in if short), or a check for
+		// the Hold'em big blind when nobody raised it
+		if toCall == 0 {
+			moves = append(moves, validMove{Move: "CH", Name: "Check"})
+		} else {
+			moves = append(moves, callMove(player, toCall))
 		}
 
-		// Allow a raise if max number of rounds for the round has not been met
-		if state.Players[state.ActivePlayer].Purse >= state.currentBet-player.Bet+state.raiseAmount && state.raiseCount < 3 {
-			moves = append(moves, validMove{Move: "RA", Name: fmt.Sprint("Raise ", state.raiseAmount)})
+		// Allow a raise if max number of rounds for the round has not been met. Short of a full raise, allow all-in.
+		if state.canRaise() {
+			if player.Purse >= toCall+state.raiseAmount && state.hasAmounts() {
+				moves = append(moves, validMove{Move: "RA", Name: "Raise", Min: state.raiseAmount, Max: state.maxRaise(player, toCall)})
+			} else if player.Purse >= toCall+state.raiseAmount {
+				moves = append(moves, validMove{Move: "RA", Name: fmt.Sprint("Raise ", state.raiseAmount)})
+			} else if player.Purse > toCall {
+				moves = append(moves, validMove{Move: "AI", Name: "All-in"})
+			}
 		}
 	}
 
 	return moves
 }
 
+// Returns the CALL move, named all-in if the player can't cover the bet
+func callMove(player Player, toCall int) validMove {
+	if player.Purse <= toCall {
+		return validMove{Move: "CA", Name: "All-in"}
+	}
+	return validMove{Move: "CA", Name: "Call"}
+}
+
 // Creates a copy of the state and modifies it to be from the
 // perspective of this client (e.g. player array, visible cards)
 func (state *GameState) createClientState() *GameState {
 
 	stateCopy := *state
 
+	// Seven Card Stud and Hold'em tables say what they are playing. Hold'em also shows the community cards.
+	if state.gameType != GAME_FIVE_STUD {
+		stateCopy.Game = state.gameType
+		stateCopy.Community = cardsString(state.community)
+	}
+
+	// Pot and no limit tables say so, as their bets and raises carry an amount
+	if state.hasAmounts() {
+		stateCopy.Betting = state.stakes.Betting
+	}
+
+	// Tournaments show their registration, or the current level of the stakes
+	if state.isTournament() {
+		stateCopy.Tournament = state.tournamentStatus()
+	}
+
 	setActivePlayer := false
 
 	// Check if:
@@ -843,8 +1127,7 @@ func (state *GameState) createClientState() *GameState {
 	// This lets the client perform end of round/game tasks/animation
 	if state.gameOver ||
 		len(stateCopy.Players) < 2 ||
-		(stateCopy.ActivePlayer > -1 && ((state.currentBet > 0 && state.Players[state.ActivePlayer].Bet == state.currentBet) ||
-			(state.currentBet == 0 && state.Players[state.ActivePlayer].Move != ""))) {
+		(stateCopy.ActivePlayer > -1 && state.roundComplete()) {
 		stateCopy.ActivePlayer = -1
 		setActivePlayer = true
 	}
@@ -884,9 +1167,9 @@ func (state *GameState) createClientState() *GameState {
 		switch player.Status {
 		case STATUS_PLAYING:
 			// Loop through and build hand string, taking
-			// care to not disclose the first card of a hand to other players
+			// care to not disclose the down cards of a hand to other players
 			for cardIndex, card := range player.cards {
-				if cardIndex > 0 || playerIndex == state.clientPlayer || (state.Round == 5 && !state.wonByFolds) {
+				if state.isCardVisible(cardIndex) || playerIndex == state.clientPlayer || (state.Round > state.lastRound() && !state.wonByFolds) {
 					player.Hand += valueLookup[card.value] + suitLookup[card.suit]
 				} else {
 					player.Hand += "??"
@@ -927,19 +1210,24 @@ func (state *GameState) createClientState() *GameState {
 }
 
 func (state *GameState) updateLobby() {
-	if !state.registerLobby {
+	state.updateLobbyWithGameResult(nil)
+}
+
+func (state *GameState) updateLobbyWithGameResult(gameResult *GameResult) {
+	if !state.registerLobby && (gameResult == nil || !state.reportResults) {
 		return
 	}
 
 	humanPlayerSlots, humanPlayerCount := state.getHumanPlayerCountInfo()
 
-	// Send the total human slots / players to the Lobby
-	sendStateToLobby(humanPlayerSlots, humanPlayerCount, true, state.serverName, "?table="+state.table)
+	// Send the total human slots / players to the Lobby. The result of a table that isn't listed
+	// in the lobby is sent as offline, so it doesn't show up as a table to join.
+	sendStateToLobby(humanPlayerSlots, humanPlayerCount, state.registerLobby, state.serverName, "?table="+state.table, gameResult)
 }
 
 // Return number of active human players in the table, for the lobby
 func (state *GameState) getHumanPlayerCountInfo() (int, int) {
-	humanAvailSlots := 8
+	humanAvailSlots := state.seats()
 	humanPlayerCount := 0
 	cutoff := time.Now().Add(PLAYER_PING_TIMEOUT)
 
@@ -950,6 +1238,11 @@ func (state *GameState) getHumanPlayerCountInfo() (int, int) {
 			humanPlayerCount++
 		}
 	}
+
+	// A running tournament has no seats left
+	if state.tournament.started {
+		humanAvailSlots = humanPlayerCount
+	}
 	return humanAvailSlots, humanPlayerCount
 }
 
@@ -0,0 +1,287 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"golang.org/x/exp/slices"
+)
+
+// Parses cards written as in the hand history, e.g. "AS KD TC"
+func testCards(t *testing.T, cards string) []card {
+	result := []card{}
+	for _, c := range strings.Fields(cards) {
+		value := slices.Index(valueLookup, c[:1])
+		suit := slices.Index(suitLookup, c[1:])
+		if value < 2 || suit < 0 {
+			t.Fatalf("bad card %q", c)
+		}
+		result = append(result, card{value: value, suit: suit})
+	}
+	return result
+}
+
+func TestBuildPots(t *testing.T) {
+	tests := []struct {
+		name    string
+		players []Player
+		extra   int // Chips in the pot from players no longer at the table
+		want    []pot
+	}{
+		{
+			name: "everyone matched",
+			players: []Player{
+				{Status: STATUS_PLAYING, invested: 10},
+				{Status: STATUS_PLAYING, invested: 10},
+				{Status: STATUS_PLAYING, invested: 10},
+			},
+			want: []pot{{30, []int{0, 1, 2}}},
+		},
+		{
+			name: "multi-level side pots",
+			players: []Player{
+				{Status: STATUS_PLAYING, invested: 10, allIn: true},
+				{Status: STATUS_PLAYING, invested: 30, allIn: true},
+				{Status: STATUS_PLAYING, invested: 50},
+				{Status: STATUS_PLAYING, invested: 50},
+			},
+			want: []pot{
+				{40, []int{0, 1, 2, 3}},
+				{60, []int{1, 2, 3}},
+				{40, []int{2, 3}},
+			},
+		},
+		{
+			name: "folded player counts in every level they reached",
+			players: []Player{
+				{Status: STATUS_FOLDED, invested: 20},
+				{Status: STATUS_PLAYING, invested: 10, allIn: true},
+				{Status: STATUS_PLAYING, invested: 40},
+			},
+			want: []pot{
+				{30, []int{1, 2}},
+				{40, []int{2}},
+			},
+		},
+		{
+			name: "folded excess goes to the last pot",
+			players: []Player{
+				{Status: STATUS_FOLDED, invested: 50},
+				{Status: STATUS_PLAYING, invested: 20},
+				{Status: STATUS_PLAYING, invested: 20},
+			},
+			want: []pot{{90, []int{1, 2}}},
+		},
+		{
+			name: "uncalled excess goes back to the player",
+			players: []Player{
+				{Status: STATUS_PLAYING, invested: 50},
+				{Status: STATUS_PLAYING, invested: 20, allIn: true},
+			},
+			want: []pot{
+				{40, []int{0, 1}},
+				{30, []int{0}},
+			},
+		},
+		{
+			name: "chips of players that left go to the main pot",
+			players: []Player{
+				{Status: STATUS_PLAYING, invested: 10, allIn: true},
+				{Status: STATUS_PLAYING, invested: 20},
+			},
+			extra: 5,
+			want: []pot{
+				{25, []int{0, 1}},
+				{10, []int{1}},
+			},
+		},
+		{
+			name: "nobody left",
+			players: []Player{
+				{Status: STATUS_FOLDED, invested: 10},
+			},
+			want: []pot{},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			state := createGameState(GAME_FIVE_STUD, fixedLimitStakes, 0, false)
+			state.Players = test.players
+
+			remainingPlayers := []int{}
+			for index, player := range state.Players {
+				state.Pot += player.invested
+				if player.Status == STATUS_PLAYING {
+					remainingPlayers = append(remainingPlayers, index)
+				}
+			}
+			state.Pot += test.extra
+
+			got := state.buildPots(remainingPlayers)
+			if len(got) == 0 && len(test.want) == 0 {
+				return
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Fatalf("got pots %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestEndGamePots(t *testing.T) {
+	const straightA = "AS KD QH JC TS"
+	const straightB = "AH KC QD JS TD"
+	const highCard = "2C 4D 6H 8S 9C"
+
+	tests := []struct {
+		name  string
+		cards []string
+		bets  []int
+		allIn []bool
+		extra int
+		want  []int // Purse of each player after the hand
+	}{
+		{
+			name:  "split pot",
+			cards: []string{straightA, straightB, highCard},
+			bets:  []int{10, 10, 10},
+			allIn: []bool{false, false, false},
+			want:  []int{15, 15, 0},
+		},
+		{
+			name:  "odd chip of a split pot stays with the house",
+			cards: []string{straightA, straightB, highCard},
+			bets:  []int{10, 10, 10},
+			allIn: []bool{false, false, false},
+			extra: 1,
+			want:  []int{15, 15, 0},
+		},
+		{
+			name:  "all-in player wins the main pot, the side pot is split",
+			cards: []string{straightA, highCard, highCard},
+			bets:  []int{10, 30, 30},
+			allIn: []bool{true, false, false},
+			want:  []int{30, 20, 20},
+		},
+		{
+			name:  "all-in winner only wins what they matched",
+			cards: []string{straightA, highCard},
+			bets:  []int{20, 50},
+			allIn: []bool{true, false},
+			want:  []int{40, 30},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			state := createGameState(GAME_FIVE_STUD, fixedLimitStakes, 0, false)
+			state.Pot = test.extra
+			for i, cards := range test.cards {
+				state.Players = append(state.Players, Player{
+					Name:     string(rune('A' + i)),
+					Status:   STATUS_PLAYING,
+					isBot:    true,
+					cards:    testCards(t, cards),
+					allIn:    test.allIn[i],
+					invested: test.bets[i],
+				})
+				state.Pot += test.bets[i]
+			}
+
+			state.endGame(false)
+
+			for i, player := range state.Players {
+				if player.Purse != test.want[i] {
+					t.Errorf("player %s has %d chips, want %d (%s)", player.Name, player.Purse, test.want[i], state.LastResult)
+				}
+			}
+		})
+	}
+}
+
+func TestRoundComplete(t *testing.T) {
+	tests := []struct {
+		name       string
+		players    []Player
+		currentBet int
+		want       bool
+	}{
+		{
+			name: "everyone called",
+			players: []Player{
+				{Status: STATUS_PLAYING, Bet: 10, Move: "BET"},
+				{Status: STATUS_PLAYING, Bet: 10, Move: "CALL"},
+			},
+			currentBet: 10,
+			want:       true,
+		},
+		{
+			name: "a player has to call",
+			players: []Player{
+				{Status: STATUS_PLAYING, Bet: 20, Move: "RAISE"},
+				{Status: STATUS_PLAYING, Bet: 10, Move: "BET"},
+			},
+			currentBet: 20,
+			want:       false,
+		},
+		{
+			name: "a player has not moved",
+			players: []Player{
+				{Status: STATUS_PLAYING, Move: "CHECK"},
+				{Status: STATUS_PLAYING},
+			},
+			want: false,
+		},
+		{
+			name: "folded players are skipped",
+			players: []Player{
+				{Status: STATUS_FOLDED},
+				{Status: STATUS_PLAYING, Move: "CHECK"},
+				{Status: STATUS_PLAYING, Move: "CHECK"},
+			},
+			want: true,
+		},
+		{
+			name: "others all-in and the last player has matched",
+			players: []Player{
+				{Status: STATUS_PLAYING, Bet: 10, allIn: true},
+				{Status: STATUS_PLAYING, Bet: 5, allIn: true},
+				{Status: STATUS_PLAYING, Bet: 10},
+			},
+			currentBet: 10,
+			want:       true,
+		},
+		{
+			name: "others all-in and the last player has to call",
+			players: []Player{
+				{Status: STATUS_PLAYING, Bet: 30, Move: "RAISE", allIn: true},
+				{Status: STATUS_PLAYING, Bet: 10, Move: "BET"},
+			},
+			currentBet: 30,
+			want:       false,
+		},
+		{
+			name: "everyone all-in",
+			players: []Player{
+				{Status: STATUS_PLAYING, Bet: 10, allIn: true},
+				{Status: STATUS_PLAYING, Bet: 20, allIn: true},
+			},
+			currentBet: 20,
+			want:       true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			state := createGameState(GAME_FIVE_STUD, fixedLimitStakes, 0, false)
+			state.Players = test.players
+			state.currentBet = test.currentBet
+
+			if got := state.roundComplete(); got != test.want {
+				t.Fatalf("roundComplete() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
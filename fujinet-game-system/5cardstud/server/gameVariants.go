@@ -0,0 +1,243 @@
+package main
+
+import (
+	"github.com/ericcarrgh/cardrank"
+)
+
+/*
+Game variants - every table plays one of them, chosen when the table is created.
+
+5 Card Stud (default) - 1 down and 1 up card, then 3 more up cards. 4 betting rounds.
+  Lowest up card posts the bring-in, then the highest visible hand acts first.
+
+Seven Card Stud - 2 down and 1 up card (3rd street), 3 more up cards, then a last down card (7th street).
+  5 betting rounds. Bring-in as 5 Card Stud. Up to 7 players, so the deck never runs out.
+
+Texas Hold'em - 2 down cards, then the community cards: flop (3), turn (1) and river (1). 4 betting rounds.
+  No ante - the two players after the dealer post the small and big blinds, and the dealer moves every game.
+  The player after the big blind acts first, then the first player after the dealer on later rounds.
+
+All of them use the betting structure of the table (see stakes.go). The Hold'em blinds are
+the bring-in (small blind) and Low (big blind) of the stakes.
+*/
+
+const (
+	GAME_FIVE_STUD  = "stud5"
+	GAME_SEVEN_STUD = "stud7"
+	GAME_HOLDEM     = "holdem"
+)
+
+// Friendly names, also used to validate the game type of a table
+var gameNames = map[string]string{
+	GAME_FIVE_STUD:  "5 Card Stud",
+	GAME_SEVEN_STUD: "Seven Card Stud",
+	GAME_HOLDEM:     "Texas Hold'em",
+}
+
+// The last betting round. The round after it means the game is over.
+func (state *GameState) lastRound() int {
+	if state.gameType == GAME_SEVEN_STUD {
+		return 5
+	}
+	return 4
+}
+
+// Seats at the table
+func (state *GameState) maxPlayers() int {
+	if state.gameType == GAME_SEVEN_STUD {
+		return 7
+	}
+	return 8
+}
+
+// Deals the cards for the current round
+func (state *GameState) dealRound() {
+	switch state.gameType {
+	case GAME_HOLDEM:
+		switch state.Round {
+		case 1:
+			state.dealCards()
+			state.dealCards()
+		case 2:
+			state.dealCommunity(3)
+		default:
+			state.dealCommunity(1)
+		}
+	case GAME_SEVEN_STUD:
+		if state.Round == 1 {
+			state.dealCards()
+			state.dealCards()
+		}
+		state.dealCards()
+	default:
+		if state.Round == 1 {
+			state.dealCards()
+		}
+		state.dealCards()
+	}
+}
+
+func (state *GameState) dealCommunity(count int) {
+	for i := 0; i < count; i++ {
+		state.community = append(state.community, state.deck[state.deckIndex])
+		state.deckIndex++
+	}
+	state.recordAction(HistoryAction{Action: ACTION_BOARD, Up: cardsString(state.community[len(state.community)-count:])})
+}
+
+// Returns true if the card at this position of a hand is dealt face up
+func (state *GameState) isCardVisible(index int) bool {
+	switch state.gameType {
+	case GAME_HOLDEM:
+		return false
+	case GAME_SEVEN_STUD:
+		return index > 1 && index < 6
+	default:
+		return index > 0
+	}
+}
+
+// The cards of a player that everybody can see
+func (state *GameState) visibleCards(player *Player) []card {
+	cards := []card{}
+	for i, card := range player.cards {
+		if state.isCardVisible(i) {
+			cards = append(cards, card)
+		}
+	}
+	return cards
+}
+
+// The number of cards in a player's hand once all are dealt
+func (state *GameState) handSize() int {
+	switch state.gameType {
+	case GAME_HOLDEM:
+		return 2
+	case GAME_SEVEN_STUD:
+		return 7
+	default:
+		return 5
+	}
+}
+
+// True if an open pair is showing on the second betting round, which allows a HIGH bet (stud only)
+func (state *GameState) openPairShowing() bool {
+	if state.gameType == GAME_HOLDEM {
+		return false
+	}
+
+	for i := range state.Players {
+		player := &state.Players[i]
+		if player.Status == STATUS_PLAYING {
+			visible := state.visibleCards(player)
+			if len(visible) > 1 && visible[0].value == visible[1].value {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Sets the player that acts first this round
+func (state *GameState) setFirstToAct() {
+	if state.gameType == GAME_HOLDEM {
+		seat := state.dealer
+		if state.Round == 1 {
+			seat = state.postBlinds()
+		}
+		state.ActivePlayer = seat
+		state.nextValidPlayer()
+		return
+	}
+
+	state.ActivePlayer = state.getPlayerWithBestVisibleHand(state.Round > 1)
+
+	// All-in players do not act, so start with the next player that can
+	if !state.Players[state.ActivePlayer].canAct() {
+		state.nextValidPlayer()
+	}
+}
+
+// Moves the dealer and posts the blinds, returning the seat of the big blind
+func (state *GameState) postBlinds() int {
+	state.dealer = state.nextPlayingSeat(state.dealer)
+	state.hand.Button = state.dealer + 1
+
+	playing := 0
+	for _, player := range state.Players {
+		if player.Status == STATUS_PLAYING {
+			playing++
+		}
+	}
+
+	// Heads up, the dealer posts the small blind
+	smallBlind := state.dealer
+	if playing > 2 {
+		smallBlind = state.nextPlayingSeat(state.dealer)
+	}
+	bigBlind := state.nextPlayingSeat(smallBlind)
+
+	state.postBlind(smallBlind, state.stakes.BringIn)
+	state.postBlind(bigBlind, state.stakes.Low)
+	state.raiseAmount = state.stakes.Low
+
+	return bigBlind
+}
+
+// Blinds are posted without counting as a move, so the big blind still has an option to raise
+func (state *GameState) postBlind(seat int, amount int) {
+	player := &state.Players[seat]
+
+	if amount >= player.Purse {
+		amount = player.Purse
+		player.allIn = true
+		player.Move = MOVE_ALL_IN
+	}
+
+	player.Bet += amount
+	player.Purse -= amount
+	player.invested += amount
+	state.currentBet = maxInt(state.currentBet, player.Bet)
+
+	state.recordAction(HistoryAction{Player: player.Name, Action: ACTION_BLIND, Amount: amount, To: player.Bet, AllIn: player.allIn})
+}
+
+// The next seat after this one with a player in the game
+func (state *GameState) nextPlayingSeat(seat int) int {
+	for i := 1; i <= len(state.Players); i++ {
+		next := (seat + i) % len(state.Players)
+		if state.Players[next].Status == STATUS_PLAYING {
+			return next
+		}
+	}
+	return 0
+}
+
+// The cardrank type that ranks the hands of this game
+func (state *GameState) rankType() cardrank.Type {
+	switch state.gameType {
+	case GAME_HOLDEM:
+		return cardrank.Holdem
+	case GAME_SEVEN_STUD:
+		return cardrank.Stud
+	default:
+		return cardrank.StudFive
+	}
+}
+
+// Evaluates the hands of the remaining players
+func (state *GameState) evalPockets(pockets [][]cardrank.Card) []*cardrank.Eval {
+	if state.gameType == GAME_HOLDEM {
+		return state.rankType().EvalPockets(pockets, cardrank.Must(cardsString(state.community)))
+	}
+	return state.rankType().EvalPockets(pockets, nil)
+}
+
+// Returns the 2 character representation of each card, e.g. "KSTH"
+func cardsString(cards []card) string {
+	result := ""
+	for _, card := range cards {
+		result += valueLookup[card.value] + suitLookup[card.suit]
+	}
+	return result
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/goccy/go-json"
+)
+
+// Plays every round of each game without betting, checking the cards dealt
+func TestDealRounds(t *testing.T) {
+	tests := []struct {
+		game      string
+		cards     []int // Cards of each player, by round
+		up        []int // Of which face up
+		community []int
+	}{
+		{GAME_FIVE_STUD, []int{2, 3, 4, 5}, []int{1, 2, 3, 4}, []int{0, 0, 0, 0}},
+		{GAME_SEVEN_STUD, []int{3, 4, 5, 6, 7}, []int{1, 2, 3, 4, 4}, []int{0, 0, 0, 0, 0}},
+		{GAME_HOLDEM, []int{2, 2, 2, 2}, []int{0, 0, 0, 0}, []int{0, 3, 4, 5}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.game, func(t *testing.T) {
+			state := createGameState(test.game, fixedLimitStakes, 3, false)
+
+			for round := 1; round <= state.lastRound(); round++ {
+				state.newRound()
+
+				if state.Round != round {
+					t.Fatalf("round %d started round %d", round, state.Round)
+				}
+				for i := range state.Players {
+					player := &state.Players[i]
+					if len(player.cards) != test.cards[round-1] || len(state.visibleCards(player)) != test.up[round-1] {
+						t.Fatalf("round %d dealt %s %d cards, %d up, want %d, %d up", round, player.Name,
+							len(player.cards), len(state.visibleCards(player)), test.cards[round-1], test.up[round-1])
+					}
+				}
+				if len(state.community) != test.community[round-1] {
+					t.Fatalf("round %d has %d community cards, want %d", round, len(state.community), test.community[round-1])
+				}
+			}
+
+			// 52 cards are enough for a full table
+			if state.handSize()*state.maxPlayers()+len(state.community) > len(state.deck) {
+				t.Fatalf("%d players need more than one deck", state.maxPlayers())
+			}
+		})
+	}
+}
+
+// Stud players pay the ante, Hold'em players post the blinds instead
+func TestAntesAndBlinds(t *testing.T) {
+	state := createGameState(GAME_FIVE_STUD, fixedLimitStakes, 3, false)
+	state.newRound()
+	if state.Pot != 3*ANTE {
+		t.Errorf("stud pot is %d after the antes, want %d", state.Pot, 3*ANTE)
+	}
+
+	state = createGameState(GAME_HOLDEM, fixedLimitStakes, 3, false)
+	state.newRound()
+
+	bets := []int{}
+	for _, player := range state.Players {
+		bets = append(bets, player.Bet)
+	}
+
+	// The dealer button moves to the second seat, the next two seats post the blinds, and the dealer acts first
+	if state.Pot != 0 || bets[2] != BRINGIN || bets[0] != LOW || state.ActivePlayer != 1 || state.currentBet != LOW {
+		t.Errorf("hold'em has pot %d, bets %v and player %d to act, want pot 0, bets [%d 0 %d] and player 1", state.Pot, bets, state.ActivePlayer, LOW, BRINGIN)
+	}
+}
+
+func TestShowdown(t *testing.T) {
+	tests := []struct {
+		name      string
+		game      string
+		community string
+		cards     []string
+		want      []int // Purse of each player after the hand
+	}{
+		{
+			name:  "seven card stud, best five of seven",
+			game:  GAME_SEVEN_STUD,
+			cards: []string{"AS AD 2C 3D 4H 9S 8C", "KS KD KH 2D 5H 7S 9D"},
+			want:  []int{0, 20},
+		},
+		{
+			name:  "seven card stud, hidden flush",
+			game:  GAME_SEVEN_STUD,
+			cards: []string{"2H 9H AS AD AC 5H JH", "KS KD KH 2D 5S 7S 9D"},
+			want:  []int{20, 0},
+		},
+		{
+			name:      "hold'em, pocket cards make the hand",
+			game:      GAME_HOLDEM,
+			community: "AS KS QS 2D 3C",
+			cards:     []string{"JS TS", "AH AD"},
+			want:      []int{20, 0},
+		},
+		{
+			name:      "hold'em, the board plays",
+			game:      GAME_HOLDEM,
+			community: "AS KS QS JS TS",
+			cards:     []string{"2C 3D", "4C 5D"},
+			want:      []int{10, 10},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			state := createGameState(test.game, fixedLimitStakes, 0, false)
+			state.community = testCards(t, test.community)
+			for i, cards := range test.cards {
+				state.Players = append(state.Players, Player{Name: string(rune('A' + i)), Status: STATUS_PLAYING, isBot: true, cards: testCards(t, cards), invested: 10})
+				state.Pot += 10
+			}
+
+			state.endGame(false)
+
+			for i, player := range state.Players {
+				if player.Purse != test.want[i] {
+					t.Errorf("player %s has %d chips, want %d (%s)", player.Name, player.Purse, test.want[i], state.LastResult)
+				}
+			}
+		})
+	}
+}
+
+// Clients only see the down cards of their own hand, and 5 Card Stud tables look as they always did
+func TestClientState(t *testing.T) {
+	state := createGameState(GAME_SEVEN_STUD, fixedLimitStakes, 2, false)
+	state.newRound()
+	state.clientPlayer = 0
+
+	clientState := state.createClientState()
+	own, other := clientState.Players[0].Hand, clientState.Players[1].Hand
+
+	if strings.Contains(own, "??") || !strings.HasPrefix(other, "????") || strings.Contains(other[4:], "??") || len(other) != 6 {
+		t.Errorf("seven card stud client sees its hand as %s and the other as %s", own, other)
+	}
+	if clientState.Game != GAME_SEVEN_STUD {
+		t.Errorf("seven card stud state has game %q", clientState.Game)
+	}
+
+	state = createGameState(GAME_FIVE_STUD, fixedLimitStakes, 2, false)
+	state.newRound()
+
+	data, _ := json.Marshal(state.createClientState())
+	fields := map[string]any{}
+	json.Unmarshal(data, &fields)
+	for _, field := range []string{"g", "c", "b", "t"} {
+		if _, ok := fields[field]; ok {
+			t.Errorf("5 card stud state has the new field %q", field)
+		}
+	}
+}
+
+// Clients that only play 5 Card Stud are only sent the tables of other games if they ask for them
+func TestTablesByGame(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	for _, config := range []TableConfig{
+		{Table: "v5", Name: "Stud", Lobby: true},
+		{Table: "v7", Name: "Seven", Game: GAME_SEVEN_STUD, Lobby: true},
+		{Table: "vh", Name: "Holdem", Game: GAME_HOLDEM, Stakes: Stakes{Betting: BETTING_NO_LIMIT}, Lobby: true},
+	} {
+		if _, err := createTable(config); err != nil {
+			t.Fatalf("createTable(%s) failed with %s", config.Table, err)
+		}
+		defer removeTable(config.Table)
+	}
+
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{"", "v5"},
+		{"?games=all", "vh:holdem:nolimit v7:stud7: v5::"},
+	}
+	for _, test := range tests {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest("GET", "/tables"+test.query, nil)
+
+		apiTables(c)
+
+		listed := []GameTable{}
+		json.Unmarshal(w.Body.Bytes(), &listed)
+
+		got := []string{}
+		for _, table := range listed {
+			if test.query == "" {
+				got = append(got, table.Table)
+			} else {
+				got = append(got, table.Table+":"+table.Game+":"+table.Betting)
+			}
+		}
+		if strings.Join(got, " ") != test.want {
+			t.Errorf("/tables%s listed %v, want %s", test.query, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,604 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/goccy/go-json"
+)
+
+/*
+Hand history - every hand played is recorded: the players seated and their stacks, the antes and
+blinds, the cards dealt, every move (including the auto moves of players that ran out of time),
+the showdown and how the pots were split.
+
+Hands are saved as json, one per line, to history/<table>.jsonl in DATA_DIR. Each table keeps
+its last HISTORY_MAX_HANDS hands, and none older than HISTORY_MAX_AGE.
+
+/history returns the most recent hands of a table, as json or as PokerStars style text that
+poker tools can import. Down cards are only shown for the hands shown down at the end, as
+anyone can ask for the history of a table.
+*/
+
+const HISTORY_MAX_HANDS = 1000
+const HISTORY_MAX_AGE = time.Hour * time.Duration(24*7)
+const HISTORY_DEFAULT_RESULTS = 10
+const HISTORY_MAX_RESULTS = 50
+
+// Actions of a hand
+const (
+	ACTION_ANTE     = "ante"
+	ACTION_BLIND    = "blind"
+	ACTION_DEAL     = "deal"
+	ACTION_BOARD    = "board"
+	ACTION_BRING_IN = "bringin"
+	ACTION_FOLD     = "fold"
+	ACTION_CHECK    = "check"
+	ACTION_BET      = "bet"
+	ACTION_COMPLETE = "complete"
+	ACTION_CALL     = "call"
+	ACTION_RAISE    = "raise"
+	ACTION_LEAVE    = "leave"
+)
+
+type HandHistory struct {
+	ID       int64             `json:"id"`
+	Table    string            `json:"table"`
+	Name     string            `json:"name"`
+	Game     string            `json:"game"`
+	Stakes   Stakes            `json:"stakes"`
+	Started  time.Time         `json:"started"`
+	Button   int               `json:"button,omitempty"` // Seat of the Hold'em dealer
+	Seats    []HistorySeat     `json:"seats"`
+	Actions  []HistoryAction   `json:"actions"`
+	Board    string            `json:"board,omitempty"`
+	Showdown []HistoryShowdown `json:"showdown,omitempty"`
+	Pots     []HistoryPot      `json:"pots"`
+	Result   string            `json:"result"`
+}
+
+type HistorySeat struct {
+	Seat  int    `json:"seat"`
+	Name  string `json:"name"`
+	Stack int    `json:"stack"` // Chips at the start of the hand
+	Won   int    `json:"won"`
+	Bot   bool   `json:"bot,omitempty"`
+}
+
+type HistoryAction struct {
+	Round  int    `json:"round"`
+	Player string `json:"player,omitempty"`
+	Action string `json:"action"`
+	Amount int    `json:"amount,omitempty"` // Chips put in the pot
+	To     int    `json:"to,omitempty"`     // Total bet of the player this round
+	Down   string `json:"down,omitempty"`   // Cards dealt face down
+	Up     string `json:"up,omitempty"`     // Cards dealt face up, or to the board
+	AllIn  bool   `json:"allIn,omitempty"`
+	Auto   bool   `json:"auto,omitempty"` // Made for a player that ran out of time
+}
+
+type HistoryShowdown struct {
+	Player string `json:"player"`
+	Cards  string `json:"cards"`
+	Hand   string `json:"hand"`
+}
+
+type HistoryPot struct {
+	Amount  int      `json:"amount"`
+	Winners []string `json:"winners"`
+	Share   int      `json:"share"` // Won by each winner
+}
+
+type HistoryStore struct {
+	mutex  sync.Mutex
+	dir    string
+	lastID int64
+	hands  map[string][]HandHistory // Loaded hands by table, oldest first
+	lines  map[string]int           // Lines in the file of each table, to know when to trim it
+}
+
+var histories = HistoryStore{hands: map[string][]HandHistory{}, lines: map[string]int{}}
+
+func initializeHistory() {
+	histories.mutex.Lock()
+	defer histories.mutex.Unlock()
+
+	histories.dir = filepath.Join(dataDir(), "history")
+}
+
+// Starts recording a new hand, once the antes are in. Expects the players of the hand to be PLAYING.
+func (state *GameState) startHand() {
+	state.hand = HandHistory{
+		ID:      histories.nextID(),
+		Table:   state.table,
+		Name:    state.serverName,
+		Game:    state.gameType,
+		Stakes:  state.stakes,
+		Started: time.Now().UTC(),
+		Seats:   []HistorySeat{},
+		Actions: []HistoryAction{},
+		Pots:    []HistoryPot{},
+	}
+
+	for i, player := range state.Players {
+		if player.Status == STATUS_PLAYING {
+			state.hand.Seats = append(state.hand.Seats, HistorySeat{Seat: i + 1, Name: player.Name, Stack: player.Purse + player.invested, Bot: player.isBot})
+		}
+	}
+
+	for _, player := range state.Players {
+		if player.Status == STATUS_PLAYING && player.invested > 0 {
+			state.recordAction(HistoryAction{Player: player.Name, Action: ACTION_ANTE, Amount: player.invested, AllIn: player.allIn})
+		}
+	}
+}
+
+func (state *GameState) recordAction(action HistoryAction) {
+	if state.hand.ID == 0 {
+		return
+	}
+	action.Round = state.Round
+	state.hand.Actions = append(state.hand.Actions, action)
+}
+
+// Records a card dealt to a player, adding it to the cards they were dealt this round
+func (state *GameState) recordCard(player *Player, card card, visible bool) {
+	if state.hand.ID == 0 {
+		return
+	}
+
+	dealt := valueLookup[card.value] + suitLookup[card.suit]
+
+	for i := len(state.hand.Actions) - 1; i >= 0 && state.hand.Actions[i].Round == state.Round; i-- {
+		action := &state.hand.Actions[i]
+		if action.Action == ACTION_DEAL && action.Player == player.Name {
+			if visible {
+				action.Up += dealt
+			} else {
+				action.Down += dealt
+			}
+			return
+		}
+	}
+
+	action := HistoryAction{Player: player.Name, Action: ACTION_DEAL}
+	if visible {
+		action.Up = dealt
+	} else {
+		action.Down = dealt
+	}
+	state.recordAction(action)
+}
+
+// Records a move made by the active player. The bet is the current bet before the move.
+func (state *GameState) recordMove(player *Player, move string, bet int, amount int, internalCall bool) {
+	action := HistoryAction{Player: player.Name, Amount: amount, To: player.Bet, AllIn: player.allIn, Auto: internalCall && !player.isBot}
+
+	switch move {
+	case "FO":
+		action.Action = ACTION_FOLD
+	case "CH":
+		action.Action = ACTION_CHECK
+	case "BB":
+		action.Action = ACTION_BRING_IN
+	case "CA":
+		action.Action = ACTION_CALL
+	case "RA":
+		action.Action = ACTION_RAISE
+	default:
+		// A bet (or all-in) over a bring-in completes it. Over a bet or a blind, it is a raise.
+		if player.Bet <= bet {
+			action.Action = ACTION_CALL
+		} else if bet == 0 {
+			action.Action = ACTION_BET
+		} else if bet < state.stakes.Low && state.gameType != GAME_HOLDEM {
+			action.Action = ACTION_COMPLETE
+		} else {
+			action.Action = ACTION_RAISE
+		}
+	}
+
+	if action.Action == ACTION_FOLD || action.Action == ACTION_CHECK {
+		action.To = 0
+	}
+
+	state.recordAction(action)
+}
+
+// Completes the record of the hand with the showdown and winnings, and saves it
+func (state *GameState) finishHand(result string) {
+	if state.hand.ID == 0 {
+		return
+	}
+
+	state.hand.Board = cardsString(state.community)
+	state.hand.Result = result
+	histories.record(state.hand)
+	state.hand = HandHistory{}
+}
+
+// Returns a unique, increasing id for a hand, based on the time it started
+func (store *HistoryStore) nextID() int64 {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	store.lastID = maxInt64(store.lastID+1, time.Now().UnixMilli())
+	return store.lastID
+}
+
+// Adds a hand to the history of its table, trimming the saved file once it has too many hands
+func (store *HistoryStore) record(hand HandHistory) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	store.load(hand.Table)
+	store.hands[hand.Table] = trimHands(append(store.hands[hand.Table], hand))
+
+	if store.dir == "" {
+		return
+	}
+
+	if store.lines[hand.Table] >= 2*HISTORY_MAX_HANDS {
+		store.rewrite(hand.Table)
+		return
+	}
+
+	data, err := json.Marshal(hand)
+	if err == nil {
+		err = os.MkdirAll(store.dir, 0755)
+	}
+
+	var file *os.File
+	if err == nil {
+		file, err = os.OpenFile(store.path(hand.Table), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	}
+	if err == nil {
+		_, err = file.Write(append(data, '\n'))
+		file.Close()
+	}
+
+	if err != nil {
+		log.Printf("Unable to save hand history: %s", err)
+		return
+	}
+	store.lines[hand.Table]++
+}
+
+// Returns the most recent hands of a table, newest first
+func (store *HistoryStore) recent(table string, count int) []HandHistory {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	store.load(table)
+	store.hands[table] = trimHands(store.hands[table])
+	hands := store.hands[table]
+
+	recent := []HandHistory{}
+	for i := len(hands) - 1; i >= 0 && len(recent) < count; i-- {
+		recent = append(recent, hands[i])
+	}
+	return recent
+}
+
+func (store *HistoryStore) path(table string) string {
+	return filepath.Join(store.dir, table+".jsonl")
+}
+
+// Loads the saved hands of a table the first time they are needed. Expects the mutex to be held.
+func (store *HistoryStore) load(table string) {
+	if _, ok := store.hands[table]; ok {
+		return
+	}
+	store.hands[table] = []HandHistory{}
+
+	if store.dir == "" {
+		return
+	}
+
+	file, err := os.Open(store.path(table))
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Printf("Unable to read hand history: %s", err)
+		}
+		return
+	}
+	defer file.Close()
+
+	hands := []HandHistory{}
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		hand := HandHistory{}
+		if err := json.Unmarshal(scanner.Bytes(), &hand); err == nil {
+			hands = append(hands, hand)
+			store.lastID = maxInt64(store.lastID, hand.ID)
+		}
+	}
+
+	store.hands[table] = trimHands(hands)
+	store.lines[table] = len(hands)
+}
+
+// Saves only the hands that are kept, replacing the file of the table. Expects the mutex to be held.
+func (store *HistoryStore) rewrite(table string) {
+	var builder strings.Builder
+	for _, hand := range store.hands[table] {
+		data, err := json.Marshal(hand)
+		if err == nil {
+			builder.Write(data)
+			builder.WriteByte('\n')
+		}
+	}
+
+	err := os.MkdirAll(store.dir, 0755)
+
+	// Write to a temp file first, so a crash never leaves a partial file
+	path := store.path(table)
+	if err == nil {
+		err = os.WriteFile(path+".tmp", []byte(builder.String()), 0644)
+	}
+	if err == nil {
+		err = os.Rename(path+".tmp", path)
+	}
+
+	if err != nil {
+		log.Printf("Unable to save hand history: %s", err)
+		return
+	}
+	store.lines[table] = len(store.hands[table])
+}
+
+// Drops hands that are too old, and the oldest hands over the limit
+func trimHands(hands []HandHistory) []HandHistory {
+	cutoff := time.Now().Add(-HISTORY_MAX_AGE)
+	start := maxInt(0, len(hands)-HISTORY_MAX_HANDS)
+	for start < len(hands) && hands[start].Started.Before(cutoff) {
+		start++
+	}
+	return hands[start:]
+}
+
+// Returns a copy of the hand as anyone may see it: the down cards of players are hidden,
+// unless they were shown down
+func (hand HandHistory) public() HandHistory {
+	shown := map[string]bool{}
+	for _, showdown := range hand.Showdown {
+		shown[strings.ToLower(showdown.Player)] = true
+	}
+
+	actions := []HistoryAction{}
+	for _, action := range hand.Actions {
+		if action.Down != "" && !shown[strings.ToLower(action.Player)] {
+			action.Down = ""
+		}
+		actions = append(actions, action)
+	}
+	hand.Actions = actions
+
+	return hand
+}
+
+// Streets of each game, by round
+var streetNames = map[string][]string{
+	GAME_FIVE_STUD:  {"", "2nd STREET", "3rd STREET", "4th STREET", "5th STREET"},
+	GAME_SEVEN_STUD: {"", "3rd STREET", "4th STREET", "5th STREET", "6th STREET", "RIVER"},
+	GAME_HOLDEM:     {"", "HOLE CARDS", "FLOP", "TURN", "RIVER"},
+}
+
+var bettingNames = map[string]string{
+	BETTING_LIMIT:     "Limit",
+	BETTING_POT_LIMIT: "Pot Limit",
+	BETTING_NO_LIMIT:  "No Limit",
+}
+
+// Writes the hand in the PokerStars hand history format
+func (hand HandHistory) text() string {
+	var b strings.Builder
+
+	game := "5 Card Stud"
+	stakes := fmt.Sprintf("%d/%d", hand.Stakes.Low, hand.Stakes.High)
+	switch hand.Game {
+	case GAME_SEVEN_STUD:
+		game = "7 Card Stud"
+	case GAME_HOLDEM:
+		game = "Hold'em"
+		stakes = fmt.Sprintf("%d/%d", hand.Stakes.BringIn, hand.Stakes.Low)
+	}
+
+	fmt.Fprintf(&b, "PokerStars Hand #%d: %s %s (%s) - %s UTC\n", hand.ID, game, bettingNames[hand.Stakes.Betting], stakes, hand.Started.Format("2006/01/02 15:04:05"))
+
+	seats := 8
+	if hand.Game == GAME_SEVEN_STUD {
+		seats = 7
+	}
+	fmt.Fprintf(&b, "Table '%s' %d-max", hand.Name, seats)
+	if hand.Game == GAME_HOLDEM {
+		fmt.Fprintf(&b, " Seat #%d is the button", hand.Button)
+	}
+	b.WriteString("\n")
+
+	for _, seat := range hand.Seats {
+		fmt.Fprintf(&b, "Seat %d: %s (%d in chips)\n", seat.Seat, seat.Name, seat.Stack)
+	}
+
+	// The antes and blinds come before the cards of the first round. The first blind is the small blind.
+	blinds := 0
+	for _, action := range hand.Actions {
+		allIn := ""
+		if action.AllIn {
+			allIn = " and is all-in"
+		}
+
+		switch action.Action {
+		case ACTION_ANTE:
+			fmt.Fprintf(&b, "%s: posts the ante %d%s\n", action.Player, action.Amount, allIn)
+		case ACTION_BLIND:
+			blind := "small"
+			if blinds > 0 {
+				blind = "big"
+			}
+			blinds++
+			fmt.Fprintf(&b, "%s: posts %s blind %d%s\n", action.Player, blind, action.Amount, allIn)
+		}
+	}
+
+	// The cards dealt to each player, and to the board, so far
+	dealt := map[string]string{}
+	board := ""
+	folded := map[string]bool{}
+
+	round := 0
+	for index, action := range hand.Actions {
+		if action.Action == ACTION_ANTE || action.Action == ACTION_BLIND {
+			continue
+		}
+
+		if action.Round != round {
+			round = action.Round
+			street := streetNames[hand.Game]
+			if round < len(street) {
+				fmt.Fprintf(&b, "*** %s ***", street[round])
+			}
+
+			// Hold'em shows the board with the new cards apart
+			if hand.Game == GAME_HOLDEM && round > 1 {
+				newCards := ""
+				for _, boardAction := range hand.Actions {
+					if boardAction.Round == round && boardAction.Action == ACTION_BOARD {
+						newCards += boardAction.Up
+					}
+				}
+				if board != "" {
+					fmt.Fprintf(&b, " %s", historyCards(board))
+				}
+				fmt.Fprintf(&b, " %s", historyCards(newCards))
+				board += newCards
+			}
+			b.WriteString("\n")
+		}
+
+		name := action.Player
+		allIn := ""
+		if action.AllIn {
+			allIn = " and is all-in"
+		}
+		if action.Auto {
+			fmt.Fprintf(&b, "%s has timed out\n", name)
+		}
+
+		switch action.Action {
+		case ACTION_DEAL:
+			// Down cards that are hidden are left out
+			cards := action.Down + action.Up
+			if cards == "" {
+				continue
+			}
+			fmt.Fprintf(&b, "Dealt to %s", name)
+			if dealt[name] != "" {
+				fmt.Fprintf(&b, " %s", historyCards(dealt[name]))
+			}
+			fmt.Fprintf(&b, " %s\n", historyCards(cards))
+			dealt[name] += cards
+		case ACTION_BRING_IN:
+			fmt.Fprintf(&b, "%s: brings in for %d%s\n", name, action.Amount, allIn)
+		case ACTION_FOLD:
+			fmt.Fprintf(&b, "%s: folds\n", name)
+			folded[name] = true
+		case ACTION_LEAVE:
+			fmt.Fprintf(&b, "%s leaves the table\n", name)
+			folded[name] = true
+		case ACTION_CHECK:
+			fmt.Fprintf(&b, "%s: checks\n", name)
+		case ACTION_BET:
+			fmt.Fprintf(&b, "%s: bets %d%s\n", name, action.Amount, allIn)
+		case ACTION_COMPLETE:
+			fmt.Fprintf(&b, "%s: completes it to %d%s\n", name, action.To, allIn)
+		case ACTION_CALL:
+			fmt.Fprintf(&b, "%s: calls %d%s\n", name, action.Amount, allIn)
+		case ACTION_RAISE:
+			fmt.Fprintf(&b, "%s: raises %d to %d%s\n", name, action.To-hand.betBefore(index), action.To, allIn)
+		}
+	}
+
+	if len(hand.Showdown) > 0 {
+		b.WriteString("*** SHOW DOWN ***\n")
+		for _, showdown := range hand.Showdown {
+			fmt.Fprintf(&b, "%s: shows %s (%s)\n", showdown.Player, historyCards(showdown.Cards), showdown.Hand)
+		}
+	}
+
+	total := 0
+	for i, pot := range hand.Pots {
+		potName := "pot"
+		if len(hand.Pots) > 1 {
+			potName = "main pot"
+			if i > 0 {
+				potName = fmt.Sprintf("side pot-%d", i)
+			}
+		}
+		for _, winner := range pot.Winners {
+			fmt.Fprintf(&b, "%s collected %d from %s\n", winner, pot.Share, potName)
+		}
+		total += pot.Amount
+	}
+
+	b.WriteString("*** SUMMARY ***\n")
+	fmt.Fprintf(&b, "Total pot %d | Rake 0\n", total)
+	if hand.Board != "" {
+		fmt.Fprintf(&b, "Board %s\n", historyCards(hand.Board))
+	}
+
+	for _, seat := range hand.Seats {
+		fmt.Fprintf(&b, "Seat %d: %s", seat.Seat, seat.Name)
+
+		shown := false
+		for _, showdown := range hand.Showdown {
+			if showdown.Player == seat.Name {
+				shown = true
+				fmt.Fprintf(&b, " showed %s and ", historyCards(showdown.Cards))
+				if seat.Won > 0 {
+					fmt.Fprintf(&b, "won (%d) with %s", seat.Won, showdown.Hand)
+				} else {
+					fmt.Fprintf(&b, "lost with %s", showdown.Hand)
+				}
+			}
+		}
+
+		if !shown {
+			if folded[seat.Name] {
+				b.WriteString(" folded")
+			} else if seat.Won > 0 {
+				fmt.Fprintf(&b, " collected (%d)", seat.Won)
+			}
+		}
+		b.WriteString("\n")
+	}
+
+	return b.String()
+}
+
+// The bet the action at this index was made over: the highest total bet of the round before it
+func (hand HandHistory) betBefore(index int) int {
+	bet := 0
+	for _, action := range hand.Actions[:index] {
+		if action.Round == hand.Actions[index].Round {
+			bet = maxInt(bet, action.To)
+		}
+	}
+	return bet
+}
+
+// Converts cards to the history format, e.g. "KSTH" to "[Ks Th]"
+func historyCards(cards string) string {
+	list := []string{}
+	for i := 0; i+1 < len(cards); i += 2 {
+		list = append(list, cards[i:i+1]+strings.ToLower(cards[i+1:i+2]))
+	}
+	return "[" + strings.Join(list, " ") + "]"
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"bufio"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func createHistoryStore(dir string) *HistoryStore {
+	return &HistoryStore{dir: dir, hands: map[string][]HandHistory{}, lines: map[string]int{}}
+}
+
+func createHands(count int, started time.Time) []HandHistory {
+	hands := []HandHistory{}
+	for i := 1; i <= count; i++ {
+		hands = append(hands, HandHistory{ID: int64(i), Table: "test", Started: started})
+	}
+	return hands
+}
+
+// Counts the hands saved in the file of a table
+func countSavedHands(t *testing.T, store *HistoryStore, table string) int {
+	file, err := os.Open(store.path(table))
+	if err != nil {
+		t.Fatalf("unable to open the history: %s", err)
+	}
+	defer file.Close()
+
+	count := 0
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		count++
+	}
+	return count
+}
+
+func TestTrimHands(t *testing.T) {
+	now := time.Now()
+
+	hands := trimHands(createHands(HISTORY_MAX_HANDS+5, now))
+	if len(hands) != HISTORY_MAX_HANDS || hands[0].ID != 6 {
+		t.Errorf("kept %d hands from hand %d, want %d from hand 6", len(hands), hands[0].ID, HISTORY_MAX_HANDS)
+	}
+
+	hands = createHands(4, now.Add(-HISTORY_MAX_AGE-time.Minute))
+	hands = append(hands, HandHistory{ID: 5, Started: now})
+	hands = trimHands(hands)
+	if len(hands) != 1 || hands[0].ID != 5 {
+		t.Errorf("kept %v, want only hand 5", hands)
+	}
+
+	if hands := trimHands(createHands(3, now)); len(hands) != 3 {
+		t.Errorf("kept %d of 3 recent hands", len(hands))
+	}
+}
+
+func TestHistoryStorage(t *testing.T) {
+	dir := t.TempDir()
+	store := createHistoryStore(dir)
+	for _, hand := range createHands(3, time.Now()) {
+		store.record(hand)
+	}
+
+	// A new store reads the hands back from the file
+	store = createHistoryStore(dir)
+	recent := store.recent("test", 2)
+	if len(recent) != 2 || recent[0].ID != 3 || recent[1].ID != 2 {
+		t.Fatalf("recent hands %v, want hands 3 and 2", recent)
+	}
+	if store.lastID != 3 {
+		t.Errorf("last id is %d, want 3", store.lastID)
+	}
+	if hands := store.recent("other", 10); len(hands) != 0 {
+		t.Errorf("a table without a history has %d hands", len(hands))
+	}
+
+	// Once the file has twice the hands kept, it is rewritten with only those kept
+	store.hands["test"] = createHands(HISTORY_MAX_HANDS, time.Now())
+	store.lines["test"] = 2 * HISTORY_MAX_HANDS
+	store.record(HandHistory{ID: HISTORY_MAX_HANDS + 1, Table: "test", Started: time.Now()})
+
+	if count := countSavedHands(t, store, "test"); count != HISTORY_MAX_HANDS {
+		t.Errorf("saved %d hands, want %d", count, HISTORY_MAX_HANDS)
+	}
+	if store.lines["test"] != HISTORY_MAX_HANDS {
+		t.Errorf("counted %d lines, want %d", store.lines["test"], HISTORY_MAX_HANDS)
+	}
+
+	store = createHistoryStore(dir)
+	recent = store.recent("test", 1)
+	if len(recent) != 1 || recent[0].ID != HISTORY_MAX_HANDS+1 {
+		t.Errorf("recent hands after the rewrite %v, want hand %d", recent, HISTORY_MAX_HANDS+1)
+	}
+}
+
+func TestPublicHand(t *testing.T) {
+	hand := HandHistory{
+		Actions: []HistoryAction{
+			{Round: 1, Player: "Jim", Action: ACTION_DEAL, Down: "AS", Up: "KD"},
+			{Round: 1, Player: "Kirk", Action: ACTION_DEAL, Down: "2C", Up: "3H"},
+			{Round: 1, Player: "Meg", Action: ACTION_DEAL, Down: "QS", Up: "QH"},
+		},
+		Showdown: []HistoryShowdown{{Player: "jim", Cards: "ASKD", Hand: "Ace high"}},
+	}
+
+	public := hand.public()
+	want := []string{"AS", "", ""}
+	for i, action := range public.Actions {
+		if action.Down != want[i] {
+			t.Errorf("%s shows down cards %q, want %q", action.Player, action.Down, want[i])
+		}
+		if action.Up != hand.Actions[i].Up {
+			t.Errorf("%s shows up cards %q, want %q", action.Player, action.Up, hand.Actions[i].Up)
+		}
+	}
+
+	if hand.Actions[1].Down != "2C" {
+		t.Errorf("the hand itself was changed")
+	}
+}
+
+func TestHandText(t *testing.T) {
+	hand := HandHistory{
+		ID:      42,
+		Name:    "Test",
+		Game:    GAME_HOLDEM,
+		Stakes:  Stakes{Betting: BETTING_NO_LIMIT, BringIn: 1, Low: 2},
+		Started: time.Date(2024, 3, 1, 12, 30, 0, 0, time.UTC),
+		Button:  2,
+		Seats:   []HistorySeat{{Seat: 1, Name: "Jim", Stack: 100, Won: 3}, {Seat: 2, Name: "Meg", Stack: 100}},
+		Actions: []HistoryAction{
+			{Round: 1, Player: "Jim", Action: ACTION_BLIND, Amount: 1, To: 1},
+			{Round: 1, Player: "Meg", Action: ACTION_BLIND, Amount: 2, To: 2},
+			{Round: 1, Player: "Jim", Action: ACTION_DEAL, Down: "ASKD"},
+			{Round: 1, Player: "Jim", Action: ACTION_RAISE, Amount: 5, To: 6},
+			{Round: 1, Player: "Meg", Action: ACTION_FOLD},
+		},
+		Pots: []HistoryPot{{Amount: 3, Winners: []string{"Jim"}, Share: 3}},
+	}
+
+	text := hand.text()
+	for _, line := range []string{
+		"PokerStars Hand #42: Hold'em No Limit (1/2) - 2024/03/01 12:30:00 UTC",
+		"Table 'Test' 8-max Seat #2 is the button",
+		"Seat 1: Jim (100 in chips)",
+		"Jim: posts small blind 1",
+		"Meg: posts big blind 2",
+		"*** HOLE CARDS ***",
+		"Dealt to Jim [As Kd]",
+		"Jim: raises 4 to 6",
+		"Meg: folds",
+		"Jim collected 3 from pot",
+		"Total pot 3 | Rake 0",
+		"Seat 2: Meg folded",
+	} {
+		if !strings.Contains(text, line+"\n") {
+			t.Errorf("missing %q in:\n%s", line, text)
+		}
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"io"
 	"log"
 	"net/http"
+	"time"
 
 	"github.com/goccy/go-json"
 )
@@ -33,6 +34,16 @@ var DefaultGameServerDetails = GameServer{
 
 var UpdateLobby bool
 
+// Updates are sent in order by sendLobbyUpdates, so a slow lobby never holds up a table
+const LOBBY_QUEUE_SIZE = 100
+const LOBBY_TIMEOUT = time.Second * time.Duration(10)
+
+var lobbyQueue = make(chan GameServer, LOBBY_QUEUE_SIZE)
+var lobbyClient = &http.Client{Timeout: LOBBY_TIMEOUT}
+
+const PLAYER_TYPE_BOT = "bot"
+const PLAYER_TYPE_HUMAN = "human"
+
 type GameServer struct {
 	// Properties being sent from Game Server
 	Game       string       `json:"game"`
@@ -44,6 +55,7 @@ type GameServer struct {
 	Maxplayers int          `json:"maxplayers"`
 	Curplayers int          `json:"curplayers"`
 	Clients    []GameClient `json:"clients"`
+	GameResult *GameResult  `json:"gameResult,omitempty"`
 }
 
 type GameClient struct {
@@ -51,7 +63,19 @@ type GameClient struct {
 	Url      string `json:"url"`
 }
 
-func sendStateToLobby(maxPlayers int, curPlayers int, isOnline bool, server string, instanceUrlSuffix string) {
+type GameResult struct {
+	Players []GamePlayer `json:"players"`
+}
+
+type GamePlayer struct {
+	Name   string `json:"name"`
+	Winner bool   `json:"winner"`
+	Type   string `json:"type"`
+}
+
+// Queues an update of the lobby entry of a table. It never waits for the lobby, so it can be called
+// while the table is locked.
+func sendStateToLobby(maxPlayers int, curPlayers int, isOnline bool, server string, instanceUrlSuffix string, gameResult *GameResult) {
 
 	if !UpdateLobby {
 		return
@@ -69,7 +93,23 @@ func sendStateToLobby(maxPlayers int, curPlayers int, isOnline bool, server stri
 
 	serverDetails.Server = server
 	serverDetails.Serverurl += instanceUrlSuffix
+	serverDetails.GameResult = gameResult
+
+	select {
+	case lobbyQueue <- serverDetails:
+	default:
+		log.Printf("Lobby queue is full, dropping update of %s", server)
+	}
+}
+
+// Posts the queued updates to the lobby. Runs for the life of the server.
+func sendLobbyUpdates() {
+	for serverDetails := range lobbyQueue {
+		postToLobby(serverDetails)
+	}
+}
 
+func postToLobby(serverDetails GameServer) {
 	jsonPayload, err := json.Marshal(serverDetails)
 	if err != nil {
 		panic(err)
@@ -82,8 +122,7 @@ func sendStateToLobby(maxPlayers int, curPlayers int, isOnline bool, server stri
 	}
 	request.Header.Set("Content-Type", "application/json; charset=UTF-8")
 
-	client := &http.Client{}
-	response, err := client.Do(request)
+	response, err := lobbyClient.Do(request)
 	if err != nil {
 		log.Println(err)
 		return
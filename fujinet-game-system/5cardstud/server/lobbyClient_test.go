@@ -0,0 +1,40 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// Lobby updates are queued, so a table never waits for the lobby, even when it is down
+func TestLobbyUpdatesDontWait(t *testing.T) {
+	UpdateLobby = true
+	defer func() {
+		UpdateLobby = false
+		for len(lobbyQueue) > 0 {
+			<-lobbyQueue
+		}
+	}()
+
+	done := make(chan struct{})
+	go func() {
+		for i := 0; i < LOBBY_QUEUE_SIZE+10; i++ {
+			sendStateToLobby(4, 1, true, "Test", "?table=test", nil)
+		}
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatalf("sendStateToLobby waited for the lobby")
+	}
+
+	if len(lobbyQueue) != LOBBY_QUEUE_SIZE {
+		t.Fatalf("lobby queue has %d updates, want %d", len(lobbyQueue), LOBBY_QUEUE_SIZE)
+	}
+
+	update := <-lobbyQueue
+	if update.Serverurl != DefaultGameServerDetails.Serverurl+"?table=test" || update.Status != "online" {
+		t.Fatalf("queued update is %+v", update)
+	}
+}
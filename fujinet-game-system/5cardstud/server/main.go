@@ -1,14 +1,19 @@
 package main
 
 import (
-	"fmt"
+	"errors"
+	"io"
 	"log"
+	"net/http"
 	"os"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/goccy/go-json"
+	"golang.org/x/exp/slices"
 )
 
 // A sync.Map is used to save the state at the end of a request without needing synchronization
@@ -17,6 +22,7 @@ import (
 // A mutex is used so a given table can only be accessed by a single request at a time
 var stateMap sync.Map
 var tables []GameTable = []GameTable{}
+var tablesMutex sync.Mutex
 
 var tableMutex KeyedMutex
 
@@ -41,6 +47,7 @@ func main() {
 	if UpdateLobby {
 		log.Printf("This instance will update the lobby at " + LOBBY_ENDPOINT_UPSERT)
 		gin.SetMode(gin.ReleaseMode)
+		go sendLobbyUpdates()
 	}
 
 	// Determine port for HTTP service.
@@ -65,19 +72,30 @@ func main() {
 	router.POST("/leave", apiLeave)
 
 	router.GET("/tables", apiTables)
+	router.POST("/tables", apiCreateTable)
+	router.DELETE("/tables", apiDeleteTable)
+	router.GET("/private", apiCreatePrivateTable)
+	router.POST("/private", apiCreatePrivateTable)
+
+	router.GET("/leaderboard", apiLeaderboard)
+	router.GET("/history", apiHistory)
 	router.GET("/updateLobby", apiUpdateLobby)
 
 	//	router.GET("/REFRESHLOBBY", apiRefresh)
 
 	initializeGameServer()
+	initializeBankrolls()
+	initializeHistory()
 	initializeTables()
 
+	go expirePrivateTables()
+
 	router.Run(":" + port)
 }
 
 // Api Request steps
 // 1. Get state
-// 2. Game Logic
+// 2. Client action (join, move, leave) - the game itself is moved along by the ticker of the table
 // 3. Save state
 // 4. Return client centric state
 
@@ -91,7 +109,7 @@ func main() {
 // Executes a move for the client player, if that player is currently active
 func apiMove(c *gin.Context) {
 
-	state, unlock := getState(c)
+	state, unlock := getState(c, false)
 	func() {
 		defer unlock()
 
@@ -99,7 +117,8 @@ func apiMove(c *gin.Context) {
 			// Access check - only move if the client is the active player
 			if state.clientPlayer == state.ActivePlayer {
 				move := strings.ToUpper(c.Param("move"))
-				state.performMove(move)
+				amount, _ := strconv.Atoi(c.Query("amount"))
+				state.performMove(move, amount)
 				saveState(state)
 				state = state.createClientState()
 			}
@@ -109,17 +128,22 @@ func apiMove(c *gin.Context) {
 	serializeResults(c, state)
 }
 
-// Steps forward and returns the updated state
+// Returns the current state. The game is moved along by the ticker of the table, so this only
+// seats a new player and keeps the player active.
 func apiState(c *gin.Context) {
 	hash := c.Query("hash")
-	state, unlock := getState(c)
+	state, unlock := getState(c, true)
 
 	func() {
 		defer unlock()
 
 		if state != nil {
 			if state.clientPlayer >= 0 {
-				state.runGameLogic()
+				state.playerPing()
+			}
+
+			// Seating a player may have dropped others, so save even if the table was full
+			if c.Query("player") != "" {
 				saveState(state)
 			}
 			state = state.createClientState()
@@ -137,7 +161,7 @@ func apiState(c *gin.Context) {
 
 // Drop from the specified table
 func apiLeave(c *gin.Context) {
-	state, unlock := getState(c)
+	state, unlock := getState(c, false)
 
 	func() {
 		defer unlock()
@@ -156,7 +180,7 @@ func apiLeave(c *gin.Context) {
 // Returns a view of the current state without causing it to change. For debugging side-by-side with a client
 func apiView(c *gin.Context) {
 
-	state, unlock := getState(c)
+	state, unlock := getState(c, false)
 	func() {
 		defer unlock()
 
@@ -173,12 +197,15 @@ func apiView(c *gin.Context) {
 func apiTables(c *gin.Context) {
 	returnDevTables := c.Query("dev") == "1"
 
+	// Clients that only play 5 Card Stud don't know the other games, so they are only listed on request
+	returnAllGames := c.Query("games") == "all"
+
 	tableOutput := []GameTable{}
-	for _, table := range tables {
+	for _, table := range getTables() {
 		value, ok := stateMap.Load(table.Table)
-		if ok {
+		if ok && !table.config.Hidden && (returnAllGames || table.Game == "") {
 			state := value.(*GameState)
-			if (returnDevTables && !state.registerLobby) || (!returnDevTables && state.registerLobby) {
+			if returnDevTables != table.config.Lobby {
 				humanPlayerSlots, humanPlayerCount := state.getHumanPlayerCountInfo()
 				table.CurPlayers = humanPlayerCount
 				table.MaxPlayers = humanPlayerSlots
@@ -189,9 +216,123 @@ func apiTables(c *gin.Context) {
 	serializeResults(c, tableOutput)
 }
 
+// Creates a table from the json config in the body. Requires the admin key.
+func apiCreateTable(c *gin.Context) {
+	if !isAdmin(c.GetHeader("Authorization")) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	config := TableConfig{}
+	body, err := io.ReadAll(c.Request.Body)
+	if err == nil {
+		err = json.Unmarshal(body, &config)
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid table config"})
+		return
+	}
+
+	config, err = createTable(config)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	saveConfig(tableConfigs())
+	log.Printf("Created table %s", config.Table)
+	c.JSON(http.StatusCreated, config)
+}
+
+// Removes the table passed as "table". Requires the admin key.
+func apiDeleteTable(c *gin.Context) {
+	if !isAdmin(c.GetHeader("Authorization")) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	table := strings.ToLower(c.Query("table"))
+	if !removeTable(table) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "table not found"})
+		return
+	}
+
+	saveConfig(tableConfigs())
+	log.Printf("Removed table %s", table)
+	serializeResults(c, "Table removed")
+}
+
+// Creates a private table for the player, returning its id and invite code. The player may pass a name,
+// game, betting, seats, and a password to use as the invite code.
+func apiCreatePrivateTable(c *gin.Context) {
+	player := strings.TrimSpace(c.Query("player"))
+	if player == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "player is required"})
+		return
+	}
+
+	name := strings.TrimSpace(c.Query("name"))
+	if name == "" {
+		name = player + "'s Table"
+	}
+	if runes := []rune(name); len(runes) > 20 {
+		name = string(runes[:20])
+	}
+
+	seats, _ := strconv.Atoi(c.Query("seats"))
+	config := TableConfig{Name: name, Game: c.Query("game"), Stakes: Stakes{Betting: c.Query("betting")}, Seats: seats}
+
+	privateTable, err := createPrivateTable(config, c.Query("password"), c.ClientIP())
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	serializeResults(c, privateTable)
+}
+
+// Returns the players with the biggest stacks and the biggest pots won
+func apiLeaderboard(c *gin.Context) {
+	serializeResults(c, bankrolls.leaderboard())
+}
+
+// Returns the most recent hands played at a table (n, default 10), as json or with "format=text"
+// as PokerStars style hand histories. Pass "player" to see that player's down cards.
+func apiHistory(c *gin.Context) {
+	table := strings.ToLower(c.Query("table"))
+	if table == "" {
+		table = "default"
+	}
+
+	count, err := strconv.Atoi(c.Query("n"))
+	if err != nil || count < 1 {
+		count = HISTORY_DEFAULT_RESULTS
+	}
+	count = minInt(count, HISTORY_MAX_RESULTS)
+
+	// Only tables that exist have a history
+	hands := []HandHistory{}
+	if value, ok := stateMap.Load(table); ok && value.(*GameState).canAccess(c.Query("code")) {
+		for _, hand := range histories.recent(table, count) {
+			hands = append(hands, hand.public())
+		}
+	}
+
+	if c.Query("format") == "text" {
+		texts := []string{}
+		for _, hand := range hands {
+			texts = append(texts, hand.text())
+		}
+		c.String(http.StatusOK, strings.Join(texts, "\n\n"))
+		return
+	}
+
+	serializeResults(c, hands)
+}
+
 // Forces an update of all tables to the lobby - useful for adhoc use if the Lobby restarts or loses info
 func apiUpdateLobby(c *gin.Context) {
-	for _, table := range tables {
+	for _, table := range getTables() {
 		value, ok := stateMap.Load(table.Table)
 		if ok {
 			state := value.(*GameState)
@@ -202,8 +343,9 @@ func apiUpdateLobby(c *gin.Context) {
 	serializeResults(c, "Lobby Updated")
 }
 
-// Gets the current game state for the specified table and adds the player id of the client to it
-func getState(c *gin.Context) (*GameState, func()) {
+// Gets the current game state for the specified table and adds the player id of the client to it.
+// With seat, a player that is not at the table is seated if there is room (see setClientPlayerByName).
+func getState(c *gin.Context, seat bool) (*GameState, func()) {
 	table := c.Query("table")
 
 	if table == "" {
@@ -220,10 +362,11 @@ func getState(c *gin.Context) (*GameState, func()) {
 
 	var state *GameState
 
-	if ok {
+	// A private table is only found with its invite code
+	if ok && value.(*GameState).canAccess(c.Query("code")) {
 		stateCopy := *value.(*GameState)
 		state = &stateCopy
-		state.setClientPlayerByName(player)
+		state.setClientPlayerByName(player, seat)
 	}
 
 	return state, unlock
@@ -234,33 +377,113 @@ func saveState(state *GameState) {
 }
 
 func initializeTables() {
+	for _, config := range loadConfig() {
+		if _, err := createTable(config); err != nil {
+			log.Printf("Unable to create table %s: %s", config.Table, err)
+		}
+	}
+}
 
-	// Create the real servers (hard coded for now)
-	createTable("The Basement", "basement", 0, true)
-	createTable("The Den", "den", 0, true)
-	createTable("AI Room - 2 bots", "ai2", 2, true)
-	createTable("AI Room - 4 bots", "ai4", 4, true)
-	createTable("AI Room - 6 bots", "ai6", 6, true)
+// Creates a table from its config, returning the config with its defaults filled in
+func createTable(config TableConfig) (TableConfig, error) {
+	config, err := config.validate()
+	if err != nil {
+		return config, err
+	}
 
-	// For client developers, create hidden tables for each # of bots (for ease of testing with a specific # of players in the game)
-	// These will not update the lobby
+	// The lobby entry of the server is for 5 Card Stud clients, so only those tables are registered
+	state := createGameState(config.Game, config.Stakes, config.Bots, config.Lobby && config.Game == GAME_FIVE_STUD)
+	state.table = config.Table
+	state.serverName = config.Name
+	state.botLevel = config.BotLevel
+	state.maxSeats = config.Seats
+	state.inviteCode = config.code
+	state.reportResults = config.Lobby
+
+	// A Sit & Go tournament table, with some of its seats taken by bots
+	if config.Tournament {
+		state.tournament = Tournament{Seats: state.seats(), Bots: config.Bots, base: config.Stakes}
+		state.startTournament()
+	}
 
-	for i := 1; i < 8; i++ {
-		createTable(fmt.Sprintf("Dev Room - %d bots", i), fmt.Sprintf("dev%d", i), i, false)
+	// Claim the table id, so two requests creating the same table can't both succeed
+	if _, loaded := stateMap.LoadOrStore(config.Table, state); loaded {
+		return config, errors.New("table already exists")
 	}
 
+	addTable(state, config)
+	return config, nil
 }
 
-func createTable(serverName string, table string, botCount int, registerLobby bool) {
-	state := createGameState(botCount, registerLobby)
-	state.table = table
-	state.serverName = serverName
+func addTable(state *GameState, config TableConfig) {
 	saveState(state)
+	startTicker(config.Table)
 	state.updateLobby()
 
-	tables = append([]GameTable{{Table: table, Name: serverName}}, tables...)
+	gameTable := GameTable{Table: config.Table, Name: config.Name, config: config}
+	if state.gameType != GAME_FIVE_STUD {
+		gameTable.Game = state.gameType
+	}
+	if state.hasAmounts() {
+		gameTable.Betting = state.stakes.Betting
+	}
+
+	tablesMutex.Lock()
+	tables = append([]GameTable{gameTable}, tables...)
+	tablesMutex.Unlock()
 
 	if UpdateLobby {
 		time.Sleep(time.Millisecond * time.Duration(100))
 	}
 }
+
+// Removes a table, returning the chips of its players to their bankrolls. Returns false if there is no such table.
+func removeTable(table string) bool {
+	unlock := tableMutex.Lock(table)
+	defer unlock()
+
+	value, ok := stateMap.Load(table)
+	if !ok {
+		return false
+	}
+	state := value.(*GameState)
+
+	for _, player := range state.Players {
+		if !player.isBot && !state.isTournament() {
+			bankrolls.standUp(player.Name, state.table, player.Purse)
+		}
+	}
+
+	stateMap.Delete(table)
+	stopTicker(table)
+	if state.registerLobby {
+		sendStateToLobby(0, 0, false, state.serverName, "?table="+state.table, nil)
+	}
+
+	tablesMutex.Lock()
+	if index := slices.IndexFunc(tables, func(t GameTable) bool { return t.Table == table }); index >= 0 {
+		tables = slices.Delete(tables, index, index+1)
+	}
+	tablesMutex.Unlock()
+
+	return true
+}
+
+// The configs of all tables but private tables, in the order they were created
+func tableConfigs() []TableConfig {
+	configs := []TableConfig{}
+	for _, table := range getTables() {
+		if table.config.code == "" {
+			configs = append([]TableConfig{table.config}, configs...)
+		}
+	}
+	return configs
+}
+
+// Returns a copy of the table list, safe to use while tables are added or removed
+func getTables() []GameTable {
+	tablesMutex.Lock()
+	defer tablesMutex.Unlock()
+
+	return append([]GameTable{}, tables...)
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+/*
+Private tables - a player can create a table for friends with /private. It is not listed in /tables
+or the lobby, has no bots, and can only be joined (or viewed) by passing its invite code as "code",
+e.g. /state?table=p3k9x2ab&code=QX7M4T. The player may choose the code as a password instead.
+
+Private tables are not saved to the config file, and are removed once nobody has played at them
+for PRIVATE_TABLE_EXPIRY. A client can only have MAX_PRIVATE_TABLES_PER_ADDRESS of them at a time,
+so no one can take all the private tables.
+*/
+
+const PRIVATE_TABLE_EXPIRY = time.Minute * time.Duration(15)
+const PRIVATE_TABLE_CHECK_INTERVAL = time.Minute
+const MAX_PRIVATE_TABLES = 100
+const MAX_PRIVATE_TABLES_PER_ADDRESS = 3
+const INVITE_CODE_LENGTH = 6
+
+// Letters and digits that are hard to mix up
+const inviteCodeChars = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+
+// Held while counting the private tables and creating one, so the limits can't be passed by
+// creating tables at the same time
+var privateTablesMutex sync.Mutex
+
+// Used to send a new private table to the player that created it
+type PrivateTable struct {
+	Table string `json:"t"`
+	Name  string `json:"n"`
+	Code  string `json:"c"`
+}
+
+// True if the invite code opens this table. Tables that are not private are open to all.
+func (state *GameState) canAccess(code string) bool {
+	return state.inviteCode == "" || subtle.ConstantTimeCompare([]byte(strings.TrimSpace(code)), []byte(state.inviteCode)) == 1
+}
+
+// Creates a private table for the client at address, with a random invite code unless a password is given
+func createPrivateTable(config TableConfig, password string, address string) (PrivateTable, error) {
+	password = strings.TrimSpace(password)
+	if utf8.RuneCountInString(password) > 20 {
+		return PrivateTable{}, errors.New("password must be up to 20 characters")
+	}
+
+	privateTablesMutex.Lock()
+	defer privateTablesMutex.Unlock()
+
+	private, created := 0, 0
+	for _, table := range getTables() {
+		if table.config.code != "" {
+			private++
+			if table.config.creator == address {
+				created++
+			}
+		}
+	}
+	if private >= MAX_PRIVATE_TABLES {
+		return PrivateTable{}, errors.New("too many private tables")
+	}
+	if created >= MAX_PRIVATE_TABLES_PER_ADDRESS {
+		return PrivateTable{}, fmt.Errorf("you can only have %d private tables at a time", MAX_PRIVATE_TABLES_PER_ADDRESS)
+	}
+
+	config.code = password
+	config.creator = address
+	if config.code == "" {
+		config.code = randomString(inviteCodeChars, INVITE_CODE_LENGTH)
+	}
+
+	// Pick an unused table id
+	for {
+		config.Table = "p" + randomString("abcdefghijklmnopqrstuvwxyz0123456789", 7)
+		if _, ok := stateMap.Load(config.Table); !ok {
+			break
+		}
+	}
+
+	config.Bots = 0
+	config.Tournament = false
+	config.Hidden = true
+	config.Lobby = false
+
+	config, err := createTable(config)
+	if err != nil {
+		return PrivateTable{}, err
+	}
+
+	log.Printf("Created private table %s", config.Table)
+	return PrivateTable{Table: config.Table, Name: config.Name, Code: config.code}, nil
+}
+
+// Removes private tables that nobody has played at for a while. Runs for the life of the server.
+func expirePrivateTables() {
+	emptySince := map[string]time.Time{}
+
+	for now := range time.Tick(PRIVATE_TABLE_CHECK_INTERVAL) {
+		removeEmptyPrivateTables(emptySince, now)
+	}
+}
+
+// Removes the private tables that have been empty for longer than PRIVATE_TABLE_EXPIRY at this time.
+// emptySince holds when each table was first seen empty, and is kept between calls.
+func removeEmptyPrivateTables(emptySince map[string]time.Time, now time.Time) {
+	for _, table := range getTables() {
+		if table.config.code == "" {
+			continue
+		}
+
+		unlock := tableMutex.Lock(table.Table)
+		humanPlayerCount := 0
+		if value, ok := stateMap.Load(table.Table); ok {
+			_, humanPlayerCount = value.(*GameState).getHumanPlayerCountInfo()
+		}
+		unlock()
+
+		if humanPlayerCount > 0 {
+			delete(emptySince, table.Table)
+			continue
+		}
+
+		if _, ok := emptySince[table.Table]; !ok {
+			emptySince[table.Table] = now
+		} else if now.Sub(emptySince[table.Table]) > PRIVATE_TABLE_EXPIRY {
+			removeTable(table.Table)
+			delete(emptySince, table.Table)
+			log.Printf("Private table %s expired", table.Table)
+		}
+	}
+}
+
+func randomString(chars string, length int) string {
+	result := ""
+	for i := 0; i < length; i++ {
+		index, _ := rand.Int(rand.Reader, big.NewInt(int64(len(chars))))
+		result += string(chars[index.Int64()])
+	}
+	return result
+}
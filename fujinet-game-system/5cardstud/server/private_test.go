@@ -0,0 +1,152 @@
+package main
+
+import (
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Removes the private tables created by a test
+func removePrivateTables() {
+	for _, table := range getTables() {
+		if table.config.code != "" {
+			removeTable(table.Table)
+		}
+	}
+}
+
+func TestPrivateTablePassword(t *testing.T) {
+	defer removePrivateTables()
+
+	privateTable, err := createPrivateTable(TableConfig{Name: "Friends"}, " Secret ", "10.0.0.1")
+	if err != nil {
+		t.Fatalf("createPrivateTable failed with %s", err)
+	}
+
+	value, _ := stateMap.Load(privateTable.Table)
+	state := value.(*GameState)
+
+	tests := []struct {
+		code string
+		want bool
+	}{
+		{"Secret", true},
+		{" Secret", true},
+		{"secret", false},
+		{"SECRET", false},
+		{"Secret!", false},
+		{"", false},
+	}
+	for _, test := range tests {
+		if got := state.canAccess(test.code); got != test.want {
+			t.Errorf("canAccess(%q) = %v, want %v", test.code, got, test.want)
+		}
+	}
+
+	if _, err := createPrivateTable(TableConfig{Name: "Friends"}, strings.Repeat("ü", 21), "10.0.0.1"); err == nil {
+		t.Errorf("a password of 21 characters was taken")
+	}
+	if _, err := createPrivateTable(TableConfig{Name: "Friends"}, strings.Repeat("ü", 20), "10.0.0.1"); err != nil {
+		t.Errorf("a password of 20 characters was refused: %s", err)
+	}
+}
+
+// A client can't take all the private tables
+func TestPrivateTablesPerAddress(t *testing.T) {
+	defer removePrivateTables()
+
+	for i := 0; i < MAX_PRIVATE_TABLES_PER_ADDRESS; i++ {
+		if _, err := createPrivateTable(TableConfig{Name: "Friends"}, "", "10.0.0.1"); err != nil {
+			t.Fatalf("private table %d failed with %s", i+1, err)
+		}
+	}
+
+	if _, err := createPrivateTable(TableConfig{Name: "Friends"}, "", "10.0.0.1"); err == nil {
+		t.Fatalf("an address created more than %d private tables", MAX_PRIVATE_TABLES_PER_ADDRESS)
+	}
+
+	if _, err := createPrivateTable(TableConfig{Name: "Friends"}, "", "10.0.0.2"); err != nil {
+		t.Fatalf("another address could not create a private table: %s", err)
+	}
+}
+
+// Long names are cut to 20 characters, not 20 bytes
+func TestPrivateTableNameCut(t *testing.T) {
+	defer removePrivateTables()
+	gin.SetMode(gin.TestMode)
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest("GET", "/private?player=Jim&name="+url.QueryEscape(strings.Repeat("é", 25)), nil)
+
+	apiCreatePrivateTable(c)
+
+	for _, table := range getTables() {
+		if table.config.code != "" {
+			if table.Name != strings.Repeat("é", 20) {
+				t.Fatalf("private table is named %q", table.Name)
+			}
+			return
+		}
+	}
+	t.Fatalf("no private table was created: %s", w.Body.String())
+}
+
+// Private tables are removed once nobody has played at them for PRIVATE_TABLE_EXPIRY
+func TestPrivateTableExpiry(t *testing.T) {
+	defer removePrivateTables()
+
+	empty, _ := createPrivateTable(TableConfig{Name: "Empty"}, "", "10.0.0.1")
+	busy, _ := createPrivateTable(TableConfig{Name: "Busy"}, "", "10.0.0.1")
+
+	// A player sits at the busy table
+	unlock := tableMutex.Lock(busy.Table)
+	value, _ := stateMap.Load(busy.Table)
+	state := value.(*GameState)
+	state.addPlayer("Jim", false)
+	state.Players[0].lastPing = time.Now()
+	unlock()
+
+	exists := func(table string) bool {
+		_, ok := stateMap.Load(table)
+		return ok
+	}
+
+	emptySince := map[string]time.Time{}
+	now := time.Now()
+
+	removeEmptyPrivateTables(emptySince, now)
+	removeEmptyPrivateTables(emptySince, now.Add(PRIVATE_TABLE_EXPIRY))
+	if !exists(empty.Table) {
+		t.Fatalf("the empty table was removed before it expired")
+	}
+
+	removeEmptyPrivateTables(emptySince, now.Add(PRIVATE_TABLE_EXPIRY+time.Minute))
+	if exists(empty.Table) {
+		t.Errorf("the empty table was not removed after %s", PRIVATE_TABLE_EXPIRY)
+	}
+	if !exists(busy.Table) {
+		t.Fatalf("the table with a player was removed")
+	}
+
+	// Once the player leaves, the table expires in turn
+	unlock = tableMutex.Lock(busy.Table)
+	value, _ = stateMap.Load(busy.Table)
+	value.(*GameState).Players[0].Status = STATUS_LEFT
+	unlock()
+
+	later := now.Add(PRIVATE_TABLE_EXPIRY + 2*time.Minute)
+	removeEmptyPrivateTables(emptySince, later)
+	if !exists(busy.Table) {
+		t.Fatalf("the table was removed as soon as the player left")
+	}
+
+	removeEmptyPrivateTables(emptySince, later.Add(PRIVATE_TABLE_EXPIRY+time.Minute))
+	if exists(busy.Table) {
+		t.Errorf("the table was not removed after the player left")
+	}
+}
@@ -0,0 +1,73 @@
+package main
+
+/*
+Betting structures - every table has its own stakes, chosen when the table is created.
+
+Fixed limit (default) - bets and raises are Low on the first two betting rounds and High after,
+  with at most 3 raises a round.
+
+Pot limit - bets and raises carry an amount, from Low (or the last raise) up to the size of the pot
+  after calling.
+
+No limit - as pot limit, but up to everything left in the player's purse.
+
+A bet amount is the total bet for the round, a raise amount is what is added on top of calling.
+Moves that carry an amount are sent as e.g. /move/RA?amount=40, and the smallest one is used
+if no amount is sent.
+*/
+
+const (
+	BETTING_LIMIT     = "limit"
+	BETTING_POT_LIMIT = "pot"
+	BETTING_NO_LIMIT  = "nolimit"
+)
+
+type Stakes struct {
+	Betting   string `json:"betting"`
+	Ante      int    `json:"ante"`
+	BringIn   int    `json:"bringIn"` // Stud bring-in, or the Hold'em small blind
+	Low       int    `json:"low"`     // Also the Hold'em big blind
+	High      int    `json:"high"`
+	MaxRaises int    `json:"maxRaises"` // Raises allowed each round, 0 for no cap
+}
+
+var fixedLimitStakes = Stakes{Betting: BETTING_LIMIT, Ante: ANTE, BringIn: BRINGIN, Low: LOW, High: HIGH, MaxRaises: 3}
+var potLimitStakes = Stakes{Betting: BETTING_POT_LIMIT, Ante: ANTE, BringIn: BRINGIN, Low: LOW, High: HIGH}
+var noLimitStakes = Stakes{Betting: BETTING_NO_LIMIT, Ante: ANTE, BringIn: BRINGIN, Low: LOW, High: HIGH}
+
+// True if bets and raises carry an amount (pot and no limit)
+func (state *GameState) hasAmounts() bool {
+	return state.stakes.Betting != BETTING_LIMIT
+}
+
+// True if the raise cap for this round has not been met
+func (state *GameState) canRaise() bool {
+	return state.stakes.MaxRaises == 0 || state.raiseCount < state.stakes.MaxRaises
+}
+
+// The size of the pot once the player has called, including the bets of this round
+func (state *GameState) potAfterCall(toCall int) int {
+	pot := state.Pot + toCall
+	for _, player := range state.Players {
+		pot += player.Bet
+	}
+	return pot
+}
+
+// The largest total bet the player can make when nobody has bet yet
+func (state *GameState) maxBet(player Player, toCall int) int {
+	max := player.Bet + player.Purse
+	if state.stakes.Betting == BETTING_POT_LIMIT {
+		max = minInt(max, state.currentBet+state.potAfterCall(toCall))
+	}
+	return max
+}
+
+// The largest raise the player can make on top of calling
+func (state *GameState) maxRaise(player Player, toCall int) int {
+	max := player.Purse - toCall
+	if state.stakes.Betting == BETTING_POT_LIMIT {
+		max = minInt(max, state.potAfterCall(toCall))
+	}
+	return maxInt(max, state.raiseAmount)
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"testing"
+
+	"golang.org/x/exp/slices"
+)
+
+// A table on 3rd street with the active player first, and the chips of earlier streets in the pot
+func createBettingState(stakes Stakes, pot int, purses ...int) *GameState {
+	state := createGameState(GAME_FIVE_STUD, stakes, 0, false)
+	state.Round = 2
+	state.Pot = pot
+	state.ActivePlayer = 0
+	for i, purse := range purses {
+		state.Players = append(state.Players, Player{Name: string(rune('A' + i)), Status: STATUS_PLAYING, Purse: purse, isBot: true, cards: []card{}})
+	}
+	return state
+}
+
+func findMove(moves []validMove, move string) (validMove, bool) {
+	index := slices.IndexFunc(moves, func(m validMove) bool { return m.Move == move })
+	if index < 0 {
+		return validMove{}, false
+	}
+	return moves[index], true
+}
+
+func TestBetLimits(t *testing.T) {
+	tests := []struct {
+		name    string
+		stakes  Stakes
+		pot     int
+		purse   int
+		wantMin int
+		wantMax int
+	}{
+		{"pot limit, up to the pot", potLimitStakes, 30, 500, LOW, 30},
+		{"pot limit, up to the purse", potLimitStakes, 100, 40, LOW, 40},
+		{"no limit, up to the purse", noLimitStakes, 30, 500, LOW, 500},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			state := createBettingState(test.stakes, test.pot, test.purse, 500)
+
+			bet, ok := findMove(state.getValidMoves(), "BL")
+			if !ok || bet.Min != test.wantMin || bet.Max != test.wantMax {
+				t.Fatalf("bet is %+v, want %d to %d", bet, test.wantMin, test.wantMax)
+			}
+		})
+	}
+}
+
+func TestRaiseLimits(t *testing.T) {
+	tests := []struct {
+		name    string
+		stakes  Stakes
+		purse   int
+		wantMin int
+		wantMax int
+	}{
+		// 30 in the pot, a bet of 10 and the call of 10 make a pot of 50
+		{"pot limit, up to the pot after calling", potLimitStakes, 500, 10, 50},
+		{"pot limit, up to the purse", potLimitStakes, 40, 10, 30},
+		{"no limit, up to the purse", noLimitStakes, 500, 10, 490},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			state := createBettingState(test.stakes, 30, 500, test.purse)
+
+			if !state.performMove("BL", 10, true) {
+				t.Fatalf("bet of 10 was refused")
+			}
+
+			raise, ok := findMove(state.getValidMoves(), "RA")
+			if !ok || raise.Min != test.wantMin || raise.Max != test.wantMax {
+				t.Fatalf("raise is %+v, want %d to %d", raise, test.wantMin, test.wantMax)
+			}
+
+			if state.performMove("RA", test.wantMax+1, true) || state.performMove("RA", test.wantMin-1, true) {
+				t.Fatalf("a raise out of range was taken")
+			}
+			if !state.performMove("RA", test.wantMax, true) || state.Players[1].Bet != 10+test.wantMax {
+				t.Fatalf("raise to the max bet %d, want %d", state.Players[1].Bet, 10+test.wantMax)
+			}
+
+			// The next raise must be at least as big
+			if raise, ok := findMove(state.getValidMoves(), "RA"); ok && raise.Min != test.wantMax {
+				t.Fatalf("next raise is %+v, want at least %d", raise, test.wantMax)
+			}
+		})
+	}
+}
+
+// Without an amount, the smallest bet is made
+func TestBetWithoutAmount(t *testing.T) {
+	state := createBettingState(noLimitStakes, 30, 500, 500)
+
+	if !state.performMove("BL", 0, true) || state.Players[0].Bet != LOW {
+		t.Fatalf("bet without an amount is %d, want %d", state.Players[0].Bet, LOW)
+	}
+}
+
+// Fixed limit bets have no amount, and the raises of a round are capped
+func TestFixedLimitRaises(t *testing.T) {
+	state := createBettingState(fixedLimitStakes, 30, 500, 500)
+
+	bet, ok := findMove(state.getValidMoves(), "BL")
+	if !ok || bet.Max != 0 || bet.Name != "Bet 5" {
+		t.Fatalf("fixed limit bet is %+v", bet)
+	}
+	state.performMove("BL", 0, true)
+
+	for i := 0; i < fixedLimitStakes.MaxRaises; i++ {
+		if !state.performMove("RA", 0, true) {
+			t.Fatalf("raise %d was refused", i+1)
+		}
+	}
+
+	if _, ok := findMove(state.getValidMoves(), "RA"); ok {
+		t.Fatalf("a raise was allowed over the cap of %d", fixedLimitStakes.MaxRaises)
+	}
+	if state.currentBet != LOW*(1+fixedLimitStakes.MaxRaises) {
+		t.Fatalf("current bet is %d, want %d", state.currentBet, LOW*(1+fixedLimitStakes.MaxRaises))
+	}
+}
@@ -0,0 +1,244 @@
+package main
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/goccy/go-json"
+)
+
+/*
+Table config - the tables of the server are read at startup from a json config file (CONFIG_FILE env,
+default "config.json"). Without a config file, the built in tables below are created.
+
+Tables can be created and removed while the server runs with POST /tables and DELETE /tables,
+authenticated with the admin key (ADMIN_KEY env, or "adminKey" in the config file) sent as
+"Authorization: Bearer [key]". Without an admin key, tables can't be changed. Every change
+saves the config file with all the tables of the server.
+*/
+
+type Config struct {
+	AdminKey string        `json:"adminKey,omitempty"`
+	Tables   []TableConfig `json:"tables"`
+}
+
+type TableConfig struct {
+	Table      string `json:"table"`
+	Name       string `json:"name"`
+	Game       string `json:"game,omitempty"`     // Default 5 Card Stud
+	Stakes     Stakes `json:"stakes"`             // Amounts left at 0 use the default stakes of the betting structure
+	Bots       int    `json:"bots"`               // Seats taken by bots
+	BotLevel   string `json:"botLevel,omitempty"` // Default normal
+	Seats      int    `json:"seats,omitempty"`    // Fewer seats than the game allows, 0 for all of them
+	Tournament bool   `json:"tournament,omitempty"`
+	Hidden     bool   `json:"hidden,omitempty"` // Not listed in /tables, but can still be joined
+	Lobby      bool   `json:"lobby"`            // Registered with the lobby (5 Card Stud only, other games only report Sit & Go results). Tables that are not are listed with dev=1.
+
+	// Internal
+	code    string // Invite code of a private table (see private.go)
+	creator string // Address of the client that created a private table
+}
+
+var serverConfig Config
+var configPath string
+var configMutex sync.Mutex
+
+var tableIdPattern = regexp.MustCompile("^[a-z0-9]{1,8}$")
+
+// Loads the config file, returning the tables to create (the built in tables if there is no config file)
+func loadConfig() []TableConfig {
+	configPath = os.Getenv("CONFIG_FILE")
+	if configPath == "" {
+		configPath = "config.json"
+	}
+
+	data, err := os.ReadFile(configPath)
+	if err == nil {
+		err = json.Unmarshal(data, &serverConfig)
+	}
+
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Printf("Unable to read config: %s", err)
+		}
+		serverConfig.Tables = defaultTables()
+	} else {
+		log.Printf("Loaded %d tables from %s", len(serverConfig.Tables), configPath)
+	}
+
+	if key := os.Getenv("ADMIN_KEY"); key != "" {
+		serverConfig.AdminKey = key
+	}
+
+	return serverConfig.Tables
+}
+
+// Saves the config file with the current tables
+func saveConfig(tableConfigs []TableConfig) {
+	configMutex.Lock()
+	defer configMutex.Unlock()
+
+	config := Config{Tables: tableConfigs}
+
+	// An admin key from the env is not written to the file
+	if os.Getenv("ADMIN_KEY") == "" {
+		config.AdminKey = serverConfig.AdminKey
+	}
+
+	data, err := json.MarshalIndent(config, "", "  ")
+	if err == nil && filepath.Dir(configPath) != "." {
+		err = os.MkdirAll(filepath.Dir(configPath), 0755)
+	}
+
+	// Write to a temp file first, so a crash never leaves a partial file
+	if err == nil {
+		err = os.WriteFile(configPath+".tmp", data, 0644)
+	}
+	if err == nil {
+		err = os.Rename(configPath+".tmp", configPath)
+	}
+
+	if err != nil {
+		log.Printf("Unable to save config: %s", err)
+	}
+}
+
+// True if the request carries the admin key
+func isAdmin(authorization string) bool {
+	key := strings.TrimPrefix(authorization, "Bearer ")
+	return serverConfig.AdminKey != "" && subtle.ConstantTimeCompare([]byte(key), []byte(serverConfig.AdminKey)) == 1
+}
+
+// Fills in the defaults of a table config, returning an error if it is not valid
+func (config TableConfig) validate() (TableConfig, error) {
+	config.Table = strings.ToLower(config.Table)
+	config.Name = strings.TrimSpace(config.Name)
+
+	if config.Game == "" {
+		config.Game = GAME_FIVE_STUD
+	}
+	if config.BotLevel == "" {
+		config.BotLevel = BOT_NORMAL
+	}
+
+	// Start from the default stakes of the betting structure
+	stakes := fixedLimitStakes
+	switch config.Stakes.Betting {
+	case "", BETTING_LIMIT:
+	case BETTING_POT_LIMIT:
+		stakes = potLimitStakes
+	case BETTING_NO_LIMIT:
+		stakes = noLimitStakes
+	default:
+		return config, fmt.Errorf("unknown betting structure: %s", config.Stakes.Betting)
+	}
+
+	for _, amount := range []*int{&config.Stakes.Ante, &config.Stakes.BringIn, &config.Stakes.Low, &config.Stakes.High, &config.Stakes.MaxRaises} {
+		if *amount < 0 {
+			return config, errors.New("stakes can't be negative")
+		}
+	}
+
+	if config.Stakes.Ante > 0 {
+		stakes.Ante = config.Stakes.Ante
+	}
+	if config.Stakes.BringIn > 0 {
+		stakes.BringIn = config.Stakes.BringIn
+	}
+	if config.Stakes.Low > 0 {
+		stakes.Low = config.Stakes.Low
+	}
+	if config.Stakes.High > 0 {
+		stakes.High = config.Stakes.High
+	}
+	if config.Stakes.MaxRaises > 0 {
+		stakes.MaxRaises = config.Stakes.MaxRaises
+	}
+	config.Stakes = stakes
+
+	if !tableIdPattern.MatchString(config.Table) {
+		return config, errors.New("table must be 1-8 letters or digits")
+	}
+	if config.Name == "" || utf8.RuneCountInString(config.Name) > 20 {
+		return config, errors.New("name must be 1-20 characters")
+	}
+	if _, ok := gameNames[config.Game]; !ok {
+		return config, fmt.Errorf("unknown game: %s", config.Game)
+	}
+	if _, ok := botLevels[config.BotLevel]; !ok {
+		return config, fmt.Errorf("unknown bot level: %s", config.BotLevel)
+	}
+	if config.Stakes.BringIn > config.Stakes.Low || config.Stakes.Low > config.Stakes.High {
+		return config, errors.New("stakes must be bring-in <= low <= high")
+	}
+
+	maxSeats := 8
+	if config.Game == GAME_SEVEN_STUD {
+		maxSeats = 7
+	}
+	if config.Seats != 0 && (config.Seats < 2 || config.Seats > maxSeats) {
+		return config, fmt.Errorf("seats must be 2-%d", maxSeats)
+	}
+
+	seats := config.Seats
+	if seats == 0 {
+		seats = maxSeats
+	}
+	if config.Bots < 0 || config.Bots > seats-1 {
+		return config, fmt.Errorf("bots must be 0-%d", seats-1)
+	}
+
+	return config, nil
+}
+
+// The tables created when there is no config file
+func defaultTables() []TableConfig {
+	limit := Stakes{Betting: BETTING_LIMIT}
+	potLimit := Stakes{Betting: BETTING_POT_LIMIT}
+	noLimit := Stakes{Betting: BETTING_NO_LIMIT}
+
+	configs := []TableConfig{
+		{Table: "basement", Name: "The Basement", Stakes: limit, Lobby: true},
+		{Table: "den", Name: "The Den", Stakes: limit, Lobby: true},
+		{Table: "ai2", Name: "AI Room - 2 bots", Stakes: limit, Bots: 2, Lobby: true},
+		{Table: "ai4", Name: "AI Room - 4 bots", Stakes: limit, Bots: 4, Lobby: true},
+		{Table: "ai6", Name: "AI Room - 6 bots", Stakes: limit, Bots: 6, Lobby: true},
+		{Table: "aieasy", Name: "AI Room - easy", Stakes: limit, Bots: 4, BotLevel: BOT_EASY, Lobby: true},
+		{Table: "aihard", Name: "AI Room - hard", Stakes: limit, Bots: 4, BotLevel: BOT_HARD, Lobby: true},
+		{Table: "holdemhd", Name: "Hold'em AI - hard", Game: GAME_HOLDEM, Stakes: noLimit, Bots: 5, BotLevel: BOT_HARD, Lobby: true},
+		{Table: "holdem", Name: "Hold'em Room", Game: GAME_HOLDEM, Stakes: limit, Lobby: true},
+		{Table: "holdem4", Name: "Hold'em AI - 4 bots", Game: GAME_HOLDEM, Stakes: limit, Bots: 4, Lobby: true},
+		{Table: "nlholdem", Name: "No Limit Hold'em", Game: GAME_HOLDEM, Stakes: noLimit, Lobby: true},
+		{Table: "stud7", Name: "7 Card Stud Room", Game: GAME_SEVEN_STUD, Stakes: limit, Lobby: true},
+		{Table: "stud7ai4", Name: "7 Stud AI - 4 bots", Game: GAME_SEVEN_STUD, Stakes: limit, Bots: 4, Lobby: true},
+		{Table: "sng", Name: "Sit & Go Hold'em", Game: GAME_HOLDEM, Stakes: noLimit, Seats: 6, Tournament: true, Lobby: true},
+		{Table: "sngai3", Name: "Sit & Go - 3 bots", Stakes: limit, Seats: 4, Bots: 3, Tournament: true, Lobby: true},
+	}
+
+	// For client developers, hidden tables for each # of bots (for ease of testing with a specific # of players in the game)
+	// These will not update the lobby
+	for i := 1; i < 8; i++ {
+		configs = append(configs,
+			TableConfig{Table: fmt.Sprintf("dev%d", i), Name: fmt.Sprintf("Dev Room - %d bots", i), Stakes: limit, Bots: i},
+			TableConfig{Table: fmt.Sprintf("hdev%d", i), Name: fmt.Sprintf("Dev Hold'em - %d bots", i), Game: GAME_HOLDEM, Stakes: limit, Bots: i})
+	}
+	for i := 1; i < 7; i++ {
+		configs = append(configs, TableConfig{Table: fmt.Sprintf("sdev%d", i), Name: fmt.Sprintf("Dev 7 Stud - %d bots", i), Game: GAME_SEVEN_STUD, Stakes: limit, Bots: i})
+	}
+
+	// Pot and no limit tables, to test clients with bet amounts, and a tournament that starts as soon as a player joins
+	configs = append(configs,
+		TableConfig{Table: "nldev4", Name: "NL Dev - 4 bots", Game: GAME_HOLDEM, Stakes: noLimit, Bots: 4},
+		TableConfig{Table: "pldev4", Name: "PL Dev - 4 bots", Stakes: potLimit, Bots: 4},
+		TableConfig{Table: "sngdev3", Name: "SnG Dev - 3 bots", Game: GAME_HOLDEM, Stakes: noLimit, Seats: 4, Bots: 3, Tournament: true})
+
+	return configs
+}
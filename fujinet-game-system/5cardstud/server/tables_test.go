@@ -0,0 +1,203 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/goccy/go-json"
+	"golang.org/x/exp/slices"
+)
+
+func TestTableConfigValidate(t *testing.T) {
+	config, err := TableConfig{Table: "Test", Name: " Test Table ", Stakes: Stakes{Betting: BETTING_POT_LIMIT, Low: 4}}.validate()
+	if err != nil {
+		t.Fatalf("validate failed with %s", err)
+	}
+
+	want := potLimitStakes
+	want.Low = 4
+	if config.Table != "test" || config.Name != "Test Table" || config.Game != GAME_FIVE_STUD || config.BotLevel != BOT_NORMAL || config.Stakes != want {
+		t.Errorf("validate() = %+v, want the defaults filled in", config)
+	}
+
+	tests := []struct {
+		name   string
+		config TableConfig
+	}{
+		{"table id with a space", TableConfig{Table: "my table", Name: "Test"}},
+		{"table id too long", TableConfig{Table: "abcdefghi", Name: "Test"}},
+		{"no name", TableConfig{Table: "test", Name: " "}},
+		{"name too long", TableConfig{Table: "test", Name: strings.Repeat("ü", 21)}},
+		{"unknown game", TableConfig{Table: "test", Name: "Test", Game: "draw"}},
+		{"unknown betting", TableConfig{Table: "test", Name: "Test", Stakes: Stakes{Betting: "spread"}}},
+		{"unknown bot level", TableConfig{Table: "test", Name: "Test", BotLevel: "godlike"}},
+		{"negative stakes", TableConfig{Table: "test", Name: "Test", Stakes: Stakes{Ante: -1}}},
+		{"low over high", TableConfig{Table: "test", Name: "Test", Stakes: Stakes{Low: 20}}},
+		{"too many seats", TableConfig{Table: "test", Name: "Test", Game: GAME_SEVEN_STUD, Seats: 8}},
+		{"one seat", TableConfig{Table: "test", Name: "Test", Seats: 1}},
+		{"no seat left for players", TableConfig{Table: "test", Name: "Test", Seats: 4, Bots: 4}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := test.config.validate(); err == nil {
+				t.Errorf("%+v was valid", test.config)
+			}
+		})
+	}
+}
+
+func TestCreateTableTwice(t *testing.T) {
+	defer removeTable("twice")
+
+	if _, err := createTable(TableConfig{Table: "twice", Name: "Twice"}); err != nil {
+		t.Fatalf("createTable failed with %s", err)
+	}
+	if _, err := createTable(TableConfig{Table: "Twice", Name: "Twice again"}); err == nil || err.Error() != "table already exists" {
+		t.Errorf("creating the table again returned %v", err)
+	}
+
+	if !removeTable("twice") {
+		t.Errorf("the table could not be removed")
+	}
+	if removeTable("twice") {
+		t.Errorf("the table was removed twice")
+	}
+}
+
+// Calls an admin api, returning the status
+func callAdminAPI(handler gin.HandlerFunc, method string, target string, body string, key string) int {
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(method, target, strings.NewReader(body))
+	if key != "" {
+		c.Request.Header.Set("Authorization", "Bearer "+key)
+	}
+
+	handler(c)
+	return w.Code
+}
+
+// Returns the ids of the tables in the saved config file
+func savedTables(t *testing.T) []string {
+	data, err := os.ReadFile(configPath)
+	if err != nil {
+		t.Fatalf("unable to read the config: %s", err)
+	}
+
+	config := Config{}
+	if err := json.Unmarshal(data, &config); err != nil {
+		t.Fatalf("unable to parse the config: %s", err)
+	}
+
+	ids := []string{}
+	for _, table := range config.Tables {
+		ids = append(ids, table.Table)
+	}
+	return ids
+}
+
+func TestTablesAdminAPI(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	t.Setenv("ADMIN_KEY", "")
+
+	savedConfig, savedPath := serverConfig, configPath
+	defer func() { serverConfig, configPath = savedConfig, savedPath }()
+	serverConfig = Config{AdminKey: "letmein"}
+	configPath = filepath.Join(t.TempDir(), "config.json")
+	defer removeTable("admin")
+
+	body := `{"table":"admin","name":"Admin Table","bots":2}`
+
+	if code := callAdminAPI(apiCreateTable, "POST", "/tables", body, ""); code != http.StatusUnauthorized {
+		t.Errorf("creating a table without a key returned %d", code)
+	}
+	if code := callAdminAPI(apiCreateTable, "POST", "/tables", body, "wrong"); code != http.StatusUnauthorized {
+		t.Errorf("creating a table with the wrong key returned %d", code)
+	}
+	if _, ok := stateMap.Load("admin"); ok {
+		t.Fatalf("the table was created without the admin key")
+	}
+
+	if code := callAdminAPI(apiCreateTable, "POST", "/tables", `{"table":"admin"`, "letmein"); code != http.StatusBadRequest {
+		t.Errorf("creating a table with a broken config returned %d", code)
+	}
+	if code := callAdminAPI(apiCreateTable, "POST", "/tables", body, "letmein"); code != http.StatusCreated {
+		t.Fatalf("creating a table returned %d", code)
+	}
+	if code := callAdminAPI(apiCreateTable, "POST", "/tables", body, "letmein"); code != http.StatusBadRequest {
+		t.Errorf("creating the table again returned %d", code)
+	}
+
+	saved := savedTables(t)
+	if !slices.Contains(saved, "admin") {
+		t.Errorf("the new table was not saved: %v", saved)
+	}
+
+	if code := callAdminAPI(apiDeleteTable, "DELETE", "/tables?table=admin", "", "wrong"); code != http.StatusUnauthorized {
+		t.Errorf("removing a table with the wrong key returned %d", code)
+	}
+	if code := callAdminAPI(apiDeleteTable, "DELETE", "/tables?table=admin", "", "letmein"); code != http.StatusOK {
+		t.Fatalf("removing the table returned %d", code)
+	}
+	if code := callAdminAPI(apiDeleteTable, "DELETE", "/tables?table=admin", "", "letmein"); code != http.StatusNotFound {
+		t.Errorf("removing the table again returned %d", code)
+	}
+
+	saved = savedTables(t)
+	if slices.Contains(saved, "admin") {
+		t.Errorf("the removed table is still saved: %v", saved)
+	}
+
+	// Without an admin key, tables can't be changed
+	serverConfig.AdminKey = ""
+	if code := callAdminAPI(apiCreateTable, "POST", "/tables", body, ""); code != http.StatusUnauthorized {
+		t.Errorf("creating a table without an admin key returned %d", code)
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+	savedConfig, savedPath := serverConfig, configPath
+	defer func() { serverConfig, configPath = savedConfig, savedPath }()
+
+	path := filepath.Join(t.TempDir(), "tables", "config.json")
+	t.Setenv("CONFIG_FILE", path)
+	t.Setenv("ADMIN_KEY", "")
+
+	// Without a config file, the built in tables are used
+	serverConfig = Config{}
+	if configs := loadConfig(); len(configs) != len(defaultTables()) {
+		t.Errorf("loaded %d tables without a config file, want the %d built in tables", len(configs), len(defaultTables()))
+	}
+
+	serverConfig = Config{AdminKey: "letmein"}
+	saveConfig([]TableConfig{{Table: "one", Name: "One"}, {Table: "two", Name: "Two", Game: GAME_HOLDEM}})
+
+	serverConfig = Config{}
+	configs := loadConfig()
+	if len(configs) != 2 || configs[0].Table != "one" || configs[1].Game != GAME_HOLDEM {
+		t.Errorf("loaded %+v, want the saved tables", configs)
+	}
+	if serverConfig.AdminKey != "letmein" {
+		t.Errorf("loaded the admin key %q", serverConfig.AdminKey)
+	}
+
+	// An admin key from the env is used over the file, and not saved to it
+	t.Setenv("ADMIN_KEY", "fromenv")
+	serverConfig = Config{}
+	loadConfig()
+	if serverConfig.AdminKey != "fromenv" {
+		t.Errorf("the admin key is %q, want the one from the env", serverConfig.AdminKey)
+	}
+
+	saveConfig(configs)
+	data, _ := os.ReadFile(path)
+	if strings.Contains(string(data), "fromenv") {
+		t.Errorf("the admin key from the env was saved")
+	}
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"log"
+	"sync"
+	"time"
+)
+
+/*
+Table tickers - every table has a goroutine that moves its game along, running the game logic every
+TICK_INTERVAL under the table's lock. Move timers expire and bots move on time, whether or not
+clients are polling, so /state only has to read the state. Lobby updates made by the game logic are
+queued and sent by their own goroutine (see lobbyClient.go), so a slow lobby never holds the lock.
+
+A table only ticks while a human player is seated and active, so tables of bots don't play on
+their own. A Sit & Go that only bots are left in would never finish, so it starts registering again.
+*/
+
+const TICK_INTERVAL = time.Millisecond * time.Duration(250)
+
+// Closed to stop the ticker of a table, by table
+var tableTickers sync.Map
+
+// Starts the ticker of a table
+func startTicker(table string) {
+	stop := make(chan struct{})
+	if previous, loaded := tableTickers.Swap(table, stop); loaded {
+		close(previous.(chan struct{}))
+	}
+
+	go func() {
+		ticker := time.NewTicker(TICK_INTERVAL)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				tickTable(table)
+			}
+		}
+	}()
+}
+
+// Stops the ticker of a table that is removed
+func stopTicker(table string) {
+	if stop, loaded := tableTickers.LoadAndDelete(table); loaded {
+		close(stop.(chan struct{}))
+	}
+}
+
+// Moves the game of a table along by a step
+func tickTable(table string) {
+	unlock := tableMutex.Lock(table)
+	defer unlock()
+
+	value, ok := stateMap.Load(table)
+	if !ok {
+		return
+	}
+
+	stateCopy := *value.(*GameState)
+	state := &stateCopy
+
+	if _, humanPlayerCount := state.getHumanPlayerCountInfo(); humanPlayerCount == 0 {
+		if state.tournament.started {
+			log.Printf("Sit & Go at %s abandoned", table)
+			state.resetTournament()
+			saveState(state)
+		}
+		return
+	}
+
+	// The ticker does not act for any client
+	state.clientPlayer = -1
+	state.runGameLogic()
+	saveState(state)
+}
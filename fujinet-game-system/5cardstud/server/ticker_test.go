@@ -0,0 +1,115 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// Creates a table of bots and saves it, with a human seated if one is given
+func createTickerTable(table string, bots int, human string) {
+	state := createGameState(GAME_FIVE_STUD, fixedLimitStakes, bots, false)
+	state.table = table
+	if human != "" {
+		state.addPlayer(human, false)
+		state.Players[len(state.Players)-1].lastPing = time.Now()
+	}
+	saveState(state)
+}
+
+// Returns the saved state of a table, read under its lock
+func loadTickerTable(table string) *GameState {
+	unlock := tableMutex.Lock(table)
+	defer unlock()
+
+	value, _ := stateMap.Load(table)
+	return value.(*GameState)
+}
+
+func TestTickTable(t *testing.T) {
+	createTickerTable("tick", 2, "Jim")
+	defer stateMap.Delete("tick")
+
+	tickTable("tick")
+
+	state := loadTickerTable("tick")
+	if state.Round != 1 || state.ActivePlayer < 0 {
+		t.Fatalf("after a tick the table is at round %d with active player %d, want the first round started", state.Round, state.ActivePlayer)
+	}
+	if state.clientPlayer != -1 {
+		t.Errorf("the tick acted for player %d", state.clientPlayer)
+	}
+
+	// The moves of the bots are made as their time comes, without anyone polling
+	for i := 0; i < 40 && state.Players[state.ActivePlayer].isBot; i++ {
+		time.Sleep(TICK_INTERVAL)
+		tickTable("tick")
+		state = loadTickerTable("tick")
+	}
+	if state.Players[state.ActivePlayer].isBot {
+		t.Errorf("the bots did not move on their own")
+	}
+}
+
+// Tables of bots don't play on their own
+func TestTickTableWithoutHumans(t *testing.T) {
+	createTickerTable("tickbots", 3, "")
+	defer stateMap.Delete("tickbots")
+
+	// A player that stopped polling doesn't count
+	createTickerTable("tickgone", 2, "Jim")
+	defer stateMap.Delete("tickgone")
+	loadTickerTable("tickgone").Players[2].lastPing = time.Now().Add(PLAYER_PING_TIMEOUT * 2)
+
+	for _, table := range []string{"tickbots", "tickgone"} {
+		before := loadTickerTable(table)
+		tickTable(table)
+
+		if state := loadTickerTable(table); state != before || state.Round != 0 {
+			t.Errorf("table %s ticked without a human player, at round %d", table, state.Round)
+		}
+	}
+
+	// A table that was removed is left alone
+	tickTable("tickmissing")
+	if _, ok := stateMap.Load("tickmissing"); ok {
+		t.Errorf("a tick created a removed table")
+	}
+}
+
+func TestTickers(t *testing.T) {
+	createTickerTable("ticker", 2, "Jim")
+	defer stateMap.Delete("ticker")
+
+	startTicker("ticker")
+	first, _ := tableTickers.Load("ticker")
+
+	// Starting the ticker again replaces the running one
+	startTicker("ticker")
+	second, _ := tableTickers.Load("ticker")
+	select {
+	case <-first.(chan struct{}):
+	default:
+		t.Errorf("the replaced ticker was not stopped")
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for loadTickerTable("ticker").Round == 0 && time.Now().Before(deadline) {
+		time.Sleep(TICK_INTERVAL / 2)
+	}
+	if loadTickerTable("ticker").Round == 0 {
+		t.Errorf("the ticker did not start the game")
+	}
+
+	stopTicker("ticker")
+	if _, ok := tableTickers.Load("ticker"); ok {
+		t.Errorf("the stopped ticker is still listed")
+	}
+	select {
+	case <-second.(chan struct{}):
+	default:
+		t.Errorf("the ticker was not stopped")
+	}
+
+	// Stopping a table without a ticker does nothing
+	stopTicker("ticker")
+}
@@ -0,0 +1,259 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+)
+
+/*
+Sit & Go tournaments - a table with a fixed number of seats that starts playing once every seat is taken.
+
+Players (and any bots) register by joining the table. Everybody starts with TOURNAMENT_STACK chips, not
+their bankroll. The stakes of the table are multiplied by the next entry in levelMultipliers every
+TOURNAMENT_LEVEL_GAMES games. A player whose purse hits zero is out, and bots are not refilled. Players
+that leave or time out are out too. Once a single player has chips the tournament is over: the placings
+are shown and reported to the lobby, and registration starts again. It also starts again if every human
+player is gone, leaving only bots (see ticker.go).
+*/
+
+const TOURNAMENT_STACK = 500
+const TOURNAMENT_LEVEL_GAMES = 5
+const TOURNAMENT_RESULT_TIME_LIMIT = time.Second * time.Duration(30)
+
+var levelMultipliers = []int{1, 2, 3, 5, 8, 12, 20, 30, 50, 80}
+
+type Tournament struct {
+	Seats int
+	Bots  int
+
+	started  bool
+	finished bool
+	games    int
+	level    int
+	base     Stakes
+	placings []Placing
+}
+
+type Placing struct {
+	Name  string
+	Place int
+	isBot bool
+}
+
+func (state *GameState) isTournament() bool {
+	return state.tournament.Seats > 0
+}
+
+// Seats at the table, fewer than the game allows on tournament tables and tables set up with fewer seats
+func (state *GameState) seats() int {
+	if state.isTournament() {
+		return state.tournament.Seats
+	}
+	if state.maxSeats > 0 {
+		return minInt(state.maxSeats, state.maxPlayers())
+	}
+	return state.maxPlayers()
+}
+
+// True if a new player can sit down
+func (state *GameState) canSeat() bool {
+	return len(state.Players) < state.seats() && !state.tournament.started
+}
+
+// Starts the tournament if every seat is taken, otherwise updates the registration message.
+// Returns true if the tournament is running.
+func (state *GameState) startTournament() bool {
+	if state.tournament.started {
+		return true
+	}
+
+	if len(state.Players) < state.tournament.Seats {
+		state.LastResult = fmt.Sprintf("Sit & Go: waiting for %d more players", state.tournament.Seats-len(state.Players))
+		return false
+	}
+
+	state.tournament.started = true
+	state.tournament.finished = false
+	state.tournament.games = 0
+	state.tournament.level = 0
+	state.tournament.placings = []Placing{}
+	state.stakes = state.tournament.base
+
+	for i := range state.Players {
+		state.Players[i].Purse = TOURNAMENT_STACK
+	}
+
+	state.LastResult = ""
+	state.updateLobby()
+
+	log.Printf("Sit & Go started at %s", state.table)
+	return true
+}
+
+// Places players whose purse hit zero at the end of a game, ending the tournament if a single player
+// has chips left. Returns the result of the game with the players that are out, or the placings.
+func (state *GameState) eliminatePlayers(result string) string {
+	busted := []int{}
+	remaining := []int{}
+
+	// Players that left, but are still at the table, are out as well
+	for index, player := range state.Players {
+		if (player.Purse == 0 || player.Status == STATUS_LEFT) && !state.isPlaced(player.Name) {
+			busted = append(busted, index)
+		} else if player.Purse > 0 && player.Status != STATUS_LEFT {
+			remaining = append(remaining, index)
+		}
+	}
+
+	// Players that busted in the same game place by the stack they started it with
+	sort.SliceStable(busted, func(i, j int) bool {
+		return state.Players[busted[i]].invested < state.Players[busted[j]].invested
+	})
+
+	out := []string{}
+	for _, index := range busted {
+		place := state.placePlayer(state.Players[index])
+		out = append(out, fmt.Sprintf("%s out %s", state.Players[index].Name, ordinal(place)))
+	}
+
+	if len(remaining) > 1 {
+		if len(out) > 0 {
+			result += ", " + strings.Join(out, ", ")
+		}
+		return result
+	}
+
+	// The tournament is over
+	if len(remaining) == 1 {
+		state.placePlayer(state.Players[remaining[0]])
+	}
+	state.tournament.finished = true
+	state.moveExpires = time.Now().Add(TOURNAMENT_RESULT_TIME_LIMIT)
+
+	gameResult := GameResult{Players: []GamePlayer{}}
+	placings := []string{}
+
+	sort.SliceStable(state.tournament.placings, func(i, j int) bool {
+		return state.tournament.placings[i].Place < state.tournament.placings[j].Place
+	})
+
+	for _, placing := range state.tournament.placings {
+		gamePlayer := GamePlayer{Name: placing.Name, Winner: placing.Place == 1, Type: PLAYER_TYPE_HUMAN}
+		if placing.isBot {
+			gamePlayer.Type = PLAYER_TYPE_BOT
+		}
+		gameResult.Players = append(gameResult.Players, gamePlayer)
+
+		if placing.Place > 1 {
+			placings = append(placings, fmt.Sprintf("%s %s", ordinal(placing.Place), placing.Name))
+		}
+	}
+
+	state.updateLobbyWithGameResult(&gameResult)
+
+	result = "Sit & Go over"
+	if len(remaining) == 1 {
+		result = state.Players[remaining[0]].Name + " won the Sit & Go"
+	}
+	if len(placings) > 0 {
+		result += ", " + strings.Join(placings, ", ")
+	}
+
+	log.Printf("%s at %s", result, state.table)
+	return result
+}
+
+func (state *GameState) isPlaced(name string) bool {
+	for _, placing := range state.tournament.placings {
+		if strings.EqualFold(placing.Name, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// Records the place of a player that is out (or the winner), returning it
+func (state *GameState) placePlayer(player Player) int {
+	place := state.tournament.Seats - len(state.tournament.placings)
+	state.tournament.placings = append(state.tournament.placings, Placing{Name: player.Name, Place: place, isBot: player.isBot})
+	return place
+}
+
+// Moves on to the next game of the tournament: players that are out leave the table and
+// the stakes go up on schedule. Once it is over, registration starts again.
+// Returns true if the next game can start.
+func (state *GameState) nextTournamentGame() bool {
+	if state.tournament.finished {
+		state.resetTournament()
+		return false
+	}
+
+	for i := range state.Players {
+		if state.Players[i].Purse == 0 {
+			state.Players[i].Status = STATUS_LEFT
+		}
+	}
+
+	state.tournament.games++
+	level := minInt(state.tournament.games/TOURNAMENT_LEVEL_GAMES, len(levelMultipliers)-1)
+
+	if level != state.tournament.level {
+		state.tournament.level = level
+		multiplier := levelMultipliers[level]
+		base := state.tournament.base
+
+		state.stakes.Ante = base.Ante * multiplier
+		state.stakes.BringIn = base.BringIn * multiplier
+		state.stakes.Low = base.Low * multiplier
+		state.stakes.High = base.High * multiplier
+	}
+
+	return true
+}
+
+// Clears the table and opens registration for the next tournament, with the bots of the table registered again
+func (state *GameState) resetTournament() {
+	state.Players = []Player{}
+	for i := 0; i < state.tournament.Bots; i++ {
+		state.addPlayer(botNames[i], true)
+	}
+
+	state.clientPlayer = -1
+	state.tournament.started = false
+	state.tournament.finished = false
+	state.stakes = state.tournament.base
+	state.Round = 0
+	state.Pot = 0
+	state.gameOver = false
+	state.ActivePlayer = -1
+
+	state.startTournament()
+	state.updateLobby()
+}
+
+// Describes the tournament for the client, e.g. "Level 2: ante 2, bets 10/20"
+func (state *GameState) tournamentStatus() string {
+	if !state.tournament.started {
+		return fmt.Sprintf("Registering %d/%d", len(state.Players), state.tournament.Seats)
+	}
+
+	if state.gameType == GAME_HOLDEM {
+		return fmt.Sprintf("Level %d: blinds %d/%d", state.tournament.level+1, state.stakes.BringIn, state.stakes.Low)
+	}
+	return fmt.Sprintf("Level %d: ante %d, bets %d/%d", state.tournament.level+1, state.stakes.Ante, state.stakes.Low, state.stakes.High)
+}
+
+func ordinal(place int) string {
+	switch place {
+	case 1:
+		return "1st"
+	case 2:
+		return "2nd"
+	case 3:
+		return "3rd"
+	}
+	return fmt.Sprintf("%dth", place)
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// Creates a Sit & Go table with the bots registered, as createTable does
+func createTournament(table string, seats int, bots int) *GameState {
+	state := createGameState(GAME_FIVE_STUD, fixedLimitStakes, 0, false)
+	state.table = table
+	state.tournament = Tournament{Seats: seats, Bots: bots, base: fixedLimitStakes}
+	for i := 0; i < bots; i++ {
+		state.addPlayer(botNames[i], true)
+	}
+	state.startTournament()
+	return state
+}
+
+// Once the last human is out, the bots don't keep the table to themselves
+func TestAbandonedTournamentRestarts(t *testing.T) {
+	state := createTournament("sng-test", 4, 3)
+	state.addPlayer("Human", false)
+	state.Players[3].lastPing = time.Now()
+
+	if !state.startTournament() {
+		t.Fatalf("tournament did not start with every seat taken")
+	}
+
+	// The human busts out
+	state.Players[3].Purse = 0
+	state.Players[3].Status = STATUS_LEFT
+	saveState(state)
+	defer stateMap.Delete(state.table)
+
+	tickTable(state.table)
+
+	value, _ := stateMap.Load(state.table)
+	state = value.(*GameState)
+	if state.tournament.started || !state.canSeat() || len(state.Players) != 3 {
+		t.Fatalf("abandoned tournament has started %v, canSeat %v and %d players, want registration with the 3 bots",
+			state.tournament.started, state.canSeat(), len(state.Players))
+	}
+}
+
+// The result of a Sit & Go reaches the lobby from tables of other games, which are not listed there
+func TestTournamentResultReported(t *testing.T) {
+	UpdateLobby = true
+	defer func() {
+		UpdateLobby = false
+		for len(lobbyQueue) > 0 {
+			<-lobbyQueue
+		}
+	}()
+
+	state := createGameState(GAME_HOLDEM, fixedLimitStakes, 0, false)
+	state.table = "sng-holdem"
+	state.reportResults = true
+	state.tournament = Tournament{Seats: 2, base: fixedLimitStakes}
+	state.addPlayer("Meg", false)
+	state.addPlayer("Jim", false)
+	state.startTournament()
+
+	if len(lobbyQueue) != 0 {
+		t.Fatalf("a table that isn't listed in the lobby sent %d updates", len(lobbyQueue))
+	}
+
+	state.Players[1].Purse = 0
+	state.eliminatePlayers("Meg won")
+
+	if len(lobbyQueue) != 1 {
+		t.Fatalf("tournament result sent %d updates, want 1", len(lobbyQueue))
+	}
+
+	update := <-lobbyQueue
+	if update.Status != "offline" || update.GameResult == nil || len(update.GameResult.Players) != 2 || !update.GameResult.Players[0].Winner {
+		t.Fatalf("tournament result sent as %+v", update)
+	}
+}
+
+func TestTournamentRegistration(t *testing.T) {
+	state := createTournament("sng-register", 4, 2)
+
+	if state.tournament.started || !state.canSeat() || state.LastResult != "Sit & Go: waiting for 2 more players" {
+		t.Fatalf("registration has started %v, canSeat %v and result %q", state.tournament.started, state.canSeat(), state.LastResult)
+	}
+
+	state.addPlayer("Meg", false)
+	state.addPlayer("Jim", false)
+	state.Players[2].Purse = 1234
+
+	if !state.startTournament() || state.canSeat() || state.tournamentStatus() != "Level 1: ante 1, bets 5/10" {
+		t.Fatalf("full table has started %v, canSeat %v and status %q", state.tournament.started, state.canSeat(), state.tournamentStatus())
+	}
+	for _, player := range state.Players {
+		if player.Purse != TOURNAMENT_STACK {
+			t.Fatalf("%s starts with %d chips, want %d", player.Name, player.Purse, TOURNAMENT_STACK)
+		}
+	}
+}
+
+func TestTournamentEliminations(t *testing.T) {
+	state := createTournament("sng-out", 4, 0)
+	for _, name := range []string{"Meg", "Jim", "Thom", "Kirk"} {
+		state.addPlayer(name, false)
+	}
+	state.startTournament()
+
+	// Two players bust in the same game. The one that started it with more chips places better.
+	state.Players[2].Purse, state.Players[2].invested = 0, 50
+	state.Players[3].Purse, state.Players[3].invested = 0, 100
+
+	if result := state.eliminatePlayers("Meg won"); result != "Meg won, Thom out 4th, Kirk out 3rd" {
+		t.Fatalf("first game result is %q", result)
+	}
+	if state.tournament.finished {
+		t.Fatalf("tournament finished with 2 players left")
+	}
+
+	// Players that are out leave the table before the next game
+	state.nextTournamentGame()
+	if state.Players[2].Status != STATUS_LEFT || state.Players[3].Status != STATUS_LEFT {
+		t.Fatalf("players that are out have status %d and %d", state.Players[2].Status, state.Players[3].Status)
+	}
+
+	state.Players[1].Purse = 0
+	if result := state.eliminatePlayers("Meg won"); result != "Meg won the Sit & Go, 2nd Jim, 3rd Kirk, 4th Thom" {
+		t.Fatalf("last game result is %q", result)
+	}
+	if !state.tournament.finished {
+		t.Fatalf("tournament is not finished with 1 player left")
+	}
+
+	// Registration starts again
+	if state.nextTournamentGame() || state.tournament.started || len(state.Players) != 0 {
+		t.Fatalf("finished tournament has started %v and %d players", state.tournament.started, len(state.Players))
+	}
+}
+
+func TestTournamentLevels(t *testing.T) {
+	tests := []struct {
+		games      int
+		multiplier int
+	}{
+		{0, 1},
+		{TOURNAMENT_LEVEL_GAMES - 1, 1},
+		{TOURNAMENT_LEVEL_GAMES, 2},
+		{2 * TOURNAMENT_LEVEL_GAMES, 3},
+		{100 * TOURNAMENT_LEVEL_GAMES, levelMultipliers[len(levelMultipliers)-1]},
+	}
+
+	for _, test := range tests {
+		state := createTournament("sng-levels", 2, 2)
+		for i := 0; i < test.games; i++ {
+			state.nextTournamentGame()
+		}
+
+		base := fixedLimitStakes
+		want := Stakes{Betting: base.Betting, Ante: base.Ante * test.multiplier, BringIn: base.BringIn * test.multiplier,
+			Low: base.Low * test.multiplier, High: base.High * test.multiplier, MaxRaises: base.MaxRaises}
+		if state.stakes != want {
+			t.Errorf("after %d games the stakes are %+v, want %+v", test.games, state.stakes, want)
+		}
+	}
+
+	// Hold'em shows the blinds
+	state := createGameState(GAME_HOLDEM, fixedLimitStakes, 2, false)
+	state.tournament = Tournament{Seats: 2, Bots: 2, base: fixedLimitStakes}
+	state.startTournament()
+	for i := 0; i < TOURNAMENT_LEVEL_GAMES; i++ {
+		state.nextTournamentGame()
+	}
+	if status := state.tournamentStatus(); status != "Level 2: blinds 4/10" {
+		t.Errorf("hold'em tournament status is %q", status)
+	}
+}
@@ -63,6 +63,17 @@ func serializeResults(c *gin.Context, obj any) {
 			}
 		}
 
+		// Binary version of Leaderboard - the count and entries of the biggest stacks, then of the biggest pots
+		if leaderboard, ok := obj.(Leaderboard); ok {
+			for _, entries := range [][]LeaderboardEntry{leaderboard.Stacks, leaderboard.Pots} {
+				buf = append(buf, byte(len(entries)))
+				for _, o := range entries {
+					buf = appendFixedLengthString(buf, o.Name, 8)
+					buf = appendUint16(buf, minInt(o.Amount, 65535), bigEndian)
+				}
+			}
+		}
+
 		// Binary version of GameState
 
 		/*
@@ -78,6 +89,30 @@ func serializeResults(c *gin.Context, obj any) {
 			  uint8_t playerCount;
 			  Player players[8];
 			} Game;
+
+			Seven Card Stud and Hold'em tables append the below, so clients that only play
+			5 Card Stud can keep reading the same structure. Hands of up to 7 cards are
+			truncated to 5 in the Player struct, so they are repeated in full here.
+
+			typedef struct {
+			  char game[7];
+			  char community[10];
+			  char hands[8][14];
+			} GameExtra;
+
+			Pot and no limit tables then append the amounts of the valid moves (0 for moves without one)
+
+			typedef struct {
+			  char betting[7];
+			  uint16_t min[5];
+			  uint16_t max[5];
+			} BettingExtra;
+
+			Tournament tables then append their registration or level, e.g. "Level 2: ante 2, bets 10/20"
+
+			typedef struct {
+			  char tournament[30];
+			} TournamentExtra;
 		*/
 
 		if o, ok := obj.(*GameState); ok {
@@ -116,6 +151,36 @@ func serializeResults(c *gin.Context, obj any) {
 				buf = appendUint16(buf, o.Players[i].Purse, bigEndian)
 				buf = appendFixedLengthString(buf, o.Players[i].Hand, 10)
 			}
+
+			if o.Game != "" {
+				buf = appendFixedLengthString(buf, o.Game, 7)
+				buf = appendFixedLengthString(buf, o.Community, 10)
+				for i := 0; i < len(o.Players); i++ {
+					buf = appendFixedLengthString(buf, o.Players[i].Hand, 14)
+				}
+			}
+
+			if o.Betting != "" {
+				buf = appendFixedLengthString(buf, o.Betting, 7)
+				for i := 0; i < 5; i++ {
+					if i < moves {
+						buf = appendUint16(buf, o.ValidMoves[i].Min, bigEndian)
+					} else {
+						buf = appendUint16(buf, 0, bigEndian)
+					}
+				}
+				for i := 0; i < 5; i++ {
+					if i < moves {
+						buf = appendUint16(buf, o.ValidMoves[i].Max, bigEndian)
+					} else {
+						buf = appendUint16(buf, 0, bigEndian)
+					}
+				}
+			}
+
+			if o.Tournament != "" {
+				buf = appendFixedLengthString(buf, o.Tournament, 30)
+			}
 		}
 
 		c.Data(http.StatusOK, "application/octet-stream", buf)
@@ -155,3 +220,31 @@ func appendFixedLengthString(buf []byte, s string, maxLen int) []byte {
 	}
 	return buf
 }
+
+func minInt(a int, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func minFloat(a float64, b float64) float64 {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func maxInt64(a int64, b int64) int64 {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+func maxInt(a int, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}